@@ -0,0 +1,256 @@
+package cryptconverter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	commonpb "go.temporal.io/api/common/v1"
+
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/workflow"
+)
+
+var (
+	// ErrPayloadBindingMismatch is returned when a payload was encrypted for a different workflow execution.
+	ErrPayloadBindingMismatch = errors.New("payload is bound to a different workflow execution")
+
+	// ErrPayloadNotBound is returned when an unbound payload is decoded and RequireBinding is set.
+	ErrPayloadNotBound = errors.New("payload is not bound to a workflow execution")
+)
+
+var _ workflow.ContextAware = (*ContextCryptDataConverter)(nil)
+
+type bindingContextKey struct{}
+
+// bindingHeaderKey is the header passing the binding of a workflow to its activities and children
+const bindingHeaderKey = "cryptconverter-binding"
+
+// ContextCryptDataConverterOptions configures ContextCryptDataConverter.
+type ContextCryptDataConverterOptions struct {
+	// RequireBinding rejects payloads that were encrypted without associated data.
+	// Client APIs other than ExecuteWorkflow (signals, queries) are not context aware and
+	// always produce unbound payloads, so only set this if workflows don't accept them.
+	RequireBinding bool
+}
+
+// ContextCryptDataConverter implements DataConverter using AES Crypt and binds every payload
+// to the namespace and workflow ID of the execution it belongs to by passing them to AES-GCM
+// as associated data. A payload copied into another workflow execution fails to decode.
+//
+// It implements workflow.ContextAware, so Temporal tailors it to the current workflow or activity.
+// The worker must use the propagator returned by NewBindingPropagator, which binds the activities
+// to their workflow and the child workflows to the binding of their parent, so the payloads
+// exchanged by the executions of a workflow tree are bound to its root execution.
+type ContextCryptDataConverter struct {
+	crypt   *CryptDataConverter
+	options ContextCryptDataConverterOptions
+	binding string
+}
+
+// NewContextCryptDataConverter creates new instance of ContextCryptDataConverter wrapping a DataConverter
+func NewContextCryptDataConverter(dataConverter converter.DataConverter, options ContextCryptDataConverterOptions) *ContextCryptDataConverter {
+	return &ContextCryptDataConverter{
+		crypt:   NewCryptDataConverter(dataConverter),
+		options: options,
+	}
+}
+
+// WithWorkflowBinding returns a context that binds payloads encoded by ContextCryptDataConverter
+// to the given workflow execution. Use it when starting a workflow from a client.
+func WithWorkflowBinding(ctx context.Context, namespace string, workflowID string) context.Context {
+	return context.WithValue(ctx, bindingContextKey{}, workflowBinding(namespace, workflowID))
+}
+
+func workflowBinding(namespace string, workflowID string) string {
+	return namespace + "/" + workflowID
+}
+
+// workflowContextBinding returns the binding propagated to a child workflow, or the binding of
+// the workflow execution otherwise
+func workflowContextBinding(ctx workflow.Context) string {
+	if binding, ok := ctx.Value(bindingContextKey{}).(string); ok {
+		return binding
+	}
+	info := workflow.GetInfo(ctx)
+	return workflowBinding(info.Namespace, info.WorkflowExecution.ID)
+}
+
+// bindingPropagator passes the binding of a workflow to its activities and child workflows
+type bindingPropagator struct{}
+
+// NewBindingPropagator returns a context propagator that binds payloads encoded by
+// ContextCryptDataConverter in activities to their workflow, and in child workflows to their
+// parent, as WithWorkflowBinding does for clients. Set it in the ContextPropagators of the
+// worker's client.
+func NewBindingPropagator() workflow.ContextPropagator {
+	return &bindingPropagator{}
+}
+
+// Inject does nothing, clients bind with WithWorkflowBinding
+func (p *bindingPropagator) Inject(context.Context, workflow.HeaderWriter) error {
+	return nil
+}
+
+// InjectFromWorkflow passes the binding of the workflow to its activities and child workflows
+func (p *bindingPropagator) InjectFromWorkflow(ctx workflow.Context, writer workflow.HeaderWriter) error {
+	payload, err := converter.GetDefaultDataConverter().ToPayload(workflowContextBinding(ctx))
+	if err != nil {
+		return err
+	}
+	writer.Set(bindingHeaderKey, payload)
+	return nil
+}
+
+// Extract binds the activity context to the binding of its workflow, or to the workflow execution
+// of the activity if the workflow didn't pass it. The SDK only extracts headers into activity contexts.
+func (p *bindingPropagator) Extract(ctx context.Context, reader workflow.HeaderReader) (context.Context, error) {
+	if payload, ok := reader.Get(bindingHeaderKey); ok {
+		var binding string
+		if err := converter.GetDefaultDataConverter().FromPayload(payload, &binding); err != nil {
+			return ctx, err
+		}
+		return context.WithValue(ctx, bindingContextKey{}, binding), nil
+	}
+	info := activity.GetInfo(ctx)
+	return WithWorkflowBinding(ctx, info.WorkflowNamespace, info.WorkflowExecution.ID), nil
+}
+
+// ExtractToWorkflow binds a child workflow to the binding of its parent. The header is ignored by
+// the workflows without parent, so a client can't bind them to another execution.
+func (p *bindingPropagator) ExtractToWorkflow(ctx workflow.Context, reader workflow.HeaderReader) (workflow.Context, error) {
+	payload, ok := reader.Get(bindingHeaderKey)
+	if !ok || workflow.GetInfo(ctx).ParentWorkflowExecution == nil {
+		return ctx, nil
+	}
+	var binding string
+	if err := converter.GetDefaultDataConverter().FromPayload(payload, &binding); err != nil {
+		return ctx, err
+	}
+	return workflow.WithValue(ctx, bindingContextKey{}, binding), nil
+}
+
+// WithWorkflowContext returns a DataConverter bound to the workflow execution of ctx, or to the
+// binding of its parent for a child workflow.
+func (dc *ContextCryptDataConverter) WithWorkflowContext(ctx workflow.Context) converter.DataConverter {
+	return dc.withBinding(workflowContextBinding(ctx))
+}
+
+// WithContext returns a DataConverter bound to the execution set by WithWorkflowBinding or, in
+// activities, by the propagator returned by NewBindingPropagator. Otherwise dc is returned as-is.
+func (dc *ContextCryptDataConverter) WithContext(ctx context.Context) converter.DataConverter {
+	if binding, ok := ctx.Value(bindingContextKey{}).(string); ok {
+		return dc.withBinding(binding)
+	}
+	return dc
+}
+
+func (dc *ContextCryptDataConverter) withBinding(binding string) *ContextCryptDataConverter {
+	return &ContextCryptDataConverter{
+		crypt:   dc.crypt,
+		options: dc.options,
+		binding: binding,
+	}
+}
+
+// verifyBinding checks that the payload was encrypted for the execution dc is bound to.
+// An unbound converter can't tell which execution to expect and accepts any binding.
+func (dc *ContextCryptDataConverter) verifyBinding(payload *commonpb.Payload) error {
+	metadata := payload.GetMetadata()
+	if _, ok := metadata[MetadataEncryptionKeyId]; !ok || dc.binding == "" {
+		return nil
+	}
+
+	aad, ok := metadata[MetadataEncryptionAAD]
+	if !ok {
+		if dc.options.RequireBinding {
+			return ErrPayloadNotBound
+		}
+		return nil
+	}
+	if string(aad) != dc.binding {
+		return fmt.Errorf("%w: expected %q, got %q", ErrPayloadBindingMismatch, dc.binding, aad)
+	}
+
+	return nil
+}
+
+// ToPayloads converts a list of values.
+func (dc *ContextCryptDataConverter) ToPayloads(values ...interface{}) (*commonpb.Payloads, error) {
+	result := &commonpb.Payloads{}
+
+	for i, value := range values {
+		payload, err := dc.ToPayload(value)
+		if err != nil {
+			return nil, fmt.Errorf("values[%d]: %w", i, err)
+		}
+
+		result.Payloads = append(result.Payloads, payload)
+	}
+
+	return result, nil
+}
+
+// ToPayload converts single value to payload.
+func (dc *ContextCryptDataConverter) ToPayload(value interface{}) (*commonpb.Payload, error) {
+	payload, err := dc.crypt.dataConverter.ToPayload(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if payload == nil {
+		return payload, nil
+	}
+
+	keyId, key := dc.crypt.getEncryptionKey()
+
+	err = dc.crypt.encryptPayload(payload, keyId, key, []byte(dc.binding))
+	if err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+// FromPayloads converts to a list of values of different types.
+func (dc *ContextCryptDataConverter) FromPayloads(payloads *commonpb.Payloads, valuePtrs ...interface{}) error {
+	for i, payload := range payloads.GetPayloads() {
+		err := dc.FromPayload(payload, valuePtrs[i])
+		if err != nil {
+			return fmt.Errorf("args[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// FromPayload converts single value from payload.
+func (dc *ContextCryptDataConverter) FromPayload(payload *commonpb.Payload, valuePtr interface{}) error {
+	err := dc.verifyBinding(payload)
+	if err != nil {
+		return err
+	}
+
+	return dc.crypt.FromPayload(payload, valuePtr)
+}
+
+// ToStrings converts payloads object into human readable strings.
+func (dc *ContextCryptDataConverter) ToStrings(payloads *commonpb.Payloads) []string {
+	var result []string
+	for _, payload := range payloads.GetPayloads() {
+		result = append(result, dc.ToString(payload))
+	}
+
+	return result
+}
+
+// ToString converts payload object into human readable string.
+func (dc *ContextCryptDataConverter) ToString(payload *commonpb.Payload) string {
+	err := dc.verifyBinding(payload)
+	if err != nil {
+		return err.Error()
+	}
+
+	return dc.crypt.ToString(payload)
+}
@@ -1,12 +1,16 @@
 package cryptconverter
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	commonpb "go.temporal.io/api/common/v1"
 	"go.temporal.io/sdk/converter"
 	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
 )
 
 func Test_Workflow(t *testing.T) {
@@ -46,3 +50,194 @@ func Test_DataConverter(t *testing.T) {
 
 	require.Equal(t, "Testing", result)
 }
+
+func Test_ContextWorkflow(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.SetDataConverter(NewContextCryptDataConverter(
+		converter.GetDefaultDataConverter(),
+		ContextCryptDataConverterOptions{},
+	))
+	env.SetContextPropagators([]workflow.ContextPropagator{NewBindingPropagator()})
+	env.RegisterActivity(Activity)
+
+	env.ExecuteWorkflow(Workflow, "Temporal")
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	var result string
+	require.NoError(t, env.GetWorkflowResult(&result))
+	require.Equal(t, "Hello Temporal!", result)
+}
+
+// bindingActivity returns the binding of the activity context
+func bindingActivity(ctx context.Context) (string, error) {
+	binding, _ := ctx.Value(bindingContextKey{}).(string)
+	return binding, nil
+}
+
+// bindingWorkflow returns the binding of the workflow execution and the one of its activity
+func bindingWorkflow(ctx workflow.Context) ([]string, error) {
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{StartToCloseTimeout: time.Minute})
+	var binding string
+	err := workflow.ExecuteActivity(ctx, bindingActivity).Get(ctx, &binding)
+	info := workflow.GetInfo(ctx)
+	return []string{workflowBinding(info.Namespace, info.WorkflowExecution.ID), binding}, err
+}
+
+func Test_BindingPropagator(t *testing.T) {
+	for name, test := range map[string]struct {
+		propagators []workflow.ContextPropagator
+		bound       bool
+	}{
+		"with propagator":    {[]workflow.ContextPropagator{NewBindingPropagator()}, true},
+		"without propagator": {nil, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			testSuite := &testsuite.WorkflowTestSuite{}
+			env := testSuite.NewTestWorkflowEnvironment()
+			env.SetDataConverter(NewContextCryptDataConverter(
+				converter.GetDefaultDataConverter(),
+				ContextCryptDataConverterOptions{},
+			))
+			env.SetContextPropagators(test.propagators)
+			env.RegisterWorkflow(bindingWorkflow)
+			env.RegisterActivity(bindingActivity)
+
+			env.ExecuteWorkflow(bindingWorkflow)
+
+			require.True(t, env.IsWorkflowCompleted())
+			require.NoError(t, env.GetWorkflowError())
+			var bindings []string
+			require.NoError(t, env.GetWorkflowResult(&bindings))
+			if test.bound {
+				require.Equal(t, bindings[0], bindings[1])
+			} else {
+				require.Empty(t, bindings[1])
+			}
+		})
+	}
+}
+
+// parentWorkflow runs Workflow as a child workflow
+func parentWorkflow(ctx workflow.Context, name string) (string, error) {
+	ctx = workflow.WithChildOptions(ctx, workflow.ChildWorkflowOptions{WorkflowID: "child"})
+	var result string
+	err := workflow.ExecuteChildWorkflow(ctx, Workflow, name).Get(ctx, &result)
+	return result, err
+}
+
+func Test_ContextChildWorkflow(t *testing.T) {
+	for name, test := range map[string]struct {
+		propagators []workflow.ContextPropagator
+		err         bool
+	}{
+		"with propagator": {[]workflow.ContextPropagator{NewBindingPropagator()}, false},
+		// the child can't decrypt the input bound to its parent
+		"without propagator": {nil, true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			testSuite := &testsuite.WorkflowTestSuite{}
+			env := testSuite.NewTestWorkflowEnvironment()
+			env.SetDataConverter(NewContextCryptDataConverter(
+				converter.GetDefaultDataConverter(),
+				ContextCryptDataConverterOptions{},
+			))
+			env.SetContextPropagators(test.propagators)
+			env.RegisterWorkflow(parentWorkflow)
+			env.RegisterWorkflow(Workflow)
+			env.RegisterActivity(Activity)
+
+			env.ExecuteWorkflow(parentWorkflow, "Temporal")
+
+			require.True(t, env.IsWorkflowCompleted())
+			if test.err {
+				require.Error(t, env.GetWorkflowError())
+				require.Contains(t, env.GetWorkflowError().Error(), ErrPayloadBindingMismatch.Error())
+				return
+			}
+			require.NoError(t, env.GetWorkflowError())
+			var result string
+			require.NoError(t, env.GetWorkflowResult(&result))
+			require.Equal(t, "Hello Temporal!", result)
+		})
+	}
+}
+
+func Test_ContextDataConverter(t *testing.T) {
+	dc := NewContextCryptDataConverter(
+		converter.GetDefaultDataConverter(),
+		ContextCryptDataConverterOptions{},
+	)
+	boundDc := dc.WithContext(WithWorkflowBinding(context.Background(), "default", "workflow-1"))
+
+	payload, err := boundDc.ToPayload("Testing")
+	require.NoError(t, err)
+	require.Equal(t, "default/workflow-1", string(payload.GetMetadata()[MetadataEncryptionAAD]))
+
+	var result string
+	require.NoError(t, boundDc.FromPayload(clonePayload(t, payload), &result))
+	require.Equal(t, "Testing", result)
+
+	// An unbound converter can decrypt but not verify the execution.
+	require.NoError(t, dc.FromPayload(clonePayload(t, payload), &result))
+	require.Equal(t, "Testing", result)
+
+	// The plain converter decrypts bound payloads too.
+	require.NoError(t, NewCryptDataConverter(converter.GetDefaultDataConverter()).FromPayload(clonePayload(t, payload), &result))
+
+	otherDc := dc.WithContext(WithWorkflowBinding(context.Background(), "default", "workflow-2"))
+	err = otherDc.FromPayload(clonePayload(t, payload), &result)
+	require.ErrorIs(t, err, ErrPayloadBindingMismatch)
+}
+
+func Test_ContextDataConverter_Tampered(t *testing.T) {
+	dc := NewContextCryptDataConverter(
+		converter.GetDefaultDataConverter(),
+		ContextCryptDataConverterOptions{},
+	)
+	boundDc := dc.WithContext(WithWorkflowBinding(context.Background(), "default", "workflow-1"))
+	otherDc := dc.WithContext(WithWorkflowBinding(context.Background(), "default", "workflow-2"))
+
+	payload, err := boundDc.ToPayload("Testing")
+	require.NoError(t, err)
+
+	var result string
+
+	// Rewriting the binding to the target execution fails authentication.
+	rebound := clonePayload(t, payload)
+	rebound.Metadata[MetadataEncryptionAAD] = []byte("default/workflow-2")
+	require.ErrorIs(t, otherDc.FromPayload(rebound, &result), converter.ErrUnableToDecode)
+
+	// Stripping the binding fails authentication as well.
+	stripped := clonePayload(t, payload)
+	delete(stripped.Metadata, MetadataEncryptionAAD)
+	require.ErrorIs(t, otherDc.FromPayload(stripped, &result), converter.ErrUnableToDecode)
+}
+
+func Test_ContextDataConverter_RequireBinding(t *testing.T) {
+	unbound, err := NewCryptDataConverter(converter.GetDefaultDataConverter()).ToPayload("Testing")
+	require.NoError(t, err)
+
+	var result string
+	lenientDc := NewContextCryptDataConverter(
+		converter.GetDefaultDataConverter(),
+		ContextCryptDataConverterOptions{},
+	).WithContext(WithWorkflowBinding(context.Background(), "default", "workflow-1"))
+	require.NoError(t, lenientDc.FromPayload(clonePayload(t, unbound), &result))
+	require.Equal(t, "Testing", result)
+
+	strictDc := NewContextCryptDataConverter(
+		converter.GetDefaultDataConverter(),
+		ContextCryptDataConverterOptions{RequireBinding: true},
+	).WithContext(WithWorkflowBinding(context.Background(), "default", "workflow-1"))
+	require.ErrorIs(t, strictDc.FromPayload(clonePayload(t, unbound), &result), ErrPayloadNotBound)
+}
+
+func clonePayload(t *testing.T, payload *commonpb.Payload) *commonpb.Payload {
+	data, err := payload.Marshal()
+	require.NoError(t, err)
+	clone := &commonpb.Payload{}
+	require.NoError(t, clone.Unmarshal(data))
+	return clone
+}
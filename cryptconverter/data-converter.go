@@ -18,6 +18,9 @@ const (
 
 	// MetadataContentEncoding is "content-encoding"
 	MetadataContentEncoding = "content-encoding"
+
+	// MetadataEncryptionAAD is "encryption-aad"
+	MetadataEncryptionAAD = "encryption-aad"
 )
 
 // CryptDataConverter implements DataConverter using AES Crypt.
@@ -44,7 +47,7 @@ func NewCryptDataConverter(dataConverter converter.DataConverter) *CryptDataConv
 	}
 }
 
-func encrypt(plainData []byte, key []byte) ([]byte, error) {
+func encrypt(plainData []byte, key []byte, aad []byte) ([]byte, error) {
 	c, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -60,10 +63,10 @@ func encrypt(plainData []byte, key []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	return gcm.Seal(nonce, nonce, plainData, nil), nil
+	return gcm.Seal(nonce, nonce, plainData, aad), nil
 }
 
-func decrypt(encryptedData []byte, key []byte) ([]byte, error) {
+func decrypt(encryptedData []byte, key []byte, aad []byte) ([]byte, error) {
 	c, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -80,7 +83,7 @@ func decrypt(encryptedData []byte, key []byte) ([]byte, error) {
 	}
 
 	nonce, encryptedData := encryptedData[:nonceSize], encryptedData[nonceSize:]
-	return gcm.Open(nil, nonce, encryptedData, nil)
+	return gcm.Open(nil, nonce, encryptedData, aad)
 }
 
 // ToPayloads converts a list of values.
@@ -100,6 +103,12 @@ func (dc *CryptDataConverter) ToPayloads(values ...interface{}) (*commonpb.Paylo
 }
 
 func (dc *CryptDataConverter) EncryptPayload(payload *commonpb.Payload, keyId string, key []byte) error {
+	return dc.encryptPayload(payload, keyId, key, nil)
+}
+
+// encryptPayload encrypts the payload, authenticating aad alongside the data.
+// A non-empty aad is recorded in the payload metadata so it can be supplied again on decryption.
+func (dc *CryptDataConverter) encryptPayload(payload *commonpb.Payload, keyId string, key []byte, aad []byte) error {
 	metadata := payload.GetMetadata()
 	if metadata == nil {
 		return converter.ErrMetadataIsNotSet
@@ -112,8 +121,11 @@ func (dc *CryptDataConverter) EncryptPayload(payload *commonpb.Payload, keyId st
 	metadata[converter.MetadataEncoding] = []byte(converter.MetadataEncodingBinary)
 	metadata[MetadataContentEncoding] = encoding
 	metadata[MetadataEncryptionKeyId] = []byte(keyId)
+	if len(aad) > 0 {
+		metadata[MetadataEncryptionAAD] = aad
+	}
 
-	encryptedData, err := encrypt(payload.GetData(), key)
+	encryptedData, err := encrypt(payload.GetData(), key, aad)
 	if err != nil {
 		return fmt.Errorf("%w: %v", converter.ErrUnableToEncode, err)
 	}
@@ -172,12 +184,16 @@ func (dc *CryptDataConverter) DecryptPayload(payload *commonpb.Payload) error {
 		return fmt.Errorf("%w: %s", converter.ErrUnableToDecode, "no content encoding")
 	}
 
+	// Payloads encrypted without associated data have no AAD entry and decrypt with a nil AAD.
+	aad := metadata[MetadataEncryptionAAD]
+
 	metadata[converter.MetadataEncoding] = encoding
 	delete(metadata, MetadataContentEncoding)
 	delete(metadata, MetadataEncryptionKeyId)
+	delete(metadata, MetadataEncryptionAAD)
 
 	key := dc.getDecryptionKey(string(keyId))
-	decryptData, err := decrypt(payload.GetData(), key)
+	decryptData, err := decrypt(payload.GetData(), key, aad)
 	if err != nil {
 		return fmt.Errorf("%w: %v", converter.ErrUnableToDecode, err)
 	}
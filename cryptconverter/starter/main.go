@@ -15,8 +15,9 @@ func main() {
 	c, err := client.NewClient(client.Options{
 		// Set DataConverter here to ensure that workflow inputs and results are
 		// encrypted/decrypted as required.
-		DataConverter: cryptconverter.NewCryptDataConverter(
+		DataConverter: cryptconverter.NewContextCryptDataConverter(
 			converter.GetDefaultDataConverter(),
+			cryptconverter.ContextCryptDataConverterOptions{},
 		),
 	})
 	if err != nil {
@@ -29,8 +30,11 @@ func main() {
 		TaskQueue: "cryptconverter",
 	}
 
+	// Bind the workflow input to this workflow ID so it can't be replayed into another execution.
+	ctx := cryptconverter.WithWorkflowBinding(context.Background(), client.DefaultNamespace, workflowOptions.ID)
+
 	// The workflow input "My Secret Friend" will be encrypted by the DataConverter before being sent to Temporal
-	we, err := c.ExecuteWorkflow(context.Background(), workflowOptions, cryptconverter.Workflow, "My Secret Friend")
+	we, err := c.ExecuteWorkflow(ctx, workflowOptions, cryptconverter.Workflow, "My Secret Friend")
 	if err != nil {
 		log.Fatalln("Unable to execute workflow", err)
 	}
@@ -6,6 +6,7 @@ import (
 	"go.temporal.io/sdk/client"
 	"go.temporal.io/sdk/converter"
 	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
 
 	"github.com/temporalio/samples-go/cryptconverter"
 )
@@ -15,9 +16,14 @@ func main() {
 	c, err := client.NewClient(client.Options{
 		// Set DataConverter here so that workflow and activity inputs/results can
 		// be encrypted/decrypted as required.
-		DataConverter: cryptconverter.NewCryptDataConverter(
+		DataConverter: cryptconverter.NewContextCryptDataConverter(
 			converter.GetDefaultDataConverter(),
+			cryptconverter.ContextCryptDataConverterOptions{},
 		),
+		// Bind the payloads of the activities and child workflows to their workflow execution.
+		ContextPropagators: []workflow.ContextPropagator{
+			cryptconverter.NewBindingPropagator(),
+		},
 	})
 	if err != nil {
 		log.Fatalln("Unable to create client", err)
@@ -0,0 +1,122 @@
+package ctxpropagation
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/worker"
+)
+
+// ActivityInterceptor intercepts an activity execution. It must call next to execute the
+// activity, or return an error to reject the execution without running it.
+// The Go SDK used by this sample has no activity interceptors, so they are applied by
+// wrapping the activity function, see RegisterActivityWithInterceptors.
+type ActivityInterceptor func(ctx context.Context, activityType string, next func(ctx context.Context) error) error
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// RegisterActivityWithInterceptors registers the activity function under its usual name, wrapped so
+// that every execution goes through the interceptors, the first one being the outermost.
+// Activities that don't take a context.Context are registered as-is.
+func RegisterActivityWithInterceptors(registry worker.ActivityRegistry, activityFn interface{}, interceptors ...ActivityInterceptor) {
+	name := functionName(activityFn)
+	registry.RegisterActivityWithOptions(
+		interceptActivity(name, activityFn, interceptors),
+		activity.RegisterOptions{Name: name},
+	)
+}
+
+// RegisterTracedActivity registers the activity function so that each of its executions is
+// recorded in a RunActivity span, a child of the span that scheduled the activity.
+func RegisterTracedActivity(registry worker.ActivityRegistry, provider trace.TracerProvider, activityFn interface{}) {
+	RegisterActivityWithInterceptors(registry, activityFn, NewTracingActivityInterceptor(provider))
+}
+
+// NewTracingActivityInterceptor returns an activity interceptor that records every execution in a
+// RunActivity span
+func NewTracingActivityInterceptor(provider trace.TracerProvider) ActivityInterceptor {
+	tracer := provider.Tracer(tracerName)
+	return func(ctx context.Context, activityType string, next func(ctx context.Context) error) error {
+		info := activity.GetInfo(ctx)
+		ctx, span := tracer.Start(ctx, "RunActivity:"+activityType, trace.WithAttributes(
+			workflowIDAttribute.String(info.WorkflowExecution.ID),
+			runIDAttribute.String(info.WorkflowExecution.RunID),
+			activityIDAttribute.String(info.ActivityID),
+		))
+		defer span.End()
+
+		err := next(ctx)
+		if err != nil {
+			recordError(span, err)
+		}
+		return err
+	}
+}
+
+// functionName returns the name Temporal registers a function under
+func functionName(fn interface{}) string {
+	fullName := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	elements := strings.Split(fullName, ".")
+	return strings.TrimSuffix(elements[len(elements)-1], "-fm")
+}
+
+func interceptActivity(name string, activityFn interface{}, interceptors []ActivityInterceptor) interface{} {
+	fn := reflect.ValueOf(activityFn)
+	fnType := fn.Type()
+	if len(interceptors) == 0 || fnType.NumIn() == 0 || fnType.In(0) != contextType {
+		return activityFn
+	}
+
+	return reflect.MakeFunc(fnType, func(args []reflect.Value) []reflect.Value {
+		var results []reflect.Value
+		execute := func(ctx context.Context) error {
+			args[0] = reflect.ValueOf(ctx)
+			if fnType.IsVariadic() {
+				results = fn.CallSlice(args)
+			} else {
+				results = fn.Call(args)
+			}
+			return resultError(results)
+		}
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], execute
+			execute = func(ctx context.Context) error {
+				return interceptor(ctx, name, next)
+			}
+		}
+
+		err := execute(args[0].Interface().(context.Context))
+		if results == nil {
+			// The activity was rejected, return zero values along with the error.
+			results = make([]reflect.Value, fnType.NumOut())
+			for i := range results {
+				results[i] = reflect.Zero(fnType.Out(i))
+			}
+		}
+		if last := len(results) - 1; last >= 0 && fnType.Out(last) == errorType {
+			results[last] = reflect.Zero(errorType)
+			if err != nil {
+				results[last] = reflect.ValueOf(&err).Elem()
+			}
+		}
+		return results
+	}).Interface()
+}
+
+// resultError returns the trailing error result of a function call, if any
+func resultError(results []reflect.Value) error {
+	if len(results) == 0 {
+		return nil
+	}
+	if last := results[len(results)-1]; last.Type() == errorType && !last.IsNil() {
+		return last.Interface().(error)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package ctxpropagation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/workflow"
+)
+
+type (
+	// baggageContextKey is the key used to store Baggage in the Context object
+	baggageContextKey struct{}
+
+	// Baggage is a set of string key-value pairs propagated across workflows and activities
+	Baggage map[string]string
+
+	// BaggagePropagatorOptions configures the baggage propagator
+	BaggagePropagatorOptions struct {
+		// AllowedKeys lists the keys that are forwarded to and accepted from headers.
+		// Empty allows all keys.
+		AllowedKeys []string
+		// MaxSize is the maximum total size in bytes of all keys and values.
+		// Default: DefaultMaxBaggageSize
+		MaxSize int
+	}
+
+	// baggagePropagator implements a context propagator for Baggage
+	baggagePropagator struct {
+		allowedKeys map[string]bool
+		maxSize     int
+	}
+)
+
+// DefaultMaxBaggageSize is the default limit of the total baggage size in bytes
+const DefaultMaxBaggageSize = 8192
+
+// baggageHeaderKey is the key used by the baggage propagator to pass values through the
+// Temporal server headers
+const baggageHeaderKey = "baggage"
+
+// ErrBaggageTooLarge is returned when the propagated baggage exceeds the configured size limit
+var ErrBaggageTooLarge = errors.New("baggage exceeds size limit")
+
+// NewBaggagePropagator returns a context propagator that propagates Baggage across a workflow
+func NewBaggagePropagator(options BaggagePropagatorOptions) workflow.ContextPropagator {
+	p := &baggagePropagator{maxSize: options.MaxSize}
+	if p.maxSize <= 0 {
+		p.maxSize = DefaultMaxBaggageSize
+	}
+	if len(options.AllowedKeys) > 0 {
+		p.allowedKeys = make(map[string]bool, len(options.AllowedKeys))
+		for _, key := range options.AllowedKeys {
+			p.allowedKeys[key] = true
+		}
+	}
+	return p
+}
+
+// GetBaggage returns the baggage value stored under key in ctx
+func GetBaggage(ctx context.Context, key string) (string, bool) {
+	return baggageFromValue(ctx.Value(baggageContextKey{})).get(key)
+}
+
+// SetBaggage returns a copy of ctx with the baggage value stored under key
+func SetBaggage(ctx context.Context, key string, value string) context.Context {
+	return context.WithValue(ctx, baggageContextKey{}, baggageFromValue(ctx.Value(baggageContextKey{})).with(key, value))
+}
+
+// BaggageFromContext returns a copy of all baggage stored in ctx
+func BaggageFromContext(ctx context.Context) Baggage {
+	return baggageFromValue(ctx.Value(baggageContextKey{})).copy()
+}
+
+// GetWorkflowBaggage returns the baggage value stored under key in the workflow ctx
+func GetWorkflowBaggage(ctx workflow.Context, key string) (string, bool) {
+	return baggageFromValue(ctx.Value(baggageContextKey{})).get(key)
+}
+
+// SetWorkflowBaggage returns a copy of the workflow ctx with the baggage value stored under key
+func SetWorkflowBaggage(ctx workflow.Context, key string, value string) workflow.Context {
+	return workflow.WithValue(ctx, baggageContextKey{}, baggageFromValue(ctx.Value(baggageContextKey{})).with(key, value))
+}
+
+// BaggageFromWorkflowContext returns a copy of all baggage stored in the workflow ctx
+func BaggageFromWorkflowContext(ctx workflow.Context) Baggage {
+	return baggageFromValue(ctx.Value(baggageContextKey{})).copy()
+}
+
+func baggageFromValue(value interface{}) Baggage {
+	if b, ok := value.(Baggage); ok {
+		return b
+	}
+	return nil
+}
+
+func (b Baggage) get(key string) (string, bool) {
+	value, ok := b[key]
+	return value, ok
+}
+
+// with returns a copy of b with key set, Baggage stored in a context is never modified.
+func (b Baggage) with(key string, value string) Baggage {
+	result := make(Baggage, len(b)+1)
+	for k, v := range b {
+		result[k] = v
+	}
+	result[key] = value
+	return result
+}
+
+func (b Baggage) copy() Baggage {
+	result := make(Baggage, len(b))
+	for k, v := range b {
+		result[k] = v
+	}
+	return result
+}
+
+func (b Baggage) size() int {
+	size := 0
+	for k, v := range b {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+// filter drops the keys that are not allowed and checks the size limit
+func (s *baggagePropagator) filter(baggage Baggage) (Baggage, error) {
+	result := make(Baggage, len(baggage))
+	for k, v := range baggage {
+		if s.allowedKeys == nil || s.allowedKeys[k] {
+			result[k] = v
+		}
+	}
+	if size := result.size(); size > s.maxSize {
+		return nil, fmt.Errorf("%w: %d > %d bytes", ErrBaggageTooLarge, size, s.maxSize)
+	}
+	return result, nil
+}
+
+func (s *baggagePropagator) inject(value interface{}, writer workflow.HeaderWriter) error {
+	baggage, err := s.filter(baggageFromValue(value))
+	if err != nil {
+		return err
+	}
+	if len(baggage) == 0 {
+		return nil
+	}
+	payload, err := converter.GetDefaultDataConverter().ToPayload(baggage)
+	if err != nil {
+		return err
+	}
+	writer.Set(baggageHeaderKey, payload)
+	return nil
+}
+
+func (s *baggagePropagator) extract(reader workflow.HeaderReader) (Baggage, error) {
+	value, ok := reader.Get(baggageHeaderKey)
+	if !ok {
+		return nil, nil
+	}
+	var baggage Baggage
+	if err := converter.GetDefaultDataConverter().FromPayload(value, &baggage); err != nil {
+		return nil, err
+	}
+	return s.filter(baggage)
+}
+
+// Inject injects baggage from context into headers for propagation
+func (s *baggagePropagator) Inject(ctx context.Context, writer workflow.HeaderWriter) error {
+	return s.inject(ctx.Value(baggageContextKey{}), writer)
+}
+
+// InjectFromWorkflow injects baggage from context into headers for propagation
+func (s *baggagePropagator) InjectFromWorkflow(ctx workflow.Context, writer workflow.HeaderWriter) error {
+	return s.inject(ctx.Value(baggageContextKey{}), writer)
+}
+
+// Extract extracts baggage from headers and puts it into context
+func (s *baggagePropagator) Extract(ctx context.Context, reader workflow.HeaderReader) (context.Context, error) {
+	baggage, err := s.extract(reader)
+	if err != nil || len(baggage) == 0 {
+		return ctx, err
+	}
+	return context.WithValue(ctx, baggageContextKey{}, baggage), nil
+}
+
+// ExtractToWorkflow extracts baggage from headers and puts it into context
+func (s *baggagePropagator) ExtractToWorkflow(ctx workflow.Context, reader workflow.HeaderReader) (workflow.Context, error) {
+	baggage, err := s.extract(reader)
+	if err != nil || len(baggage) == 0 {
+		return ctx, err
+	}
+	return workflow.WithValue(ctx, baggageContextKey{}, baggage), nil
+}
@@ -0,0 +1,185 @@
+package ctxpropagation
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+type (
+	// claimsContextKey is the key used to store the claims in the Context object
+	claimsContextKey struct{}
+
+	// Claims holds the identity of the caller, e.g. subject, email or roles
+	Claims map[string]string
+
+	// claimsValue is stored in the Context object, err is set when the propagated claims were rejected
+	claimsValue struct {
+		claims Claims
+		err    error
+	}
+
+	// signedClaims is the content of the claims header
+	signedClaims struct {
+		Claims    Claims `json:"claims"`
+		Signature []byte `json:"signature"`
+	}
+
+	// claimsPropagator propagates Claims signed with HMAC-SHA256
+	claimsPropagator struct {
+		key []byte
+	}
+)
+
+// claimsHeaderKey is the key used by the claims propagator to pass the signed claims through the
+// Temporal server headers
+const claimsHeaderKey = "claims"
+
+// UnauthorizedErrorType is the type of the application error returned for rejected activities
+const UnauthorizedErrorType = "Unauthorized"
+
+var (
+	// ErrClaimsMissing is returned when no claims were propagated
+	ErrClaimsMissing = errors.New("claims are missing")
+	// ErrClaimsInvalidSignature is returned when the propagated claims were tampered with
+	ErrClaimsInvalidSignature = errors.New("claims signature is invalid")
+)
+
+// NewClaimsPropagator returns a context propagator that propagates Claims across a workflow.
+// Claims are signed with key on inject and verified on extract, so all clients and workers need the
+// same key. Claims with an invalid signature are dropped and reported by ClaimsFromContext.
+func NewClaimsPropagator(key []byte) workflow.ContextPropagator {
+	return &claimsPropagator{key: key}
+}
+
+// WithClaims returns a copy of ctx holding the claims, e.g. the identity of the user that sent the
+// HTTP request which starts a workflow
+func WithClaims(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claimsValue{claims: claims.copy()})
+}
+
+// ClaimsFromContext returns the claims stored in ctx, or ErrClaimsMissing/ErrClaimsInvalidSignature
+func ClaimsFromContext(ctx context.Context) (Claims, error) {
+	return claimsFromValue(ctx.Value(claimsContextKey{}))
+}
+
+// ClaimsFromWorkflowContext returns the claims stored in the workflow ctx, or
+// ErrClaimsMissing/ErrClaimsInvalidSignature
+func ClaimsFromWorkflowContext(ctx workflow.Context) (Claims, error) {
+	return claimsFromValue(ctx.Value(claimsContextKey{}))
+}
+
+// NewClaimsActivityInterceptor returns an activity interceptor that rejects the execution with a
+// non retryable UnauthorizedErrorType error unless valid claims containing every one of
+// requiredClaims were propagated to the activity
+func NewClaimsActivityInterceptor(requiredClaims ...string) ActivityInterceptor {
+	return func(ctx context.Context, activityType string, next func(ctx context.Context) error) error {
+		claims, err := ClaimsFromContext(ctx)
+		if err != nil {
+			return temporal.NewNonRetryableApplicationError(fmt.Sprintf("activity %v unauthorized", activityType), UnauthorizedErrorType, err)
+		}
+		for _, name := range requiredClaims {
+			if _, ok := claims[name]; !ok {
+				return temporal.NewNonRetryableApplicationError(fmt.Sprintf("activity %v unauthorized: claim %q is missing", activityType, name), UnauthorizedErrorType, ErrClaimsMissing)
+			}
+		}
+		return next(ctx)
+	}
+}
+
+func claimsFromValue(value interface{}) (Claims, error) {
+	v, ok := value.(claimsValue)
+	if !ok {
+		return nil, ErrClaimsMissing
+	}
+	if v.err != nil {
+		return nil, v.err
+	}
+	return v.claims.copy(), nil
+}
+
+func (c Claims) copy() Claims {
+	result := make(Claims, len(c))
+	for k, v := range c {
+		result[k] = v
+	}
+	return result
+}
+
+// sign returns the HMAC-SHA256 of the claims, json.Marshal sorts the keys so the result is stable
+func (s *claimsPropagator) sign(claims Claims) ([]byte, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, s.key)
+	_, _ = mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+func (s *claimsPropagator) inject(value interface{}, writer workflow.HeaderWriter) error {
+	v, ok := value.(claimsValue)
+	if !ok || v.err != nil {
+		return nil
+	}
+	signature, err := s.sign(v.claims)
+	if err != nil {
+		return err
+	}
+	payload, err := converter.GetDefaultDataConverter().ToPayload(signedClaims{Claims: v.claims, Signature: signature})
+	if err != nil {
+		return err
+	}
+	writer.Set(claimsHeaderKey, payload)
+	return nil
+}
+
+// extract returns the verified claims, or a value holding the reason they were rejected
+func (s *claimsPropagator) extract(reader workflow.HeaderReader) (claimsValue, bool) {
+	payload, ok := reader.Get(claimsHeaderKey)
+	if !ok {
+		return claimsValue{}, false
+	}
+	var signed signedClaims
+	if err := converter.GetDefaultDataConverter().FromPayload(payload, &signed); err != nil {
+		return claimsValue{err: fmt.Errorf("%w: %v", ErrClaimsInvalidSignature, err)}, true
+	}
+	expected, err := s.sign(signed.Claims)
+	if err != nil || !hmac.Equal(expected, signed.Signature) {
+		return claimsValue{err: ErrClaimsInvalidSignature}, true
+	}
+	return claimsValue{claims: signed.Claims}, true
+}
+
+// Inject injects the signed claims from context into headers for propagation
+func (s *claimsPropagator) Inject(ctx context.Context, writer workflow.HeaderWriter) error {
+	return s.inject(ctx.Value(claimsContextKey{}), writer)
+}
+
+// InjectFromWorkflow injects the signed claims from context into headers for propagation
+func (s *claimsPropagator) InjectFromWorkflow(ctx workflow.Context, writer workflow.HeaderWriter) error {
+	return s.inject(ctx.Value(claimsContextKey{}), writer)
+}
+
+// Extract verifies the claims from headers and puts them into context
+func (s *claimsPropagator) Extract(ctx context.Context, reader workflow.HeaderReader) (context.Context, error) {
+	if value, ok := s.extract(reader); ok {
+		ctx = context.WithValue(ctx, claimsContextKey{}, value)
+	}
+	return ctx, nil
+}
+
+// ExtractToWorkflow verifies the claims from headers and puts them into context
+func (s *claimsPropagator) ExtractToWorkflow(ctx workflow.Context, reader workflow.HeaderReader) (workflow.Context, error) {
+	if value, ok := s.extract(reader); ok {
+		ctx = workflow.WithValue(ctx, claimsContextKey{}, value)
+	}
+	return ctx, nil
+}
@@ -0,0 +1,140 @@
+package ctxpropagation
+
+import (
+	"context"
+	"reflect"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.temporal.io/sdk/interceptors"
+	"go.temporal.io/sdk/workflow"
+)
+
+type (
+	// tracingInterceptor creates OpenTelemetry spans for workflow executions and the calls they make
+	tracingInterceptor struct {
+		provider trace.TracerProvider
+	}
+
+	tracingInboundInterceptor struct {
+		interceptors.WorkflowInboundCallsInterceptorBase
+		provider trace.TracerProvider
+		info     *workflow.Info
+	}
+
+	tracingOutboundInterceptor struct {
+		interceptors.WorkflowOutboundCallsInterceptorBase
+		tracer trace.Tracer
+	}
+)
+
+// tracerName is the name of the OpenTelemetry tracer used by the interceptors
+const tracerName = "github.com/temporalio/samples-go/ctxpropagation"
+
+// Span attribute keys
+const (
+	workflowIDAttribute = attribute.Key("temporal.workflow_id")
+	runIDAttribute      = attribute.Key("temporal.run_id")
+	activityIDAttribute = attribute.Key("temporal.activity_id")
+)
+
+// NewTracingInterceptor returns a workflow interceptor that records workflow executions, and the
+// activities, child workflows, external signals and queries they handle, as OpenTelemetry spans.
+// Use it together with NewTracePropagator so spans are linked across workers.
+// Spans are created with StartWorkflowSpan, so they are not duplicated when a workflow is replayed.
+func NewTracingInterceptor(provider trace.TracerProvider) interceptors.WorkflowInterceptor {
+	return &tracingInterceptor{provider: provider}
+}
+
+// callTraced calls fn and records its trailing error result, if any, on span
+func callTraced(span trace.Span, fn reflect.Value, args []reflect.Value) []reflect.Value {
+	var results []reflect.Value
+	if fn.Type().IsVariadic() {
+		results = fn.CallSlice(args)
+	} else {
+		results = fn.Call(args)
+	}
+	if err := resultError(results); err != nil {
+		recordError(span, err)
+	}
+	return results
+}
+
+func recordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+func (t *tracingInterceptor) InterceptWorkflow(info *workflow.Info, next interceptors.WorkflowInboundCallsInterceptor) interceptors.WorkflowInboundCallsInterceptor {
+	result := &tracingInboundInterceptor{provider: t.provider, info: info}
+	result.Next = next
+	return result
+}
+
+func (t *tracingInboundInterceptor) Init(outbound interceptors.WorkflowOutboundCallsInterceptor) error {
+	result := &tracingOutboundInterceptor{tracer: t.provider.Tracer(tracerName)}
+	result.Next = outbound
+	return t.Next.Init(result)
+}
+
+func (t *tracingInboundInterceptor) ExecuteWorkflow(ctx workflow.Context, workflowType string, args ...interface{}) []interface{} {
+	ctx = WithWorkflowTracer(ctx, t.provider)
+	ctx, span := StartWorkflowSpan(ctx, "RunWorkflow:"+workflowType, trace.WithAttributes(
+		workflowIDAttribute.String(t.info.WorkflowExecution.ID),
+		runIDAttribute.String(t.info.WorkflowExecution.RunID),
+	))
+	defer span.End()
+
+	results := t.Next.ExecuteWorkflow(ctx, workflowType, args...)
+	if len(results) > 0 {
+		if err, ok := results[len(results)-1].(error); ok && err != nil {
+			recordError(span, err)
+		}
+	}
+	return results
+}
+
+func (t *tracingOutboundInterceptor) ExecuteActivity(ctx workflow.Context, activityType string, args ...interface{}) workflow.Future {
+	ctx, span := StartWorkflowSpan(ctx, "StartActivity:"+activityType)
+	defer span.End()
+	return t.Next.ExecuteActivity(ctx, activityType, args...)
+}
+
+func (t *tracingOutboundInterceptor) ExecuteLocalActivity(ctx workflow.Context, activityType string, args ...interface{}) workflow.Future {
+	ctx, span := StartWorkflowSpan(ctx, "StartLocalActivity:"+activityType)
+	defer span.End()
+	return t.Next.ExecuteLocalActivity(ctx, activityType, args...)
+}
+
+func (t *tracingOutboundInterceptor) ExecuteChildWorkflow(ctx workflow.Context, childWorkflowType string, args ...interface{}) workflow.ChildWorkflowFuture {
+	ctx, span := StartWorkflowSpan(ctx, "StartChildWorkflow:"+childWorkflowType)
+	defer span.End()
+	return t.Next.ExecuteChildWorkflow(ctx, childWorkflowType, args...)
+}
+
+func (t *tracingOutboundInterceptor) SignalExternalWorkflow(ctx workflow.Context, workflowID, runID, signalName string, arg interface{}) workflow.Future {
+	ctx, span := StartWorkflowSpan(ctx, "SignalExternalWorkflow:"+signalName, trace.WithAttributes(
+		workflowIDAttribute.String(workflowID),
+		runIDAttribute.String(runID),
+	))
+	defer span.End()
+	return t.Next.SignalExternalWorkflow(ctx, workflowID, runID, signalName, arg)
+}
+
+// SetQueryHandler wraps the handler so that every query is recorded in a HandleQuery span.
+// Queries are not part of the workflow history, so these spans get random IDs and are always exported.
+func (t *tracingOutboundInterceptor) SetQueryHandler(ctx workflow.Context, queryType string, handler interface{}) error {
+	fn := reflect.ValueOf(handler)
+	if fn.Kind() != reflect.Func {
+		return t.Next.SetQueryHandler(ctx, queryType, handler)
+	}
+
+	traced := reflect.MakeFunc(fn.Type(), func(args []reflect.Value) []reflect.Value {
+		parent := trace.ContextWithSpanContext(context.Background(), spanContextFromWorkflow(ctx))
+		_, span := t.tracer.Start(parent, "HandleQuery:"+queryType)
+		defer span.End()
+		return callTraced(span, fn, args)
+	})
+	return t.Next.SetQueryHandler(ctx, queryType, traced.Interface())
+}
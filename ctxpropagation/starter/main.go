@@ -4,7 +4,6 @@ import (
 	"context"
 	"log"
 
-	"github.com/opentracing/opentracing-go"
 	"github.com/pborman/uuid"
 	"go.temporal.io/sdk/client"
 	"go.temporal.io/sdk/workflow"
@@ -12,16 +11,25 @@ import (
 	"github.com/temporalio/samples-go/ctxpropagation"
 )
 
+// claimsKey signs the propagated claims. Load it from a secret store in a real application.
+var claimsKey = []byte("ctx-propagation-sample-key")
+
 func main() {
-	// Set tracer which will be returned by opentracing.GlobalTracer().
-	closer := ctxpropagation.SetJaegerGlobalTracer()
-	defer func() { _ = closer.Close() }()
+	// Set the global OpenTelemetry TracerProvider which prints spans to stdout.
+	tp := ctxpropagation.SetStdoutGlobalTracerProvider()
+	defer func() { _ = tp.Shutdown(context.Background()) }()
 
 	// The client is a heavyweight object that should be created once per process.
 	c, err := client.NewClient(client.Options{
-		HostPort:           client.DefaultHostPort,
-		Tracer:             opentracing.GlobalTracer(),
-		ContextPropagators: []workflow.ContextPropagator{ctxpropagation.NewContextPropagator()},
+		HostPort: client.DefaultHostPort,
+		ContextPropagators: []workflow.ContextPropagator{
+			ctxpropagation.NewContextPropagator(),
+			ctxpropagation.NewBaggagePropagator(ctxpropagation.BaggagePropagatorOptions{
+				AllowedKeys: []string{"tenant", "request-id"},
+			}),
+			ctxpropagation.NewTracePropagator(),
+			ctxpropagation.NewClaimsPropagator(claimsKey),
+		},
 	})
 	if err != nil {
 		log.Fatalln("Unable to create client", err)
@@ -36,8 +44,15 @@ func main() {
 
 	ctx := context.Background()
 	ctx = context.WithValue(ctx, ctxpropagation.PropagateKey, &ctxpropagation.Values{Key: "test", Value: "tested"})
+	ctx = ctxpropagation.SetBaggage(ctx, "tenant", "samples")
+	ctx = ctxpropagation.SetBaggage(ctx, "request-id", uuid.New())
+	// In an HTTP handler the claims would come from the authenticated request, e.g. a verified JWT.
+	ctx = ctxpropagation.WithClaims(ctx, ctxpropagation.Claims{"sub": "sample-user", "role": "admin"})
 
+	// The trace propagator passes this span to the workflow as the parent of its RunWorkflow span.
+	ctx, span := tp.Tracer("ctx-propagation-starter").Start(ctx, "StartWorkflow:CtxPropWorkflow")
 	we, err := c.ExecuteWorkflow(ctx, workflowOptions, ctxpropagation.CtxPropWorkflow)
+	span.End()
 	if err != nil {
 		log.Fatalln("Unable to execute workflow", err)
 	}
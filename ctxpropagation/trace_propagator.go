@@ -0,0 +1,116 @@
+package ctxpropagation
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/workflow"
+)
+
+type (
+	// spanContextKey is the key used to store the current trace.SpanContext in the workflow.Context
+	spanContextKey struct{}
+
+	// tracePropagator propagates the W3C trace context through the Temporal headers
+	tracePropagator struct {
+		propagator propagation.TextMapPropagator
+	}
+
+	// textMapCarrier implements propagation.TextMapCarrier on top of a map
+	textMapCarrier map[string]string
+)
+
+// traceHeaderKey is the key used by the trace propagator to pass the W3C traceparent and
+// tracestate through the Temporal server headers
+const traceHeaderKey = "_trace-context"
+
+// NewTracePropagator returns a context propagator that propagates the OpenTelemetry span context
+// as W3C traceparent/tracestate across workflows, child workflows and activities
+func NewTracePropagator() workflow.ContextPropagator {
+	return &tracePropagator{propagator: propagation.TraceContext{}}
+}
+
+func (c textMapCarrier) Get(key string) string {
+	return c[key]
+}
+
+func (c textMapCarrier) Set(key string, value string) {
+	c[key] = value
+}
+
+func (c textMapCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// spanContextFromWorkflow returns the span context of the current workflow span
+func spanContextFromWorkflow(ctx workflow.Context) trace.SpanContext {
+	if sc, ok := ctx.Value(spanContextKey{}).(trace.SpanContext); ok {
+		return sc
+	}
+	return trace.SpanContext{}
+}
+
+// withWorkflowSpanContext returns a copy of the workflow ctx with sc as the current span context
+func withWorkflowSpanContext(ctx workflow.Context, sc trace.SpanContext) workflow.Context {
+	return workflow.WithValue(ctx, spanContextKey{}, sc)
+}
+
+func (s *tracePropagator) inject(ctx context.Context, writer workflow.HeaderWriter) error {
+	carrier := textMapCarrier{}
+	s.propagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	payload, err := converter.GetDefaultDataConverter().ToPayload(carrier)
+	if err != nil {
+		return err
+	}
+	writer.Set(traceHeaderKey, payload)
+	return nil
+}
+
+func (s *tracePropagator) extract(reader workflow.HeaderReader) (trace.SpanContext, error) {
+	value, ok := reader.Get(traceHeaderKey)
+	if !ok {
+		return trace.SpanContext{}, nil
+	}
+	carrier := textMapCarrier{}
+	if err := converter.GetDefaultDataConverter().FromPayload(value, &carrier); err != nil {
+		return trace.SpanContext{}, err
+	}
+	return trace.SpanContextFromContext(s.propagator.Extract(context.Background(), carrier)), nil
+}
+
+// Inject injects the span context from context into headers for propagation
+func (s *tracePropagator) Inject(ctx context.Context, writer workflow.HeaderWriter) error {
+	return s.inject(ctx, writer)
+}
+
+// InjectFromWorkflow injects the span context from context into headers for propagation
+func (s *tracePropagator) InjectFromWorkflow(ctx workflow.Context, writer workflow.HeaderWriter) error {
+	return s.inject(trace.ContextWithSpanContext(context.Background(), spanContextFromWorkflow(ctx)), writer)
+}
+
+// Extract extracts the span context from headers and puts it into context
+func (s *tracePropagator) Extract(ctx context.Context, reader workflow.HeaderReader) (context.Context, error) {
+	sc, err := s.extract(reader)
+	if err != nil || !sc.IsValid() {
+		return ctx, err
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc), nil
+}
+
+// ExtractToWorkflow extracts the span context from headers and puts it into context
+func (s *tracePropagator) ExtractToWorkflow(ctx workflow.Context, reader workflow.HeaderReader) (workflow.Context, error) {
+	sc, err := s.extract(reader)
+	if err != nil || !sc.IsValid() {
+		return ctx, err
+	}
+	return withWorkflowSpanContext(ctx, sc), nil
+}
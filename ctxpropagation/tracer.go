@@ -1,31 +1,44 @@
 package ctxpropagation
 
 import (
-	"io"
-
-	"github.com/opentracing/opentracing-go"
-	"github.com/uber/jaeger-client-go"
-	"github.com/uber/jaeger-client-go/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
 )
 
-func SetJaegerGlobalTracer() io.Closer {
-	cfg := config.Configuration{
-		ServiceName: "ctx-propogation-sample",
-		Sampler: &config.SamplerConfig{
-			Type:  jaeger.SamplerTypeConst,
-			Param: 1,
-		},
-		Reporter: &config.ReporterConfig{
-			LogSpans: true,
-		},
-	}
-	tracer, closer, err := cfg.NewTracer(
-		config.Logger(jaeger.StdLogger),
+const serviceName = "ctx-propagation-sample"
+
+// NewTracerProvider returns a TracerProvider that synchronously exports every span to exporter.
+func NewTracerProvider(exporter sdktrace.SpanExporter) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithIDGenerator(NewWorkflowIDGenerator()),
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
 	)
+}
+
+// NewInMemoryTracerProvider returns a TracerProvider together with the in-memory exporter
+// collecting its spans, to be used in tests.
+func NewInMemoryTracerProvider() (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	return NewTracerProvider(exporter), exporter
+}
+
+// SetStdoutGlobalTracerProvider registers a TracerProvider printing spans to stdout as the global
+// OpenTelemetry TracerProvider. Call Shutdown on the result to flush spans before exiting.
+func SetStdoutGlobalTracerProvider() *sdktrace.TracerProvider {
+	exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
 	if err != nil {
 		panic(err)
 	}
-	opentracing.SetGlobalTracer(tracer)
+	tp := NewTracerProvider(exporter)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
 
-	return closer
+	return tp
 }
@@ -1,26 +1,36 @@
 package main
 
 import (
+	"context"
 	"log"
 
-	"github.com/opentracing/opentracing-go"
 	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/interceptors"
 	"go.temporal.io/sdk/worker"
 	"go.temporal.io/sdk/workflow"
 
 	"github.com/temporalio/samples-go/ctxpropagation"
 )
 
+// claimsKey signs the propagated claims. Load it from a secret store in a real application.
+var claimsKey = []byte("ctx-propagation-sample-key")
+
 func main() {
-	// Set tracer which will be returned by opentracing.GlobalTracer().
-	closer := ctxpropagation.SetJaegerGlobalTracer()
-	defer func() { _ = closer.Close() }()
+	// Set the global OpenTelemetry TracerProvider which prints spans to stdout.
+	tp := ctxpropagation.SetStdoutGlobalTracerProvider()
+	defer func() { _ = tp.Shutdown(context.Background()) }()
 
 	// The client and worker are heavyweight objects that should be created once per process.
 	c, err := client.NewClient(client.Options{
-		HostPort:           client.DefaultHostPort,
-		ContextPropagators: []workflow.ContextPropagator{ctxpropagation.NewContextPropagator()},
-		Tracer:             opentracing.GlobalTracer(),
+		HostPort: client.DefaultHostPort,
+		ContextPropagators: []workflow.ContextPropagator{
+			ctxpropagation.NewContextPropagator(),
+			ctxpropagation.NewBaggagePropagator(ctxpropagation.BaggagePropagatorOptions{
+				AllowedKeys: []string{"tenant", "request-id"},
+			}),
+			ctxpropagation.NewTracePropagator(),
+			ctxpropagation.NewClaimsPropagator(claimsKey),
+		},
 	})
 	if err != nil {
 		log.Fatalln("Unable to create client", err)
@@ -29,10 +39,17 @@ func main() {
 
 	w := worker.New(c, "ctx-propagation", worker.Options{
 		EnableLoggingInReplay: true,
+		WorkflowInterceptorChainFactories: []interceptors.WorkflowInterceptor{
+			ctxpropagation.NewTracingInterceptor(tp),
+		},
 	})
 
 	w.RegisterWorkflow(ctxpropagation.CtxPropWorkflow)
-	w.RegisterActivity(ctxpropagation.SampleActivity)
+	ctxpropagation.RegisterActivityWithInterceptors(w, ctxpropagation.SampleActivity,
+		ctxpropagation.NewTracingActivityInterceptor(tp),
+		// Reject activities that were not started on behalf of an authenticated user.
+		ctxpropagation.NewClaimsActivityInterceptor("sub"),
+	)
 
 	err = w.Run(worker.InterruptCh())
 	if err != nil {
@@ -20,6 +20,10 @@ func CtxPropWorkflow(ctx workflow.Context) (err error) {
 		workflow.GetLogger(ctx).Info("custom context propagated to workflow", vals.Key, vals.Value)
 	}
 
+	if tenant, ok := GetWorkflowBaggage(ctx, "tenant"); ok {
+		workflow.GetLogger(ctx).Info("baggage propagated to workflow", "tenant", tenant)
+	}
+
 	var values Values
 	if err = workflow.ExecuteActivity(ctx, SampleActivity).Get(ctx, &values); err != nil {
 		workflow.GetLogger(ctx).Error("Workflow failed.", "Error", err)
@@ -2,13 +2,23 @@ package ctxpropagation
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	commonpb "go.temporal.io/api/common/v1"
+	enumspb "go.temporal.io/api/enums/v1"
+	historypb "go.temporal.io/api/history/v1"
+	taskqueuepb "go.temporal.io/api/taskqueue/v1"
 	"go.temporal.io/sdk/activity"
 	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/interceptors"
+	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
 	"go.temporal.io/sdk/workflow"
 )
 
@@ -52,3 +62,320 @@ func (s *UnitTestSuite) Test_CtxPropWorkflow() {
 	s.Equal("some key", pv.Key)
 	s.Equal("some value", pv.Value)
 }
+
+func (s *UnitTestSuite) Test_BaggagePropagator() {
+	env := s.NewTestWorkflowEnvironment()
+	payload, err := converter.GetDefaultDataConverter().ToPayload(Baggage{"tenant": "acme", "user": "bob", "secret": "s3cr3t"})
+	s.NoError(err)
+	env.SetHeader(&commonpb.Header{
+		Fields: map[string]*commonpb.Payload{
+			baggageHeaderKey: payload,
+		},
+	})
+	env.SetContextPropagators([]workflow.ContextPropagator{
+		NewBaggagePropagator(BaggagePropagatorOptions{AllowedKeys: []string{"tenant", "user"}}),
+	})
+	env.RegisterActivity(SampleActivity)
+
+	var baggage Baggage
+	env.SetOnActivityStartedListener(func(activityInfo *activity.Info, ctx context.Context, args converter.EncodedValues) {
+		baggage = BaggageFromContext(ctx)
+	})
+
+	env.ExecuteWorkflow(CtxPropWorkflow)
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+
+	s.Equal(Baggage{"tenant": "acme", "user": "bob"}, baggage)
+}
+
+func (s *UnitTestSuite) Test_BaggageHelpers() {
+	ctx := SetBaggage(context.Background(), "tenant", "acme")
+	child := SetBaggage(ctx, "user", "bob")
+
+	value, ok := GetBaggage(child, "tenant")
+	s.True(ok)
+	s.Equal("acme", value)
+	_, ok = GetBaggage(ctx, "user")
+	s.False(ok, "setting baggage must not modify the parent context")
+
+	header := testHeader{}
+	s.NoError(NewBaggagePropagator(BaggagePropagatorOptions{}).Inject(child, header))
+	extracted, err := NewBaggagePropagator(BaggagePropagatorOptions{}).Extract(context.Background(), header)
+	s.NoError(err)
+	s.Equal(Baggage{"tenant": "acme", "user": "bob"}, BaggageFromContext(extracted))
+}
+
+func (s *UnitTestSuite) Test_BaggageSizeLimit() {
+	ctx := SetBaggage(context.Background(), "key", strings.Repeat("x", 16))
+	propagator := NewBaggagePropagator(BaggagePropagatorOptions{MaxSize: 10})
+
+	s.ErrorIs(propagator.Inject(ctx, testHeader{}), ErrBaggageTooLarge)
+
+	header := testHeader{}
+	s.NoError(NewBaggagePropagator(BaggagePropagatorOptions{}).Inject(ctx, header))
+	_, err := propagator.Extract(context.Background(), header)
+	s.ErrorIs(err, ErrBaggageTooLarge)
+}
+
+// testHeader implements workflow.HeaderReader and workflow.HeaderWriter
+type testHeader map[string]*commonpb.Payload
+
+func (h testHeader) Set(key string, value *commonpb.Payload) {
+	h[key] = value
+}
+
+func (h testHeader) Get(key string) (*commonpb.Payload, bool) {
+	value, ok := h[key]
+	return value, ok
+}
+
+func (h testHeader) ForEachKey(handler func(string, *commonpb.Payload) error) error {
+	for key, value := range h {
+		if err := handler(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *UnitTestSuite) Test_TracingInterceptor() {
+	tp, exporter := NewInMemoryTracerProvider()
+
+	ctx, root := tp.Tracer("test").Start(context.Background(), "StartWorkflow:CtxPropWorkflow")
+	root.End()
+	header := testHeader{}
+	s.NoError(NewTracePropagator().Inject(ctx, header))
+
+	env := s.NewTestWorkflowEnvironment()
+	env.SetHeader(&commonpb.Header{Fields: header})
+	env.SetContextPropagators([]workflow.ContextPropagator{NewTracePropagator()})
+	env.SetWorkerOptions(worker.Options{
+		WorkflowInterceptorChainFactories: []interceptors.WorkflowInterceptor{NewTracingInterceptor(tp)},
+	})
+	RegisterTracedActivity(env, tp, SampleActivity)
+
+	env.ExecuteWorkflow(CtxPropWorkflow)
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	s.Len(spans, 4)
+
+	// Every span belongs to the trace started by the client and is a child of the previous one.
+	parent := spans["StartWorkflow:CtxPropWorkflow"]
+	for _, name := range []string{"RunWorkflow:CtxPropWorkflow", "StartActivity:SampleActivity", "RunActivity:SampleActivity"} {
+		span, ok := spans[name]
+		s.True(ok, name)
+		s.Equal(root.SpanContext().TraceID(), span.SpanContext.TraceID(), name)
+		s.Equal(parent.SpanContext.SpanID(), span.Parent.SpanID(), name)
+		parent = span
+	}
+}
+
+func (s *UnitTestSuite) Test_TracingInterceptor_Query() {
+	tp, exporter := NewInMemoryTracerProvider()
+
+	env := s.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{
+		WorkflowInterceptorChainFactories: []interceptors.WorkflowInterceptor{NewTracingInterceptor(tp)},
+	})
+	env.RegisterWorkflow(queryWorkflow)
+
+	env.ExecuteWorkflow(queryWorkflow)
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+
+	value, err := env.QueryWorkflow("state")
+	s.NoError(err)
+	var state string
+	s.NoError(value.Get(&state))
+	s.Equal("done", state)
+
+	spans := exporter.GetSpans()
+	s.Len(spans, 2)
+	s.Equal("RunWorkflow:queryWorkflow", spans[0].Name)
+	s.Equal("HandleQuery:state", spans[1].Name)
+	s.Equal(spans[0].SpanContext.SpanID(), spans[1].Parent.SpanID())
+}
+
+func queryWorkflow(ctx workflow.Context) error {
+	return workflow.SetQueryHandler(ctx, "state", func() (string, error) {
+		return "done", nil
+	})
+}
+
+func (s *UnitTestSuite) Test_StartWorkflowSpan_Replay() {
+	tp, exporter := NewInMemoryTracerProvider()
+	tracedWorkflow := func(ctx workflow.Context) ([]string, error) {
+		ctx = WithWorkflowTracer(ctx, tp)
+		ctx, parent := StartWorkflowSpan(ctx, "parent")
+		_, child := StartWorkflowSpan(ctx, "child")
+		child.End()
+		parent.End()
+		return []string{parent.SpanContext().SpanID().String(), child.SpanContext().SpanID().String()}, nil
+	}
+	options := workflow.RegisterOptions{Name: "tracedWorkflow"}
+
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflowWithOptions(tracedWorkflow, options)
+
+	env.ExecuteWorkflow("tracedWorkflow")
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	var spanIDs []string
+	s.NoError(env.GetWorkflowResult(&spanIDs))
+
+	s.Len(spanIDs, 2)
+	s.NotEqual(spanIDs[0], spanIDs[1])
+	spans := exporter.GetSpans()
+	s.Len(spans, 2)
+	s.Equal("child", spans[0].Name)
+	s.Equal(spanIDs[1], spans[0].SpanContext.SpanID().String())
+	s.Equal(spanIDs[0], spans[0].Parent.SpanID().String())
+	s.Equal("parent", spans[1].Name)
+	s.Equal(spanIDs[0], spans[1].SpanContext.SpanID().String())
+
+	// The replayer fails if the result differs from the history, so replaying proves the span IDs
+	// are the ones recorded as side effects.
+	exporter.Reset()
+	result, err := converter.GetDefaultDataConverter().ToPayloads(spanIDs)
+	s.NoError(err)
+	replayer := worker.NewWorkflowReplayer()
+	replayer.RegisterWorkflowWithOptions(tracedWorkflow, options)
+	s.NoError(replayer.ReplayWorkflowHistory(nil, completedHistory("tracedWorkflow", "default-test-run-id", spanIDs, result)))
+
+	s.Empty(exporter.GetSpans(), "replay must not export spans again")
+}
+
+// completedHistory returns the history of a workflow that recorded the side effects and completed
+// in its first workflow task
+func completedHistory(workflowType string, runID string, sideEffects []string, result *commonpb.Payloads) *historypb.History {
+	now := time.Now()
+	history := &historypb.History{Events: []*historypb.HistoryEvent{
+		{
+			EventId: 1, EventTime: &now, EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED,
+			Attributes: &historypb.HistoryEvent_WorkflowExecutionStartedEventAttributes{WorkflowExecutionStartedEventAttributes: &historypb.WorkflowExecutionStartedEventAttributes{
+				WorkflowType:           &commonpb.WorkflowType{Name: workflowType},
+				TaskQueue:              &taskqueuepb.TaskQueue{Name: "ReplayTaskQueue"},
+				OriginalExecutionRunId: runID,
+				Attempt:                1,
+			}},
+		},
+		{
+			EventId: 2, EventTime: &now, EventType: enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED,
+			Attributes: &historypb.HistoryEvent_WorkflowTaskScheduledEventAttributes{WorkflowTaskScheduledEventAttributes: &historypb.WorkflowTaskScheduledEventAttributes{
+				TaskQueue: &taskqueuepb.TaskQueue{Name: "ReplayTaskQueue"},
+				Attempt:   1,
+			}},
+		},
+		{
+			EventId: 3, EventTime: &now, EventType: enumspb.EVENT_TYPE_WORKFLOW_TASK_STARTED,
+			Attributes: &historypb.HistoryEvent_WorkflowTaskStartedEventAttributes{WorkflowTaskStartedEventAttributes: &historypb.WorkflowTaskStartedEventAttributes{
+				ScheduledEventId: 2,
+			}},
+		},
+		{
+			EventId: 4, EventTime: &now, EventType: enumspb.EVENT_TYPE_WORKFLOW_TASK_COMPLETED,
+			Attributes: &historypb.HistoryEvent_WorkflowTaskCompletedEventAttributes{WorkflowTaskCompletedEventAttributes: &historypb.WorkflowTaskCompletedEventAttributes{
+				ScheduledEventId: 2,
+				StartedEventId:   3,
+			}},
+		},
+	}}
+	dc := converter.GetDefaultDataConverter()
+	for i, sideEffect := range sideEffects {
+		id, _ := dc.ToPayloads(int64(i + 1))
+		data, _ := dc.ToPayloads(sideEffect)
+		history.Events = append(history.Events, &historypb.HistoryEvent{
+			EventId: int64(len(history.Events) + 1), EventTime: &now, EventType: enumspb.EVENT_TYPE_MARKER_RECORDED,
+			Attributes: &historypb.HistoryEvent_MarkerRecordedEventAttributes{MarkerRecordedEventAttributes: &historypb.MarkerRecordedEventAttributes{
+				MarkerName:                   "SideEffect",
+				Details:                      map[string]*commonpb.Payloads{"side-effect-id": id, "data": data},
+				WorkflowTaskCompletedEventId: 4,
+			}},
+		})
+	}
+	history.Events = append(history.Events, &historypb.HistoryEvent{
+		EventId: int64(len(history.Events) + 1), EventTime: &now, EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_COMPLETED,
+		Attributes: &historypb.HistoryEvent_WorkflowExecutionCompletedEventAttributes{WorkflowExecutionCompletedEventAttributes: &historypb.WorkflowExecutionCompletedEventAttributes{
+			Result:                       result,
+			WorkflowTaskCompletedEventId: 4,
+		}},
+	})
+	return history
+}
+
+func (s *UnitTestSuite) Test_ClaimsPropagator() {
+	key := []byte("test-key")
+	header := testHeader{}
+	ctx := WithClaims(context.Background(), Claims{"sub": "alice", "role": "admin"})
+	s.NoError(NewClaimsPropagator(key).Inject(ctx, header))
+
+	env := s.claimsTestEnvironment(key, header)
+	var claims Claims
+	env.SetOnActivityStartedListener(func(activityInfo *activity.Info, ctx context.Context, args converter.EncodedValues) {
+		claims, _ = ClaimsFromContext(ctx)
+	})
+
+	env.ExecuteWorkflow(CtxPropWorkflow)
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	s.Equal(Claims{"sub": "alice", "role": "admin"}, claims)
+}
+
+func (s *UnitTestSuite) Test_ClaimsPropagator_Tampered() {
+	key := []byte("test-key")
+	header := testHeader{}
+	ctx := WithClaims(context.Background(), Claims{"sub": "alice", "role": "viewer"})
+	s.NoError(NewClaimsPropagator(key).Inject(ctx, header))
+
+	var signed signedClaims
+	s.NoError(converter.GetDefaultDataConverter().FromPayload(header[claimsHeaderKey], &signed))
+	signed.Claims["role"] = "admin"
+	payload, err := converter.GetDefaultDataConverter().ToPayload(signed)
+	s.NoError(err)
+	header[claimsHeaderKey] = payload
+
+	env := s.claimsTestEnvironment(key, header)
+	env.ExecuteWorkflow(CtxPropWorkflow)
+	s.True(env.IsWorkflowCompleted())
+	s.assertUnauthorized(env.GetWorkflowError())
+}
+
+func (s *UnitTestSuite) Test_ClaimsPropagator_Missing() {
+	key := []byte("test-key")
+	header := testHeader{}
+	ctx := WithClaims(context.Background(), Claims{"role": "admin"})
+	s.NoError(NewClaimsPropagator(key).Inject(ctx, header))
+
+	env := s.claimsTestEnvironment(key, header)
+	env.ExecuteWorkflow(CtxPropWorkflow)
+	s.True(env.IsWorkflowCompleted())
+	s.assertUnauthorized(env.GetWorkflowError())
+
+	// Claims signed with another key are rejected as well.
+	env = s.claimsTestEnvironment([]byte("other-key"), header)
+	env.ExecuteWorkflow(CtxPropWorkflow)
+	s.True(env.IsWorkflowCompleted())
+	s.assertUnauthorized(env.GetWorkflowError())
+}
+
+func (s *UnitTestSuite) claimsTestEnvironment(key []byte, header testHeader) *testsuite.TestWorkflowEnvironment {
+	env := s.NewTestWorkflowEnvironment()
+	env.SetHeader(&commonpb.Header{Fields: header})
+	env.SetContextPropagators([]workflow.ContextPropagator{NewClaimsPropagator(key)})
+	RegisterActivityWithInterceptors(env, SampleActivity, NewClaimsActivityInterceptor("sub"))
+	return env
+}
+
+func (s *UnitTestSuite) assertUnauthorized(err error) {
+	s.Error(err)
+	var applicationErr *temporal.ApplicationError
+	s.True(errors.As(err, &applicationErr))
+	s.Equal(UnauthorizedErrorType, applicationErr.Type())
+	s.True(applicationErr.NonRetryable())
+}
@@ -0,0 +1,212 @@
+package ctxpropagation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.temporal.io/sdk/workflow"
+)
+
+type (
+	// workflowTracerKey is the key used to store the workflowTracer in the workflow.Context
+	workflowTracerKey struct{}
+
+	// spanIDsKey is the key used to pass precomputed span IDs to the workflowIDGenerator
+	spanIDsKey struct{}
+
+	// workflowTracer creates spans with replay-safe IDs for a single run of a workflow execution
+	workflowTracer struct {
+		provider trace.TracerProvider
+		tracer   trace.Tracer
+		seed     string
+	}
+
+	// workflowSpan is a span created in workflow code. It is buffered until End and only exported
+	// if the workflow is not replaying at that point, so every span is exported exactly once.
+	workflowSpan struct {
+		ctx        workflow.Context
+		tracer     *workflowTracer
+		parent     trace.SpanContext
+		spanCtx    trace.SpanContext
+		name       string
+		start      time.Time
+		options    []trace.SpanStartOption
+		attributes []attribute.KeyValue
+		events     []func(span trace.Span)
+		statusCode codes.Code
+		statusDesc string
+		ended      bool
+	}
+
+	// workflowIDGenerator generates the precomputed IDs of workflow spans and random IDs otherwise
+	workflowIDGenerator struct{}
+)
+
+// WithWorkflowTracer returns a copy of ctx in which StartWorkflowSpan creates spans using provider.
+// The tracing interceptor calls it for every workflow execution.
+func WithWorkflowTracer(ctx workflow.Context, provider trace.TracerProvider) workflow.Context {
+	info := workflow.GetInfo(ctx)
+	return workflow.WithValue(ctx, workflowTracerKey{}, &workflowTracer{
+		provider: provider,
+		tracer:   provider.Tracer(tracerName),
+		seed:     info.WorkflowExecution.ID + "/" + info.WorkflowExecution.RunID,
+	})
+}
+
+// StartWorkflowSpan starts a replay-safe span in workflow code that is a child of the current
+// workflow span and returns a copy of ctx with the new span as the current one.
+//
+// Span IDs are random and recorded in the workflow history with workflow.SideEffect, so a replay
+// returns the IDs of the original execution and a span added by a later version of the workflow
+// code gets a new ID instead of shifting the IDs of the following spans. The trace ID of a span
+// without parent is derived from the workflow ID and run ID. Spans are only exported if the
+// workflow isn't replaying when End is called.
+// If ctx has no tracer, see WithWorkflowTracer, a non-recording span is returned.
+func StartWorkflowSpan(ctx workflow.Context, name string, opts ...trace.SpanStartOption) (workflow.Context, trace.Span) {
+	t, ok := ctx.Value(workflowTracerKey{}).(*workflowTracer)
+	if !ok {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+
+	parent := spanContextFromWorkflow(ctx)
+	span := &workflowSpan{
+		ctx:     ctx,
+		tracer:  t,
+		parent:  parent,
+		spanCtx: t.newSpanContext(ctx, parent),
+		name:    name,
+		start:   workflow.Now(ctx),
+		options: opts,
+	}
+	return withWorkflowSpanContext(ctx, span.spanCtx), span
+}
+
+// NewWorkflowIDGenerator returns the IDGenerator that lets spans created by StartWorkflowSpan use
+// their deterministic IDs. NewTracerProvider configures it, use it when creating your own provider.
+func NewWorkflowIDGenerator() sdktrace.IDGenerator {
+	return &workflowIDGenerator{}
+}
+
+func (t *workflowTracer) newSpanContext(ctx workflow.Context, parent trace.SpanContext) trace.SpanContext {
+	config := trace.SpanContextConfig{
+		SpanID:     workflowSpanID(ctx),
+		TraceFlags: trace.FlagsSampled,
+	}
+	if parent.IsValid() {
+		config.TraceID = parent.TraceID()
+		config.TraceFlags = parent.TraceFlags()
+		config.TraceState = parent.TraceState()
+	} else {
+		traceHash := sha256.Sum256([]byte(t.seed))
+		copy(config.TraceID[:], traceHash[:])
+	}
+	return trace.NewSpanContext(config)
+}
+
+// workflowSpanID returns a random span ID recorded as a side effect, so replays get the same ID
+func workflowSpanID(ctx workflow.Context) trace.SpanID {
+	var spanID trace.SpanID
+	var hexSpanID string
+	err := workflow.SideEffect(ctx, func(workflow.Context) interface{} {
+		_, _ = rand.Read(spanID[:])
+		return spanID.String()
+	}).Get(&hexSpanID)
+	if err != nil {
+		panic(err)
+	}
+	spanID, err = trace.SpanIDFromHex(hexSpanID)
+	if err != nil {
+		panic(err)
+	}
+	return spanID
+}
+
+func (s *workflowSpan) End(options ...trace.SpanEndOption) {
+	if s.ended {
+		return
+	}
+	s.ended = true
+	if workflow.IsReplaying(s.ctx) {
+		return
+	}
+
+	parent := context.Background()
+	if s.parent.IsValid() {
+		parent = trace.ContextWithSpanContext(parent, s.parent)
+	}
+	parent = context.WithValue(parent, spanIDsKey{}, s.spanCtx)
+
+	startOptions := append([]trace.SpanStartOption{trace.WithTimestamp(s.start)}, s.options...)
+	startOptions = append(startOptions, trace.WithAttributes(s.attributes...))
+	_, span := s.tracer.tracer.Start(parent, s.name, startOptions...)
+	for _, event := range s.events {
+		event(span)
+	}
+	if s.statusCode != codes.Unset {
+		span.SetStatus(s.statusCode, s.statusDesc)
+	}
+	span.End(append([]trace.SpanEndOption{trace.WithTimestamp(workflow.Now(s.ctx))}, options...)...)
+}
+
+func (s *workflowSpan) AddEvent(name string, options ...trace.EventOption) {
+	options = append([]trace.EventOption{trace.WithTimestamp(workflow.Now(s.ctx))}, options...)
+	s.events = append(s.events, func(span trace.Span) {
+		span.AddEvent(name, options...)
+	})
+}
+
+func (s *workflowSpan) IsRecording() bool {
+	return !s.ended && !workflow.IsReplaying(s.ctx)
+}
+
+func (s *workflowSpan) RecordError(err error, options ...trace.EventOption) {
+	options = append([]trace.EventOption{trace.WithTimestamp(workflow.Now(s.ctx))}, options...)
+	s.events = append(s.events, func(span trace.Span) {
+		span.RecordError(err, options...)
+	})
+}
+
+func (s *workflowSpan) SpanContext() trace.SpanContext {
+	return s.spanCtx
+}
+
+func (s *workflowSpan) SetStatus(code codes.Code, description string) {
+	s.statusCode = code
+	s.statusDesc = description
+}
+
+func (s *workflowSpan) SetName(name string) {
+	s.name = name
+}
+
+func (s *workflowSpan) SetAttributes(kv ...attribute.KeyValue) {
+	s.attributes = append(s.attributes, kv...)
+}
+
+func (s *workflowSpan) TracerProvider() trace.TracerProvider {
+	return s.tracer.provider
+}
+
+func (g *workflowIDGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	if sc, ok := ctx.Value(spanIDsKey{}).(trace.SpanContext); ok {
+		return sc.TraceID(), sc.SpanID()
+	}
+	var traceID trace.TraceID
+	_, _ = rand.Read(traceID[:])
+	return traceID, g.NewSpanID(ctx, traceID)
+}
+
+func (g *workflowIDGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
+	if sc, ok := ctx.Value(spanIDsKey{}).(trace.SpanContext); ok && sc.TraceID() == traceID {
+		return sc.SpanID()
+	}
+	var spanID trace.SpanID
+	_, _ = rand.Read(spanID[:])
+	return spanID
+}
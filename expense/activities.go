@@ -1,14 +1,50 @@
 package expense
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 
 	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+)
+
+// ExpenseServerErrorType is the type of the non retryable application error returned by the activities when the
+// expense server rejects a request with a 4xx status code
+const ExpenseServerErrorType = "ExpenseServerError"
+
+type (
+	// Payment of an expense, as returned by the expense server
+	Payment struct {
+		ID       string `json:"id"`
+		Amount   int64  `json:"amount"`
+		Currency string `json:"currency"`
+		// Status is either PAID or REFUNDED
+		Status string `json:"status"`
+	}
+
+	// expenseRequest is a request to the expense server API
+	expenseRequest struct {
+		method string
+		// expenseID and action select /api/expenses/{expenseID}/{action}, /api/expenses if expenseID is empty
+		expenseID string
+		action    string
+		// idempotencyKey is sent in the Idempotency-Key header if set
+		idempotencyKey string
+		// body is encoded as JSON if set
+		body interface{}
+		// result is decoded from the JSON response if set
+		result interface{}
+	}
+
+	// serverError is the body of the expense server responses with an error status code
+	serverError struct {
+		Error string `json:"error"`
+	}
 )
 
 func CreateExpenseActivity(ctx context.Context, expenseID string) error {
@@ -16,22 +52,21 @@ func CreateExpenseActivity(ctx context.Context, expenseID string) error {
 		return errors.New("expense id is empty")
 	}
 
-	resp, err := http.Get(expenseServerHostPort + "/create?is_api_call=true&id=" + expenseID)
-	if err != nil {
-		return err
+	status, err := callExpenseServer(ctx, expenseRequest{
+		method: http.MethodPost,
+		body:   map[string]string{"id": expenseID},
+	})
+	if status == http.StatusConflict {
+		// a previous attempt created the expense but its response was lost
+		activity.GetLogger(ctx).Info("Expense already created.", "ExpenseID", expenseID)
+		return nil
 	}
-	body, err := ioutil.ReadAll(resp.Body)
-	_ = resp.Body.Close()
 	if err != nil {
 		return err
 	}
 
-	if string(body) == "SUCCEED" {
-		activity.GetLogger(ctx).Info("Expense created.", "ExpenseID", expenseID)
-		return nil
-	}
-
-	return errors.New(string(body))
+	activity.GetLogger(ctx).Info("Expense created.", "ExpenseID", expenseID)
+	return nil
 }
 
 // waitForDecisionActivity waits for the expense decision. This activity will complete asynchronously. When this method
@@ -48,54 +83,167 @@ func WaitForDecisionActivity(ctx context.Context, expenseID string) (string, err
 
 	// save current activity info so it can be completed asynchronously when expense is approved/rejected
 	activityInfo := activity.GetInfo(ctx)
-	formData := url.Values{}
-	formData.Add("task_token", string(activityInfo.TaskToken))
-
-	registerCallbackURL := expenseServerHostPort + "/registerCallback?id=" + expenseID
-	resp, err := http.PostForm(registerCallbackURL, formData)
+	_, err := callExpenseServer(ctx, expenseRequest{
+		method:    http.MethodPost,
+		expenseID: expenseID,
+		action:    "callback",
+		body:      map[string][]byte{"taskToken": activityInfo.TaskToken},
+	})
 	if err != nil {
-		logger.Info("waitForDecisionActivity failed to register callback.", "Error", err)
+		logger.Warn("Register callback failed.", "Error", err)
 		return "", err
 	}
-	body, err := ioutil.ReadAll(resp.Body)
-	_ = resp.Body.Close()
+
+	// register callback succeed
+	logger.Info("Successfully registered callback.", "ExpenseID", expenseID)
+
+	// ErrActivityResultPending is returned from activity's execution to indicate the activity is not completed when it returns.
+	// activity will be completed asynchronously when Client.CompleteActivity() is called.
+	return "", activity.ErrResultPending
+}
+
+// PaymentActivity pays the expense. The idempotency key is derived from the workflow and activity IDs, which
+// don't change when the activity is retried, so the expense server returns the existing payment instead of paying
+// twice when a retry follows a request whose response was lost.
+func PaymentActivity(ctx context.Context, expense Expense) (Payment, error) {
+	if len(expense.ID) == 0 {
+		return Payment{}, errors.New("expense id is empty")
+	}
+
+	info := activity.GetInfo(ctx)
+	var payment Payment
+	_, err := callExpenseServer(ctx, expenseRequest{
+		method:         http.MethodPost,
+		expenseID:      expense.ID,
+		action:         "pay",
+		idempotencyKey: info.WorkflowExecution.ID + "/" + info.ActivityID,
+		body: map[string]interface{}{
+			"amount":   expense.Amount,
+			"currency": expense.Currency,
+		},
+		result: &payment,
+	})
 	if err != nil {
-		return "", err
+		return Payment{}, err
 	}
 
-	status := string(body)
-	if status == "SUCCEED" {
-		// register callback succeed
-		logger.Info("Successfully registered callback.", "ExpenseID", expenseID)
+	activity.GetLogger(ctx).Info("paymentActivity succeed", "ExpenseID", expense.ID, "PaymentID", payment.ID)
+	return payment, nil
+}
+
+// CompleteExpenseActivity marks the paid expense as completed on the expense server
+func CompleteExpenseActivity(ctx context.Context, expenseID string) error {
+	if len(expenseID) == 0 {
+		return errors.New("expense id is empty")
+	}
 
-		// ErrActivityResultPending is returned from activity's execution to indicate the activity is not completed when it returns.
-		// activity will be completed asynchronously when Client.CompleteActivity() is called.
-		return "", activity.ErrResultPending
+	_, err := callExpenseServer(ctx, expenseRequest{
+		method:    http.MethodPost,
+		expenseID: expenseID,
+		action:    "complete",
+	})
+	if err != nil {
+		return err
 	}
 
-	logger.Warn("Register callback failed.", "ExpenseStatus", status)
-	return "", fmt.Errorf("register callback failed status:%s", status)
+	activity.GetLogger(ctx).Info("Expense completed.", "ExpenseID", expenseID)
+	return nil
 }
 
-func PaymentActivity(ctx context.Context, expenseID string) error {
+// RefundPaymentActivity refunds the payment of the expense. It compensates PaymentActivity when a later step
+// fails, refunding a payment twice has no effect.
+func RefundPaymentActivity(ctx context.Context, expenseID, paymentID string) error {
 	if len(expenseID) == 0 {
 		return errors.New("expense id is empty")
 	}
 
-	resp, err := http.Get(expenseServerHostPort + "/action?is_api_call=true&type=payment&id=" + expenseID)
+	_, err := callExpenseServer(ctx, expenseRequest{
+		method:    http.MethodPost,
+		expenseID: expenseID,
+		action:    "refund",
+		body:      map[string]string{"paymentId": paymentID},
+	})
 	if err != nil {
 		return err
 	}
-	body, err := ioutil.ReadAll(resp.Body)
-	_ = resp.Body.Close()
+
+	activity.GetLogger(ctx).Info("Payment refunded.", "ExpenseID", expenseID, "PaymentID", paymentID)
+	return nil
+}
+
+// NotifyApproverActivity notifies the approver that the expense waits for its decision. This sample only logs
+// the notification, a real system would send an email or a chat message.
+func NotifyApproverActivity(ctx context.Context, expenseID, approver, reason string) error {
+	if len(expenseID) == 0 {
+		return errors.New("expense id is empty")
+	}
+
+	activity.GetLogger(ctx).Info("Notifying approver.", "ExpenseID", expenseID, "Approver", approver, "Reason", reason)
+	return nil
+}
+
+// RejectExpenseActivity rejects the expense on the expense server once the approval chain rejected it or the
+// deadline is reached
+func RejectExpenseActivity(ctx context.Context, expenseID string) error {
+	if len(expenseID) == 0 {
+		return errors.New("expense id is empty")
+	}
+
+	_, err := callExpenseServer(ctx, expenseRequest{
+		method:    http.MethodPost,
+		expenseID: expenseID,
+		action:    "reject",
+	})
 	if err != nil {
 		return err
 	}
 
-	if string(body) == "SUCCEED" {
-		activity.GetLogger(ctx).Info("paymentActivity succeed", "ExpenseID", expenseID)
-		return nil
-	}
+	activity.GetLogger(ctx).Info("Expense rejected.", "ExpenseID", expenseID)
+	return nil
+}
 
-	return errors.New(string(body))
+// callExpenseServer sends the request to the expense server API. It returns the status code of the response, and
+// an error unless it is a success. 4xx status codes are returned as non retryable ExpenseServerErrorType errors.
+func callExpenseServer(ctx context.Context, r expenseRequest) (int, error) {
+	var body bytes.Buffer
+	if r.body != nil {
+		if err := json.NewEncoder(&body).Encode(r.body); err != nil {
+			return 0, err
+		}
+	}
+	u := expenseServerHostPort + "/api/expenses"
+	if r.expenseID != "" {
+		u += "/" + url.PathEscape(r.expenseID) + "/" + r.action
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, u, &body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", r.idempotencyKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		if r.result != nil {
+			if err := json.NewDecoder(resp.Body).Decode(r.result); err != nil {
+				return resp.StatusCode, err
+			}
+		}
+		return resp.StatusCode, nil
+	}
+	var serverErr serverError
+	if err := json.NewDecoder(resp.Body).Decode(&serverErr); err != nil || serverErr.Error == "" {
+		serverErr.Error = resp.Status
+	}
+	message := fmt.Sprintf("expense server error %d: %s", resp.StatusCode, serverErr.Error)
+	if resp.StatusCode >= http.StatusBadRequest && resp.StatusCode < http.StatusInternalServerError {
+		return resp.StatusCode, temporal.NewNonRetryableApplicationError(message, ExpenseServerErrorType, nil)
+	}
+	return resp.StatusCode, errors.New(message)
 }
@@ -0,0 +1,82 @@
+package expense
+
+// ApprovalLevel is a level of the approval chain
+type ApprovalLevel string
+
+// Approval levels used by the default policy
+const (
+	ApprovalLevelManager  ApprovalLevel = "manager"
+	ApprovalLevelFinance  ApprovalLevel = "finance"
+	ApprovalLevelDirector ApprovalLevel = "director"
+)
+
+type (
+	// ApprovalRule requires an approval at Level for the expenses it matches
+	ApprovalRule struct {
+		Level ApprovalLevel
+		// MinAmount is the amount, in the smallest unit of the currency, from which the rule applies
+		MinAmount int64
+		// Currency the rule applies to, all currencies if empty
+		Currency string
+		// Categories the rule applies to, all categories if empty
+		Categories []string
+	}
+
+	// ApprovalPolicy computes the approval chain of an expense from its rules
+	ApprovalPolicy struct {
+		Rules []ApprovalRule
+		// Parallel requests the approval of every level at once instead of one level after the other
+		Parallel bool
+	}
+)
+
+// DefaultApprovalPolicy returns the policy used when the workflow is started without rules: every
+// expense is approved by a manager, finance approves expenses from 1,000 and equipment, and a director
+// approves expenses from 10,000.
+func DefaultApprovalPolicy() ApprovalPolicy {
+	return ApprovalPolicy{
+		Rules: []ApprovalRule{
+			{Level: ApprovalLevelManager},
+			{Level: ApprovalLevelFinance, MinAmount: 100000},
+			{Level: ApprovalLevelFinance, Categories: []string{"equipment"}},
+			{Level: ApprovalLevelDirector, MinAmount: 1000000},
+		},
+	}
+}
+
+// ApprovalChain returns the levels that must approve the expense, in the order their first matching
+// rule appears in the policy. An expense matching no rule is approved by a manager, so that no expense
+// is approved without any approver.
+func (p ApprovalPolicy) ApprovalChain(expense Expense) []ApprovalLevel {
+	var chain []ApprovalLevel
+	seen := make(map[ApprovalLevel]bool)
+	for _, rule := range p.Rules {
+		if seen[rule.Level] || !rule.matches(expense) {
+			continue
+		}
+		seen[rule.Level] = true
+		chain = append(chain, rule.Level)
+	}
+	if len(chain) == 0 {
+		return []ApprovalLevel{ApprovalLevelManager}
+	}
+	return chain
+}
+
+func (r ApprovalRule) matches(expense Expense) bool {
+	if expense.Amount < r.MinAmount {
+		return false
+	}
+	if r.Currency != "" && r.Currency != expense.Currency {
+		return false
+	}
+	if len(r.Categories) == 0 {
+		return true
+	}
+	for _, category := range r.Categories {
+		if category == expense.Category {
+			return true
+		}
+	}
+	return false
+}
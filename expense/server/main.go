@@ -2,15 +2,24 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"html"
+	"log"
 	"net/http"
-	"sort"
+	"net/url"
+	"strings"
 
 	"go.temporal.io/sdk/client"
+
+	"github.com/temporalio/samples-go/expense"
 )
 
 /**
  * Dummy server that support to list expenses, create new expense, update expense state and checking expense state.
+ * The HTML pages let a human approve or reject expenses, the JSON API under /api/expenses is used by the activities.
  */
 
 type expenseState string
@@ -22,151 +31,306 @@ const (
 	completed expenseState = "COMPLETED"
 )
 
-// use memory store for this dummy server
+type (
+	// callbackRequest is the body of POST /api/expenses/{id}/callback
+	callbackRequest struct {
+		TaskToken []byte `json:"taskToken"`
+	}
+
+	// errorResponse is the body of the API responses with an error status code
+	errorResponse struct {
+		Error string `json:"error"`
+	}
+)
+
 var (
-	allExpense     = make(map[string]expenseState)
-	tokenMap       = make(map[string][]byte)
+	expenses       store
 	workflowClient client.Client
+	// useVisibility drives the list page from the search attributes of the workflows instead of the store
+	useVisibility bool
 )
 
 func main() {
+	var dbPath string
+	flag.StringVar(&dbPath, "db", "expense.db", "BoltDB file storing the expenses, empty to keep them in memory.")
+	flag.BoolVar(&useVisibility, "visibility", false, "List the expenses from Temporal visibility, requires Elasticsearch.")
+	flag.Parse()
+
 	var err error
+	if dbPath == "" {
+		expenses = newMemoryStore()
+	} else if expenses, err = newBoltStore(dbPath); err != nil {
+		log.Fatalln("Unable to open store", err)
+	}
+	defer func() { _ = expenses.Close() }()
+
 	// The client is a heavyweight object that should be created once per process.
 	workflowClient, err = client.NewClient(client.Options{
 		HostPort: client.DefaultHostPort,
 	})
 	if err != nil {
-		panic(err)
+		log.Fatalln("Unable to create client", err)
 	}
+	defer workflowClient.Close()
 
 	fmt.Println("Starting dummy server...")
 	http.HandleFunc("/", listHandler)
 	http.HandleFunc("/list", listHandler)
-	http.HandleFunc("/create", createHandler)
 	http.HandleFunc("/action", actionHandler)
-	http.HandleFunc("/status", statusHandler)
-	http.HandleFunc("/registerCallback", callbackHandler)
-	_ = http.ListenAndServe(":8099", nil)
+	http.HandleFunc("/api/expenses", apiHandler)
+	http.HandleFunc("/api/expenses/", apiHandler)
+	log.Println(http.ListenAndServe(":8099", nil))
 }
 
-func listHandler(w http.ResponseWriter, _ *http.Request) {
+func listHandler(w http.ResponseWriter, r *http.Request) {
+	var rows []expenseRow
+	var err error
+	if useVisibility {
+		rows, err = listFromVisibility(r.Context())
+	} else {
+		rows, err = listFromStore()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	_, _ = fmt.Fprint(w, "<h1>DUMMY EXPENSE SYSTEM</h1>"+"<a href=\"/list\">HOME</a>"+
-		"<h3>All expense requests:</h3><table border=1><tr><th>Expense ID</th><th>Status</th><th>Action</th>")
-	var keys []string
-	for k := range allExpense {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-	for _, id := range keys {
-		state := allExpense[id]
+		"<h3>All expense requests:</h3><table border=1><tr><th>Expense ID</th><th>Status</th><th>Amount</th>"+
+		"<th>Approver</th><th>Action</th>")
+	for _, e := range rows {
+		id := url.QueryEscape(e.ID)
 		actionLink := ""
-		if state == created {
+		if e.Pending {
 			actionLink = fmt.Sprintf("<a href=\"/action?type=approve&id=%s\">"+
 				"<button style=\"background-color:#4CAF50;\">APPROVE</button></a>"+
 				"&nbsp;&nbsp;<a href=\"/action?type=reject&id=%s\">"+
 				"<button style=\"background-color:#f44336;\">REJECT</button></a>", id, id)
 		}
-		_, _ = fmt.Fprintf(w, "<tr><td>%s</td><td>%s</td><td>%s</td></tr>", id, state, actionLink)
+		_, _ = fmt.Fprintf(w, "<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>", html.EscapeString(e.ID),
+			html.EscapeString(e.Status), e.Amount, html.EscapeString(e.Approver), actionLink)
 	}
 	_, _ = fmt.Fprint(w, "</table>")
 }
 
+// actionHandler handles the decisions made on the HTML page
 func actionHandler(w http.ResponseWriter, r *http.Request) {
-	isAPICall := r.URL.Query().Get("is_api_call") == "true"
-	id := r.URL.Query().Get("id")
-	oldState, ok := allExpense[id]
-	if !ok {
-		_, _ = fmt.Fprint(w, "ERROR:INVALID_ID")
-		return
-	}
-	actionType := r.URL.Query().Get("type")
-	switch actionType {
+	query := r.URL.Query()
+	id := query.Get("id")
+	var state expenseState
+	switch query.Get("type") {
 	case "approve":
-		allExpense[id] = approved
+		state = approved
 	case "reject":
-		allExpense[id] = rejected
-	case "payment":
-		allExpense[id] = completed
-	}
-	if isAPICall {
-		_, _ = fmt.Fprint(w, "SUCCEED")
-	} else {
-		listHandler(w, r)
+		state = rejected
+	default:
+		http.Error(w, "invalid action type", http.StatusBadRequest)
+		return
 	}
 
-	if oldState == created && (allExpense[id] == approved || allExpense[id] == rejected) {
-		// report state change
-		notifyExpenseStateChange(id, string(allExpense[id]))
+	e, err := expenses.Get(id)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	if e.State == created {
+		if len(e.TaskToken) == 0 {
+			// Without registered callback, the decision is signaled to the workflow. The expense stays created
+			// until every level of the approval chain decided, then the workflow pays or rejects it.
+			signalDecision(id, state, query)
+		} else {
+			completeDecision(e, state)
+		}
 	}
+	listHandler(w, r)
+}
 
-	fmt.Printf("Set state for %s from %s to %s.\n", id, oldState, allExpense[id])
+// apiHandler routes the JSON API requests:
+//
+//	GET  /api/expenses                  lists the expenses
+//	POST /api/expenses                  creates an expense, the body is {"id": "..."}
+//	GET  /api/expenses/{id}             returns an expense
+//	POST /api/expenses/{id}/callback    registers the task token of the activity waiting for the decision
+//	POST /api/expenses/{id}/pay         pays an expense, see payHandler
+//	POST /api/expenses/{id}/refund      refunds the payment of an expense
+//	POST /api/expenses/{id}/{action}    approves, rejects or completes an expense, action is approve, reject or complete
+func apiHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/expenses"), "/")
+	var parts []string
+	if path != "" {
+		parts = strings.Split(path, "/")
+	}
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		all, err := expenses.List()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, all)
+	case len(parts) == 0 && r.Method == http.MethodPost:
+		createHandler(w, r)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		e, err := expenses.Get(parts[0])
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, e)
+	case len(parts) == 2 && r.Method == http.MethodPost && parts[1] == "callback":
+		callbackHandler(w, r, parts[0])
+	case len(parts) == 2 && r.Method == http.MethodPost && parts[1] == "pay":
+		payHandler(w, r, parts[0])
+	case len(parts) == 2 && r.Method == http.MethodPost && parts[1] == "refund":
+		refundHandler(w, r, parts[0])
+	case len(parts) == 2 && r.Method == http.MethodPost:
+		stateHandler(w, parts[0], parts[1])
+	case len(parts) <= 2:
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+	default:
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "not found"})
+	}
 }
 
 func createHandler(w http.ResponseWriter, r *http.Request) {
-	isAPICall := r.URL.Query().Get("is_api_call") == "true"
-	id := r.URL.Query().Get("id")
-	_, ok := allExpense[id]
-	if ok {
-		_, _ = fmt.Fprint(w, "ERROR:ID_ALREADY_EXISTS")
+	var e expenseReport
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil || e.ID == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid expense"})
 		return
 	}
-
-	allExpense[id] = created
-	if isAPICall {
-		_, _ = fmt.Fprint(w, "SUCCEED")
-	} else {
-		listHandler(w, r)
+	e = expenseReport{ID: e.ID, State: created}
+	if err := expenses.Create(e); err != nil {
+		writeError(w, err)
+		return
 	}
-	fmt.Printf("Created new expense id:%s.\n", id)
+	writeJSON(w, http.StatusCreated, e)
+	fmt.Printf("Created new expense id:%s.\n", e.ID)
 }
 
-func statusHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("id")
-	state, ok := allExpense[id]
-	if !ok {
-		_, _ = fmt.Fprint(w, "ERROR:INVALID_ID")
+func callbackHandler(w http.ResponseWriter, r *http.Request, id string) {
+	var request callbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || len(request.TaskToken) == 0 {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid task token"})
 		return
 	}
-
-	_, _ = fmt.Fprint(w, state)
-	fmt.Printf("Checking status for %s: %s\n", id, state)
+	e, err := expenses.Update(id, func(e *expenseReport) error {
+		if e.State != created {
+			return errInvalidState
+		}
+		e.TaskToken = request.TaskToken
+		return nil
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, e)
+	fmt.Printf("Registered callback for ID=%s\n", id)
 }
 
-func callbackHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("id")
-	currState, ok := allExpense[id]
-	if !ok {
-		_, _ = fmt.Fprint(w, "ERROR:INVALID_ID")
+// stateHandler applies the state changes requested by the workflow
+func stateHandler(w http.ResponseWriter, id, action string) {
+	var state expenseState
+	switch action {
+	case "approve":
+		state = approved
+	case "reject":
+		state = rejected
+	case "complete":
+		state = completed
+	default:
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "unknown action " + action})
 		return
 	}
-	if currState != created {
-		_, _ = fmt.Fprint(w, "ERROR:INVALID_STATE")
+	var oldState expenseState
+	e, err := expenses.Update(id, func(e *expenseReport) error {
+		oldState = e.State
+		if !validTransition(e.State, state) {
+			return errInvalidState
+		}
+		if state == completed && (e.Payment == nil || e.Payment.Status != paid) {
+			return errPaymentRequired
+		}
+		e.State = state
+		e.TaskToken = nil
+		return nil
+	})
+	if err != nil {
+		writeError(w, err)
 		return
 	}
+	writeJSON(w, http.StatusOK, e)
+	fmt.Printf("Set state for %s from %s to %s.\n", id, oldState, e.State)
+}
 
-	err := r.ParseForm()
-	if err != nil {
-		// Handle error here via logging and then return
-		_, _ = fmt.Fprint(w, "ERROR:INVALID_FORM_DATA")
-		return
+// validTransition returns whether the expense can move from one state to the other. Setting the current
+// state again is allowed so that retried requests succeed.
+func validTransition(from, to expenseState) bool {
+	switch to {
+	case from:
+		return true
+	case approved, rejected:
+		return from == created
+	case completed:
+		return from == created || from == approved
 	}
+	return false
+}
 
-	taskToken := r.PostFormValue("task_token")
-	fmt.Printf("Registered callback for ID=%s, token=%s\n", id, taskToken)
-	tokenMap[id] = []byte(taskToken)
-	_, _ = fmt.Fprint(w, "SUCCEED")
+// signalDecision signals the decision made at a level of the approval chain to the workflow
+func signalDecision(id string, state expenseState, query url.Values) {
+	decision := expense.Decision{
+		Status:   string(state),
+		Approver: query.Get("approver"),
+		Level:    expense.ApprovalLevel(query.Get("level")),
+	}
+	err := workflowClient.SignalWorkflow(context.Background(), expense.WorkflowID(id), "", expense.DecisionSignalName, decision)
+	if err != nil {
+		fmt.Printf("Failed to signal workflow with error: %+v\n", err)
+	} else {
+		fmt.Printf("Successfully signaled decision for ID=%s: %+v\n", id, decision)
+	}
 }
 
-func notifyExpenseStateChange(id, state string) {
-	token, ok := tokenMap[id]
-	if !ok {
-		fmt.Printf("Invalid id:%s\n", id)
+// completeDecision completes the activity waiting for the decision. The task token is only removed from the
+// store once the activity is completed, so a failure or a restart doesn't orphan it.
+func completeDecision(e expenseReport, state expenseState) {
+	err := workflowClient.CompleteActivity(context.Background(), e.TaskToken, string(state), nil)
+	if err != nil {
+		fmt.Printf("Failed to complete activity with error: %+v\n", err)
 		return
 	}
-	err := workflowClient.CompleteActivity(context.Background(), token, state, nil)
+	fmt.Printf("Successfully complete activity for ID=%s\n", e.ID)
+	_, err = expenses.Update(e.ID, func(e *expenseReport) error {
+		if e.State != created {
+			return errInvalidState
+		}
+		e.State = state
+		e.TaskToken = nil
+		return nil
+	})
 	if err != nil {
-		fmt.Printf("Failed to complete activity with error: %+v\n", err)
-	} else {
-		fmt.Printf("Successfully complete activity: %s\n", token)
+		fmt.Printf("Failed to set state for %s: %+v\n", e.ID, err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	writeJSON(w, errorStatus(err), errorResponse{Error: err.Error()})
+}
+
+// errorStatus maps the store errors to status codes
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, errNotFound), errors.Is(err, errPaymentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errAlreadyExists), errors.Is(err, errInvalidState), errors.Is(err, errAlreadyPaid),
+		errors.Is(err, errPaymentRequired):
+		return http.StatusConflict
 	}
+	return http.StatusInternalServerError
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/pborman/uuid"
+)
+
+type paymentStatus string
+
+const (
+	paid     paymentStatus = "PAID"
+	refunded paymentStatus = "REFUNDED"
+)
+
+// idempotencyKeyHeader is the header carrying the idempotency key of payment requests
+const idempotencyKeyHeader = "Idempotency-Key"
+
+type (
+	// payment of an expense
+	payment struct {
+		ID       string        `json:"id"`
+		Amount   int64         `json:"amount"`
+		Currency string        `json:"currency"`
+		Status   paymentStatus `json:"status"`
+		// IdempotencyKey of the request that created the payment
+		IdempotencyKey string `json:"-"`
+	}
+
+	// paymentRequest is the body of POST /api/expenses/{id}/pay
+	paymentRequest struct {
+		Amount   int64  `json:"amount"`
+		Currency string `json:"currency"`
+	}
+
+	// refundRequest is the body of POST /api/expenses/{id}/refund
+	refundRequest struct {
+		PaymentID string `json:"paymentId"`
+	}
+)
+
+var (
+	errAlreadyPaid           = errors.New("expense already paid")
+	errPaymentNotFound       = errors.New("payment not found")
+	errPaymentRequired       = errors.New("expense is not paid")
+	errInvalidPayment        = errors.New("invalid payment")
+	errMissingIdempotencyKey = errors.New(idempotencyKeyHeader + " header is missing")
+)
+
+// payHandler pays the expense. A request with the idempotency key of the existing payment returns it instead of
+// paying twice, any other key is rejected with errAlreadyPaid.
+func payHandler(w http.ResponseWriter, r *http.Request, id string) {
+	key := r.Header.Get(idempotencyKeyHeader)
+	if key == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: errMissingIdempotencyKey.Error()})
+		return
+	}
+	var request paymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Amount <= 0 || request.Currency == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: errInvalidPayment.Error()})
+		return
+	}
+
+	replayed := false
+	e, err := expenses.Update(id, func(e *expenseReport) error {
+		if e.Payment != nil {
+			if e.Payment.IdempotencyKey != key {
+				return errAlreadyPaid
+			}
+			replayed = true
+			return nil
+		}
+		if e.State != created && e.State != approved {
+			return errInvalidState
+		}
+		e.Payment = &payment{
+			ID:             uuid.New(),
+			Amount:         request.Amount,
+			Currency:       request.Currency,
+			Status:         paid,
+			IdempotencyKey: key,
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+		writeJSON(w, http.StatusOK, e.Payment)
+		fmt.Printf("Replayed payment %s for ID=%s\n", e.Payment.ID, id)
+		return
+	}
+	writeJSON(w, http.StatusCreated, e.Payment)
+	fmt.Printf("Paid %d %s for ID=%s, payment %s\n", e.Payment.Amount, e.Payment.Currency, id, e.Payment.ID)
+}
+
+// refundHandler refunds the payment of the expense, refunding it again has no effect
+func refundHandler(w http.ResponseWriter, r *http.Request, id string) {
+	var request refundRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.PaymentID == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: errInvalidPayment.Error()})
+		return
+	}
+	e, err := expenses.Update(id, func(e *expenseReport) error {
+		if e.Payment == nil || e.Payment.ID != request.PaymentID {
+			return errPaymentNotFound
+		}
+		e.Payment.Status = refunded
+		return nil
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, e.Payment)
+	fmt.Printf("Refunded payment %s for ID=%s\n", e.Payment.ID, id)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer serves the API from a memory store holding the expenses, for the duration of the test
+func newTestServer(t *testing.T, reports ...expenseReport) *httptest.Server {
+	previous := expenses
+	expenses = newMemoryStore()
+	for _, e := range reports {
+		require.NoError(t, expenses.Create(e))
+	}
+	server := httptest.NewServer(http.HandlerFunc(apiHandler))
+	t.Cleanup(func() {
+		server.Close()
+		expenses = previous
+	})
+	return server
+}
+
+// post sends the body to the API and decodes the response into response
+func post(t *testing.T, url, idempotencyKey, body string, response interface{}) *http.Response {
+	request, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	require.NoError(t, err)
+	if idempotencyKey != "" {
+		request.Header.Set(idempotencyKeyHeader, idempotencyKey)
+	}
+	resp, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(response))
+	return resp
+}
+
+func Test_PayIdempotencyKey(t *testing.T) {
+	server := newTestServer(t, expenseReport{ID: "1", State: approved})
+	url := server.URL + "/api/expenses/1/pay"
+
+	var first payment
+	resp := post(t, url, "key", `{"amount": 100, "currency": "USD"}`, &first)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Empty(t, resp.Header.Get("Idempotent-Replayed"))
+	require.Equal(t, paid, first.Status)
+
+	// the same key returns the existing payment
+	var replayed payment
+	resp = post(t, url, "key", `{"amount": 100, "currency": "USD"}`, &replayed)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "true", resp.Header.Get("Idempotent-Replayed"))
+	require.Equal(t, first, replayed)
+
+	// another key does not pay twice
+	var errResp errorResponse
+	resp = post(t, url, "other", `{"amount": 100, "currency": "USD"}`, &errResp)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	require.Equal(t, errAlreadyPaid.Error(), errResp.Error)
+
+	resp = post(t, url, "", `{"amount": 100, "currency": "USD"}`, &errResp)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Equal(t, errMissingIdempotencyKey.Error(), errResp.Error)
+
+	e, err := expenses.Get("1")
+	require.NoError(t, err)
+	require.Equal(t, first.ID, e.Payment.ID)
+}
+
+func Test_Refund(t *testing.T) {
+	server := newTestServer(t, expenseReport{ID: "1", State: approved})
+
+	// an unpaid expense cannot be refunded
+	var errResp errorResponse
+	resp := post(t, server.URL+"/api/expenses/1/refund", "", `{"paymentId": "payment"}`, &errResp)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.Equal(t, errPaymentNotFound.Error(), errResp.Error)
+	e, err := expenses.Get("1")
+	require.NoError(t, err)
+	require.Nil(t, e.Payment)
+
+	var p payment
+	resp = post(t, server.URL+"/api/expenses/1/pay", "key", `{"amount": 100, "currency": "USD"}`, &p)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp = post(t, server.URL+"/api/expenses/1/refund", "", `{"paymentId": "other"}`, &errResp)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// refunding again has no effect
+	for i := 0; i < 2; i++ {
+		var refundedPayment payment
+		resp = post(t, server.URL+"/api/expenses/1/refund", "", `{"paymentId": "`+p.ID+`"}`, &refundedPayment)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, p.ID, refundedPayment.ID)
+		require.Equal(t, refunded, refundedPayment.Status)
+	}
+
+	resp = post(t, server.URL+"/api/expenses/2/refund", "", `{"paymentId": "`+p.ID+`"}`, &errResp)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.Equal(t, errNotFound.Error(), errResp.Error)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"sort"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type (
+	// expenseReport is an expense report stored by the server
+	expenseReport struct {
+		ID    string       `json:"id"`
+		State expenseState `json:"state"`
+		// TaskToken of the activity waiting for the decision, if a callback was registered
+		TaskToken []byte   `json:"-"`
+		Payment   *payment `json:"payment,omitempty"`
+	}
+
+	// store persists the expenses. Implementations are safe for concurrent use.
+	store interface {
+		// Create stores a new expense, it returns errAlreadyExists if the ID is taken
+		Create(e expenseReport) error
+		// Get returns the expense, or errNotFound
+		Get(id string) (expenseReport, error)
+		// List returns every expense, sorted by ID
+		List() ([]expenseReport, error)
+		// Update atomically applies fn to the expense and stores the result unless fn returns an error
+		Update(id string, fn func(e *expenseReport) error) (expenseReport, error)
+		Close() error
+	}
+
+	// memoryStore keeps the expenses in memory, they are lost when the server stops
+	memoryStore struct {
+		mu       sync.Mutex
+		expenses map[string]expenseReport
+	}
+
+	// boltStore keeps the expenses in a BoltDB file, so registered callbacks survive restarts
+	boltStore struct {
+		db *bolt.DB
+	}
+)
+
+var (
+	errNotFound      = errors.New("expense not found")
+	errAlreadyExists = errors.New("expense already exists")
+	errInvalidState  = errors.New("invalid expense state")
+
+	expensesBucket = []byte("expenses")
+)
+
+func newMemoryStore() store {
+	return &memoryStore{expenses: make(map[string]expenseReport)}
+}
+
+func (s *memoryStore) Create(e expenseReport) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.expenses[e.ID]; ok {
+		return errAlreadyExists
+	}
+	s.expenses[e.ID] = e
+	return nil
+}
+
+func (s *memoryStore) Get(id string) (expenseReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.expenses[id]
+	if !ok {
+		return expenseReport{}, errNotFound
+	}
+	return e, nil
+}
+
+func (s *memoryStore) List() ([]expenseReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]expenseReport, 0, len(s.expenses))
+	for _, e := range s.expenses {
+		result = append(result, e)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func (s *memoryStore) Update(id string, fn func(e *expenseReport) error) (expenseReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.expenses[id]
+	if !ok {
+		return expenseReport{}, errNotFound
+	}
+	if err := fn(&e); err != nil {
+		return expenseReport{}, err
+	}
+	s.expenses[id] = e
+	return e, nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+// newBoltStore opens, or creates, the BoltDB file at path
+func newBoltStore(path string) (store, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(expensesBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) Create(e expenseReport) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(expensesBucket)
+		if bucket.Get([]byte(e.ID)) != nil {
+			return errAlreadyExists
+		}
+		return putExpense(bucket, e)
+	})
+}
+
+func (s *boltStore) Get(id string) (expenseReport, error) {
+	var e expenseReport
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		e, err = getExpense(tx.Bucket(expensesBucket), id)
+		return err
+	})
+	return e, err
+}
+
+func (s *boltStore) List() ([]expenseReport, error) {
+	var result []expenseReport
+	err := s.db.View(func(tx *bolt.Tx) error {
+		// keys are sorted, so are the expenses
+		return tx.Bucket(expensesBucket).ForEach(func(_, value []byte) error {
+			var e expenseReport
+			if err := gob.NewDecoder(bytes.NewReader(value)).Decode(&e); err != nil {
+				return err
+			}
+			result = append(result, e)
+			return nil
+		})
+	})
+	return result, err
+}
+
+func (s *boltStore) Update(id string, fn func(e *expenseReport) error) (expenseReport, error) {
+	var e expenseReport
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(expensesBucket)
+		var err error
+		if e, err = getExpense(bucket, id); err != nil {
+			return err
+		}
+		if err := fn(&e); err != nil {
+			return err
+		}
+		return putExpense(bucket, e)
+	})
+	if err != nil {
+		return expenseReport{}, err
+	}
+	return e, nil
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+func getExpense(bucket *bolt.Bucket, id string) (expenseReport, error) {
+	value := bucket.Get([]byte(id))
+	if value == nil {
+		return expenseReport{}, errNotFound
+	}
+	var e expenseReport
+	err := gob.NewDecoder(bytes.NewReader(value)).Decode(&e)
+	return e, err
+}
+
+func putExpense(bucket *bolt.Bucket, e expenseReport) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(e); err != nil {
+		return err
+	}
+	return bucket.Put([]byte(e.ID), buf.Bytes())
+}
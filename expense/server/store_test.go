@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Store(t *testing.T) {
+	for name, open := range map[string]func(t *testing.T) (s store, reopen func() store){
+		"memory": func(t *testing.T) (store, func() store) {
+			return newMemoryStore(), nil
+		},
+		"bolt": func(t *testing.T) (store, func() store) {
+			path := filepath.Join(t.TempDir(), "expense.db")
+			s, err := newBoltStore(path)
+			require.NoError(t, err)
+			return s, func() store {
+				s, err := newBoltStore(path)
+				require.NoError(t, err)
+				return s
+			}
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, reopen := open(t)
+
+			all, err := s.List()
+			require.NoError(t, err)
+			require.Empty(t, all)
+			_, err = s.Get("1")
+			require.ErrorIs(t, err, errNotFound)
+
+			require.NoError(t, s.Create(expenseReport{ID: "2", State: created}))
+			require.NoError(t, s.Create(expenseReport{ID: "1", State: created, TaskToken: []byte("token")}))
+			require.ErrorIs(t, s.Create(expenseReport{ID: "1", State: approved}), errAlreadyExists)
+
+			e, err := s.Get("1")
+			require.NoError(t, err)
+			require.Equal(t, expenseReport{ID: "1", State: created, TaskToken: []byte("token")}, e)
+
+			e, err = s.Update("1", func(e *expenseReport) error {
+				e.State = approved
+				e.Payment = &payment{ID: "payment", Amount: 100, Currency: "USD", Status: paid, IdempotencyKey: "key"}
+				return nil
+			})
+			require.NoError(t, err)
+			updated := expenseReport{
+				ID:        "1",
+				State:     approved,
+				TaskToken: []byte("token"),
+				Payment:   &payment{ID: "payment", Amount: 100, Currency: "USD", Status: paid, IdempotencyKey: "key"},
+			}
+			require.Equal(t, updated, e)
+
+			// a failed update is not stored
+			_, err = s.Update("1", func(e *expenseReport) error {
+				e.State = rejected
+				return errInvalidState
+			})
+			require.ErrorIs(t, err, errInvalidState)
+			_, err = s.Update("3", func(e *expenseReport) error {
+				return errors.New("not called")
+			})
+			require.ErrorIs(t, err, errNotFound)
+
+			expected := []expenseReport{updated, {ID: "2", State: created}}
+			all, err = s.List()
+			require.NoError(t, err)
+			require.Equal(t, expected, all)
+			require.NoError(t, s.Close())
+
+			// the expenses survive restarts
+			if reopen == nil {
+				return
+			}
+			s = reopen()
+			defer func() { require.NoError(t, s.Close()) }()
+			all, err = s.List()
+			require.NoError(t, err)
+			require.Equal(t, expected, all)
+			e, err = s.Get("1")
+			require.NoError(t, err)
+			require.Equal(t, updated, e)
+		})
+	}
+}
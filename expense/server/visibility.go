@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/converter"
+
+	"github.com/temporalio/samples-go/expense"
+)
+
+// namespace of the expense workflows
+const namespace = "default"
+
+// expenseRow is a row of the HTML list page
+type expenseRow struct {
+	ID       string
+	Status   string
+	Amount   string
+	Approver string
+	// Pending is set when the expense waits for a decision
+	Pending bool
+}
+
+// listFromStore returns the rows of the expenses kept by the server
+func listFromStore() ([]expenseRow, error) {
+	all, err := expenses.List()
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]expenseRow, 0, len(all))
+	for _, e := range all {
+		rows = append(rows, expenseRow{ID: e.ID, Status: string(e.State), Pending: e.State == created})
+	}
+	return rows, nil
+}
+
+// listFromVisibility returns the rows of the expense workflows, built from the search attributes they upsert.
+// It requires advanced visibility, i.e. Elasticsearch, and the search attributes to be registered.
+func listFromVisibility(ctx context.Context) ([]expenseRow, error) {
+	var rows []expenseRow
+	var nextPageToken []byte
+	for hasMore := true; hasMore; hasMore = len(nextPageToken) > 0 {
+		resp, err := workflowClient.ListWorkflow(ctx, &workflowservice.ListWorkflowExecutionsRequest{
+			Namespace:     namespace,
+			PageSize:      100,
+			NextPageToken: nextPageToken,
+			Query:         "WorkflowType = 'SampleExpenseWorkflow' order by StartTime desc",
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, execution := range resp.Executions {
+			fields := execution.GetSearchAttributes().GetIndexedFields()
+			var status, approver string
+			var amount int64
+			if payload, ok := fields[expense.SearchAttributeStatus]; ok {
+				_ = converter.GetDefaultDataConverter().FromPayload(payload, &status)
+			}
+			if payload, ok := fields[expense.SearchAttributeAmount]; ok {
+				_ = converter.GetDefaultDataConverter().FromPayload(payload, &amount)
+			}
+			if payload, ok := fields[expense.SearchAttributeApprover]; ok {
+				_ = converter.GetDefaultDataConverter().FromPayload(payload, &approver)
+			}
+			rows = append(rows, expenseRow{
+				ID:       strings.TrimPrefix(execution.GetExecution().GetWorkflowId(), expense.WorkflowID("")),
+				Status:   status,
+				Amount:   formatAmount(amount),
+				Approver: approver,
+				Pending:  status == expense.StatusPendingApproval,
+			})
+		}
+		nextPageToken = resp.NextPageToken
+	}
+	return rows, nil
+}
+
+// formatAmount formats an amount in cents with two decimals, e.g. -150 as -1.50
+func formatAmount(amount int64) string {
+	sign := ""
+	abs := uint64(amount)
+	if amount < 0 {
+		sign = "-"
+		abs = uint64(-(amount + 1)) + 1
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, abs/100, abs%100)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FormatAmount(t *testing.T) {
+	for amount, expected := range map[int64]string{
+		0:             "0.00",
+		5:             "0.05",
+		150:           "1.50",
+		-5:            "-0.05",
+		-150:          "-1.50",
+		math.MinInt64: "-92233720368547758.08",
+	} {
+		require.Equal(t, expected, formatAmount(amount))
+	}
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
+	"time"
 
 	"github.com/pborman/uuid"
 	"go.temporal.io/sdk/client"
@@ -11,6 +13,23 @@ import (
 )
 
 func main() {
+	var e expense.Expense
+	var options expense.ApprovalOptions
+	var mode string
+	flag.Int64Var(&e.Amount, "amount", 25000, "Amount in cents.")
+	flag.StringVar(&e.Currency, "currency", "USD", "Currency.")
+	flag.StringVar(&e.Category, "category", "travel", "Category.")
+	flag.StringVar(&e.Submitter, "submitter", "sample-user", "Submitter.")
+	flag.StringVar(&mode, "m", string(expense.ApprovalModeSignal), "Approval mode (signal|async-activity).")
+	flag.BoolVar(&options.Policy.Parallel, "p", false, "Request the approvals of the chain in parallel.")
+	flag.StringVar(&options.EscalationApprover, "e", "vp", "Escalation approver, empty to disable escalation.")
+	flag.DurationVar(&options.ReminderInterval, "r", time.Minute, "Reminder interval.")
+	flag.DurationVar(&options.EscalationDelay, "ed", 3*time.Minute, "Escalation delay.")
+	flag.DurationVar(&options.Deadline, "d", 10*time.Minute, "Deadline after which the expense is rejected.")
+	flag.BoolVar(&options.UpsertSearchAttributes, "sa", false, "Upsert the search attributes of the expense, they must be registered.")
+	flag.Parse()
+	options.Mode = expense.ApprovalMode(mode)
+
 	// The client is a heavyweight object that should be created once per process.
 	c, err := client.NewClient(client.Options{
 		HostPort: client.DefaultHostPort,
@@ -20,13 +39,13 @@ func main() {
 	}
 	defer c.Close()
 
-	expenseID := uuid.New()
+	e.ID = uuid.New()
 	workflowOptions := client.StartWorkflowOptions{
-		ID:        "expense_" + expenseID,
+		ID:        expense.WorkflowID(e.ID),
 		TaskQueue: "expense",
 	}
 
-	we, err := c.ExecuteWorkflow(context.Background(), workflowOptions, expense.SampleExpenseWorkflow, expenseID)
+	we, err := c.ExecuteWorkflow(context.Background(), workflowOptions, expense.SampleExpenseWorkflow, e, options)
 	if err != nil {
 		log.Fatalln("Unable to execute workflow", err)
 	}
@@ -25,6 +25,10 @@ func main() {
 	w.RegisterActivity(expense.CreateExpenseActivity)
 	w.RegisterActivity(expense.WaitForDecisionActivity)
 	w.RegisterActivity(expense.PaymentActivity)
+	w.RegisterActivity(expense.CompleteExpenseActivity)
+	w.RegisterActivity(expense.RefundPaymentActivity)
+	w.RegisterActivity(expense.NotifyApproverActivity)
+	w.RegisterActivity(expense.RejectExpenseActivity)
 
 	err = w.Run(worker.InterruptCh())
 	if err != nil {
@@ -1,8 +1,11 @@
 package expense
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
+	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/workflow"
 )
 
@@ -10,8 +13,149 @@ var (
 	expenseServerHostPort = "http://localhost:8099"
 )
 
+// DecisionSignalName is the name of the signal the expense server sends with the Decision once the
+// expense is approved or rejected
+const DecisionSignalName = "expense-decision"
+
+// StateQueryName is the name of the query returning the ExpenseState, including the status timeline
+const StateQueryName = "expense-state"
+
+// Expense statuses
+const (
+	StatusCreated         = "CREATED"
+	StatusPendingApproval = "PENDING_APPROVAL"
+	StatusApproved        = "APPROVED"
+	StatusRejected        = "REJECTED"
+	StatusPaid            = "PAID"
+	StatusPaymentFailed   = "PAYMENT_FAILED"
+	StatusRefunded        = "REFUNDED"
+	StatusCompleted       = "COMPLETED"
+)
+
+// Search attributes upserted by the workflow when ApprovalOptions.UpsertSearchAttributes is set, they must be
+// registered on the Temporal server, see README.md
+const (
+	// SearchAttributeStatus is the current status of the expense, a Keyword
+	SearchAttributeStatus = "ExpenseStatus"
+	// SearchAttributeAmount is the amount of the expense in the smallest unit of the currency, an Int
+	SearchAttributeAmount = "ExpenseAmount"
+	// SearchAttributeApprover is the approver of the last decision, a Keyword
+	SearchAttributeApprover = "ExpenseApprover"
+)
+
+// ApprovalMode selects how the workflow waits for the expense decision
+type ApprovalMode string
+
+const (
+	// ApprovalModeSignal waits for a DecisionSignalName signal per level of the approval chain, sending
+	// reminders, escalating to a second approver and rejecting the expense once the deadline is reached
+	ApprovalModeSignal ApprovalMode = "signal"
+	// ApprovalModeAsyncActivity waits for WaitForDecisionActivity to be completed asynchronously by the
+	// expense server, the expense is rejected if the activity doesn't complete before the deadline.
+	// The single decision applies to every level of the approval chain.
+	ApprovalModeAsyncActivity ApprovalMode = "async-activity"
+)
+
+// Default approval options
+const (
+	DefaultReminderInterval = time.Hour
+	DefaultEscalationDelay  = 24 * time.Hour
+	DefaultApprovalDeadline = 72 * time.Hour
+)
+
+type (
+	// Expense is the expense report processed by the workflow
+	Expense struct {
+		ID string
+		// Amount in the smallest unit of the currency, e.g. cents
+		Amount    int64
+		Currency  string
+		Category  string
+		Submitter string
+	}
+
+	// ApprovalOptions configures how the workflow waits for the expense decision.
+	// Zero values are replaced by the defaults.
+	ApprovalOptions struct {
+		Mode ApprovalMode
+		// Policy computes the approval chain, DefaultApprovalPolicy is used if it has no rules
+		Policy ApprovalPolicy
+		// Approvers maps the levels of the approval chain to the approver that is notified and reminded
+		// until it decides, the name of the level is used for missing levels
+		Approvers map[ApprovalLevel]string
+		// EscalationApprover is notified once EscalationDelay elapsed without decision at a level of the
+		// approval chain, no escalation happens if it is empty
+		EscalationApprover string
+		ReminderInterval   time.Duration
+		EscalationDelay    time.Duration
+		// Deadline after which the expense is automatically rejected
+		Deadline time.Duration
+		// UpsertSearchAttributes upserts the search attributes of the expense on every change, so the expenses can
+		// be listed from Temporal visibility. The search attributes must be registered on the Temporal server.
+		UpsertSearchAttributes bool
+	}
+
+	// Decision is the payload of the DecisionSignalName signal
+	Decision struct {
+		// Status is either APPROVED or REJECTED
+		Status   string
+		Approver string
+		// Level of the approval chain the decision is made for, the first pending level if empty
+		Level ApprovalLevel
+	}
+
+	// Approval records the decision made at a level of the approval chain
+	Approval struct {
+		Level    ApprovalLevel
+		Approver string
+		// Status is either APPROVED or REJECTED
+		Status string
+		Time   time.Time
+	}
+
+	// StatusChange is an entry of the status timeline of an expense
+	StatusChange struct {
+		Status  string
+		Time    time.Time
+		Details string
+	}
+
+	// ExpenseState is the state of the expense workflow, returned by the StateQueryName query
+	ExpenseState struct {
+		Expense   Expense
+		Chain     []ApprovalLevel
+		Approvals []Approval
+		Status    string
+		Timeline  []StatusChange
+		// upsert the search attributes, see ApprovalOptions.UpsertSearchAttributes
+		upsert bool
+	}
+)
+
+// WorkflowID returns the ID of the workflow processing the expense, the expense server uses it to signal
+// the decision
+func WorkflowID(expenseID string) string {
+	return "expense_" + expenseID
+}
+
 // SampleExpenseWorkflow workflow definition
-func SampleExpenseWorkflow(ctx workflow.Context, expenseID string) (result string, err error) {
+func SampleExpenseWorkflow(ctx workflow.Context, expense Expense, options ApprovalOptions) (result string, err error) {
+	if len(expense.ID) == 0 {
+		return "", errors.New("expense id is empty")
+	}
+	options = options.withDefaults()
+	state := &ExpenseState{
+		Expense: expense,
+		Chain:   options.Policy.ApprovalChain(expense),
+		upsert:  options.UpsertSearchAttributes,
+	}
+	err = workflow.SetQueryHandler(ctx, StateQueryName, func() (ExpenseState, error) {
+		return *state, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
 	// step 1, create new expense report
 	ao := workflow.ActivityOptions{
 		ScheduleToStartTimeout: time.Minute,
@@ -21,39 +165,338 @@ func SampleExpenseWorkflow(ctx workflow.Context, expenseID string) (result strin
 	ctx1 := workflow.WithActivityOptions(ctx, ao)
 	logger := workflow.GetLogger(ctx)
 
-	err = workflow.ExecuteActivity(ctx1, CreateExpenseActivity, expenseID).Get(ctx1, nil)
+	err = workflow.ExecuteActivity(ctx1, CreateExpenseActivity, expense.ID).Get(ctx1, nil)
 	if err != nil {
 		logger.Error("Failed to create expense report", "Error", err)
 		return "", err
 	}
+	state.setStatus(ctx, StatusCreated, "")
 
-	// step 2, wait for the expense report to be approved (or rejected)
-	ao = workflow.ActivityOptions{
-		ScheduleToStartTimeout: 10 * time.Minute,
-		StartToCloseTimeout:    10 * time.Minute,
-	}
-	ctx2 := workflow.WithActivityOptions(ctx, ao)
-	// Notice that we set the timeout to be 10 minutes for this sample demo. If the expected time for the activity to
-	// complete (waiting for human to approve the request) is longer, you should set the timeout accordingly so the
-	// Temporal system will wait accordingly. Otherwise, Temporal system could mark the activity as failure by timeout.
+	// step 2, wait for the expense report to be approved (or rejected) by every level of the approval chain
+	logger.Info("Waiting for approvals.", "ExpenseID", expense.ID, "Chain", state.Chain)
+	state.setStatus(ctx, StatusPendingApproval, fmt.Sprintf("approval chain %v", state.Chain))
 	var status string
-	err = workflow.ExecuteActivity(ctx2, WaitForDecisionActivity, expenseID).Get(ctx2, &status)
+	if options.Mode == ApprovalModeAsyncActivity {
+		status, err = waitForDecisionActivity(ctx, state, options)
+	} else {
+		status, err = waitForDecisionSignal(ctx, state, options)
+	}
 	if err != nil {
 		return "", err
 	}
+	details := ""
+	if status == "" {
+		logger.Info("Expense decision deadline reached.", "ExpenseID", expense.ID)
+		status, details = StatusRejected, "deadline reached"
+	}
+	state.setStatus(ctx, status, details)
 
-	if status != "APPROVED" {
-		logger.Info("Workflow completed.", "ExpenseStatus", status)
+	if status != StatusApproved {
+		if err := rejectExpense(ctx, expense.ID); err != nil {
+			return "", err
+		}
+		logger.Info("Workflow completed.", "ExpenseStatus", status, "Approvals", state.Approvals)
 		return "", nil
 	}
 
 	// step 3, request payment to the expense
-	err = workflow.ExecuteActivity(ctx2, PaymentActivity, expenseID).Get(ctx2, nil)
+	ao = workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute,
+		RetryPolicy: &temporal.RetryPolicy{
+			InitialInterval:    time.Second,
+			BackoffCoefficient: 2.0,
+			MaximumInterval:    time.Minute,
+			MaximumAttempts:    5,
+		},
+	}
+	ctx3 := workflow.WithActivityOptions(ctx, ao)
+	var payment Payment
+	err = workflow.ExecuteActivity(ctx3, PaymentActivity, expense).Get(ctx3, &payment)
 	if err != nil {
 		logger.Info("Workflow completed with payment failed.", "Error", err)
+		state.setStatus(ctx, StatusPaymentFailed, err.Error())
+		return "", err
+	}
+	state.setStatus(ctx, StatusPaid, "payment "+payment.ID)
+
+	// step 4, complete the expense, the payment is refunded if it fails
+	err = workflow.ExecuteActivity(ctx3, CompleteExpenseActivity, expense.ID).Get(ctx3, nil)
+	if err != nil {
+		logger.Error("Failed to complete expense, refunding payment.", "PaymentID", payment.ID, "Error", err)
+		// the compensation must run even if the workflow is canceled
+		refundCtx, _ := workflow.NewDisconnectedContext(ctx3)
+		if refundErr := workflow.ExecuteActivity(refundCtx, RefundPaymentActivity, expense.ID, payment.ID).Get(refundCtx, nil); refundErr != nil {
+			logger.Error("Failed to refund payment.", "PaymentID", payment.ID, "Error", refundErr)
+		} else {
+			state.setStatus(refundCtx, StatusRefunded, "payment "+payment.ID)
+		}
+		return "", err
+	}
+	state.setStatus(ctx, StatusCompleted, "")
+
+	logger.Info("Workflow completed with expense payment completed.", "Approvals", state.Approvals)
+	return StatusCompleted, nil
+}
+
+// setStatus records the status change in the timeline and upserts the search attributes
+func (s *ExpenseState) setStatus(ctx workflow.Context, status, details string) {
+	s.Status = status
+	s.Timeline = append(s.Timeline, StatusChange{Status: status, Time: workflow.Now(ctx), Details: details})
+	s.upsertSearchAttributes(ctx)
+}
+
+// upsertSearchAttributes upserts the search attributes if enabled, a failure is logged as the expense can be
+// processed without them
+func (s *ExpenseState) upsertSearchAttributes(ctx workflow.Context) {
+	if !s.upsert {
+		return
+	}
+	attributes := map[string]interface{}{
+		SearchAttributeStatus: s.Status,
+		SearchAttributeAmount: s.Expense.Amount,
+	}
+	if len(s.Approvals) > 0 {
+		attributes[SearchAttributeApprover] = s.Approvals[len(s.Approvals)-1].Approver
+	}
+	if err := workflow.UpsertSearchAttributes(ctx, attributes); err != nil {
+		workflow.GetLogger(ctx).Warn("Failed to upsert search attributes.", "Error", err)
+	}
+}
+
+func (o ApprovalOptions) withDefaults() ApprovalOptions {
+	if o.Mode == "" {
+		o.Mode = ApprovalModeSignal
+	}
+	if len(o.Policy.Rules) == 0 {
+		o.Policy.Rules = DefaultApprovalPolicy().Rules
+	}
+	if o.ReminderInterval <= 0 {
+		o.ReminderInterval = DefaultReminderInterval
+	}
+	if o.EscalationDelay <= 0 {
+		o.EscalationDelay = DefaultEscalationDelay
+	}
+	if o.Deadline <= 0 {
+		o.Deadline = DefaultApprovalDeadline
+	}
+	return o
+}
+
+func (o ApprovalOptions) approver(level ApprovalLevel) string {
+	if approver, ok := o.Approvers[level]; ok {
+		return approver
+	}
+	return string(level)
+}
+
+// waitForDecisionActivity waits for WaitForDecisionActivity to be completed by the expense server. Unlike
+// waitForDecisionSignal, there is no reminder nor escalation: the activity just times out at the deadline,
+// in which case an empty status is returned.
+func waitForDecisionActivity(ctx workflow.Context, state *ExpenseState, options ApprovalOptions) (string, error) {
+	// The activity is bounded by the deadline, including its retries, so long approvals don't need a
+	// fixed timeout anymore.
+	ao := workflow.ActivityOptions{
+		ScheduleToCloseTimeout: options.Deadline,
+		StartToCloseTimeout:    options.Deadline,
+	}
+	ctx = workflow.WithActivityOptions(ctx, ao)
+
+	var status string
+	err := workflow.ExecuteActivity(ctx, WaitForDecisionActivity, state.Expense.ID).Get(ctx, &status)
+	if temporal.IsTimeoutError(err) {
+		return "", nil
+	}
+	if err != nil {
 		return "", err
 	}
+	now := workflow.Now(ctx)
+	for _, level := range state.Chain {
+		state.Approvals = append(state.Approvals, Approval{Level: level, Status: status, Time: now})
+	}
+	return status, nil
+}
+
+// waitForDecisionSignal waits for the decision signals of the approval chain, one level after the other
+// or all at once if the policy is parallel. An empty status is returned if the deadline is reached.
+func waitForDecisionSignal(ctx workflow.Context, state *ExpenseState, options ApprovalOptions) (string, error) {
+	deadlineCtx, cancelDeadline := workflow.WithCancel(ctx)
+	defer cancelDeadline()
+	deadline := workflow.NewTimer(deadlineCtx, options.Deadline)
+
+	var steps [][]ApprovalLevel
+	if options.Policy.Parallel {
+		steps = append(steps, state.Chain)
+	} else {
+		for _, level := range state.Chain {
+			steps = append(steps, []ApprovalLevel{level})
+		}
+	}
+	// decisions made for the levels of the later steps, applied once their step starts
+	early := make(map[ApprovalLevel]Decision)
+	for _, levels := range steps {
+		status := waitForApprovals(ctx, state, levels, early, deadline, options)
+		if status != StatusApproved {
+			return status, nil
+		}
+	}
+	return StatusApproved, nil
+}
+
+// waitForApprovals waits until every level is approved, one of them rejects the expense or the deadline
+// is reached. The decisions received earlier for the levels are applied first, the decisions for the
+// levels of the later steps are kept in early. The approvers are reminded every ReminderInterval and the
+// escalation approver is notified after EscalationDelay, without waiting for the notifications.
+func waitForApprovals(ctx workflow.Context, state *ExpenseState, levels []ApprovalLevel, early map[ApprovalLevel]Decision,
+	deadline workflow.Future, options ApprovalOptions) string {
+	logger := workflow.GetLogger(ctx)
+	expenseID := state.Expense.ID
+	pending := append([]ApprovalLevel(nil), levels...)
+
+	var rejected, deadlineReached bool
+	// decide applies the decision if its level is pending, and tells whether it was
+	decide := func(decision Decision) bool {
+		for i, level := range pending {
+			if level != decision.Level {
+				continue
+			}
+			pending = append(pending[:i], pending[i+1:]...)
+			state.Approvals = append(state.Approvals, Approval{
+				Level:    decision.Level,
+				Approver: decision.Approver,
+				Status:   decision.Status,
+				Time:     workflow.Now(ctx),
+			})
+			state.upsertSearchAttributes(ctx)
+			rejected = decision.Status != StatusApproved
+			return true
+		}
+		return false
+	}
+	for _, level := range levels {
+		if decision, ok := early[level]; ok && !rejected {
+			delete(early, level)
+			logger.Info("Applying decision received before the level started.", "Level", level)
+			decide(decision)
+		}
+	}
+	if rejected {
+		return StatusRejected
+	}
+	if len(pending) == 0 {
+		return StatusApproved
+	}
+
+	// Notifications are best effort, a failure must not block the approval.
+	ao := workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute,
+		RetryPolicy: &temporal.RetryPolicy{
+			InitialInterval:    time.Second,
+			BackoffCoefficient: 2.0,
+			MaximumInterval:    time.Minute,
+			MaximumAttempts:    3,
+		},
+	}
+	notifyCtx := workflow.WithActivityOptions(ctx, ao)
+	notify := func(approver, reason string) {
+		future := workflow.ExecuteActivity(notifyCtx, NotifyApproverActivity, expenseID, approver, reason)
+		workflow.Go(notifyCtx, func(ctx workflow.Context) {
+			if err := future.Get(ctx, nil); err != nil {
+				logger.Warn("Failed to notify approver.", "Approver", approver, "Error", err)
+			}
+		})
+	}
+	escalated := false
+	approvers := func() []string {
+		var result []string
+		for _, level := range pending {
+			result = append(result, options.approver(level))
+		}
+		if escalated {
+			result = append(result, options.EscalationApprover)
+		}
+		return result
+	}
+	for _, approver := range approvers() {
+		notify(approver, "approval requested")
+	}
 
-	logger.Info("Workflow completed with expense payment completed.")
-	return "COMPLETED", nil
+	// cancel the pending timers once the decision is made
+	timerCtx, cancelTimers := workflow.WithCancel(ctx)
+	defer cancelTimers()
+
+	selector := workflow.NewSelector(ctx)
+	selector.AddReceive(workflow.GetSignalChannel(ctx, DecisionSignalName), func(c workflow.ReceiveChannel, more bool) {
+		var decision Decision
+		c.Receive(ctx, &decision)
+		if decision.Status != StatusApproved && decision.Status != StatusRejected {
+			logger.Warn("Ignoring decision with invalid status.", "Status", decision.Status)
+			return
+		}
+		if decision.Level == "" {
+			decision.Level = pending[0]
+		}
+		if decide(decision) {
+			return
+		}
+		if state.later(decision.Level) {
+			logger.Info("Keeping decision until the level starts.", "Level", decision.Level)
+			early[decision.Level] = decision
+			return
+		}
+		logger.Warn("Ignoring decision for a level that is not pending.", "Level", decision.Level)
+	})
+	selector.AddFuture(deadline, func(f workflow.Future) {
+		deadlineReached = true
+	})
+	if options.EscalationApprover != "" && options.EscalationDelay < options.Deadline {
+		selector.AddFuture(workflow.NewTimer(timerCtx, options.EscalationDelay), func(f workflow.Future) {
+			logger.Info("Expense decision escalated.", "ExpenseID", expenseID, "Approver", options.EscalationApprover)
+			escalated = true
+			notify(options.EscalationApprover, "approval escalated")
+		})
+	}
+	var remind func(f workflow.Future)
+	remind = func(f workflow.Future) {
+		for _, approver := range approvers() {
+			notify(approver, "approval reminder")
+		}
+		selector.AddFuture(workflow.NewTimer(timerCtx, options.ReminderInterval), remind)
+	}
+	selector.AddFuture(workflow.NewTimer(timerCtx, options.ReminderInterval), remind)
+
+	for len(pending) > 0 && !rejected && !deadlineReached {
+		selector.Select(ctx)
+	}
+	switch {
+	case rejected:
+		return StatusRejected
+	case len(pending) > 0:
+		return ""
+	}
+	return StatusApproved
+}
+
+// later returns whether the level is in the approval chain and was not decided yet
+func (s *ExpenseState) later(level ApprovalLevel) bool {
+	for _, approval := range s.Approvals {
+		if approval.Level == level {
+			return false
+		}
+	}
+	for _, chainLevel := range s.Chain {
+		if chainLevel == level {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectExpense rejects the expense on the expense server
+func rejectExpense(ctx workflow.Context, expenseID string) error {
+	ao := workflow.ActivityOptions{
+		ScheduleToStartTimeout: time.Minute,
+		StartToCloseTimeout:    time.Minute,
+	}
+	ctx = workflow.WithActivityOptions(ctx, ao)
+	return workflow.ExecuteActivity(ctx, RejectExpenseActivity, expenseID).Get(ctx, nil)
 }
@@ -1,14 +1,19 @@
 package expense
 
 import (
-	"io"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
+	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/testsuite"
 )
 
@@ -17,6 +22,14 @@ type UnitTestSuite struct {
 	testsuite.WorkflowTestSuite
 }
 
+var testExpense = Expense{
+	ID:        "test-expense-id",
+	Amount:    5000,
+	Currency:  "USD",
+	Category:  "travel",
+	Submitter: "test-user",
+}
+
 func TestUnitTestSuite(t *testing.T) {
 	suite.Run(t, new(UnitTestSuite))
 }
@@ -26,12 +39,16 @@ func (s *UnitTestSuite) Test_WorkflowWithMockActivities() {
 	env.RegisterActivity(CreateExpenseActivity)
 	env.RegisterActivity(WaitForDecisionActivity)
 	env.RegisterActivity(PaymentActivity)
+	env.RegisterActivity(CompleteExpenseActivity)
+	env.RegisterActivity(NotifyApproverActivity)
+	env.RegisterActivity(RejectExpenseActivity)
 
 	env.OnActivity(CreateExpenseActivity, mock.Anything, mock.Anything).Return(nil).Once()
 	env.OnActivity(WaitForDecisionActivity, mock.Anything, mock.Anything).Return("APPROVED", nil).Once()
-	env.OnActivity(PaymentActivity, mock.Anything, mock.Anything).Return(nil).Once()
+	env.OnActivity(PaymentActivity, mock.Anything, mock.Anything).Return(Payment{ID: "test-payment-id"}, nil).Once()
+	env.OnActivity(CompleteExpenseActivity, mock.Anything, mock.Anything).Return(nil).Once()
 
-	env.ExecuteWorkflow(SampleExpenseWorkflow, "test-expense-id")
+	env.ExecuteWorkflow(SampleExpenseWorkflow, testExpense, ApprovalOptions{Mode: ApprovalModeAsyncActivity})
 
 	s.True(env.IsWorkflowCompleted())
 	s.NoError(env.GetWorkflowError())
@@ -44,38 +61,467 @@ func (s *UnitTestSuite) Test_WorkflowWithMockActivities() {
 
 func (s *UnitTestSuite) Test_WorkflowWithMockServer() {
 	env := s.NewTestWorkflowEnvironment()
-	env.RegisterActivity(CreateExpenseActivity)
-	env.RegisterActivity(WaitForDecisionActivity)
-	env.RegisterActivity(PaymentActivity)
+	s.registerActivities(env)
 
 	// setup mock expense server
-	handler := func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/text")
-		switch r.URL.Path {
-		case "/create":
-		case "/registerCallback":
-			taskToken := []byte(r.PostFormValue("task_token"))
-			// simulate the expense is approved one hour later.
-			env.RegisterDelayedCallback(func() {
-				_ = env.CompleteActivity(taskToken, "APPROVED", nil)
-			}, time.Hour)
-		case "/action":
-		}
-		_, _ = io.WriteString(w, "SUCCEED")
+	server := newFakeExpenseServer()
+	defer server.Close()
+	server.onCallback = func(taskToken []byte) {
+		// simulate the expense is approved one hour later.
+		env.RegisterDelayedCallback(func() {
+			_ = env.CompleteActivity(taskToken, "APPROVED", nil)
+		}, time.Hour)
 	}
-	server := httptest.NewServer(http.HandlerFunc(handler))
+
+	env.ExecuteWorkflow(SampleExpenseWorkflow, testExpense, ApprovalOptions{Mode: ApprovalModeAsyncActivity})
+
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	var workflowResult string
+	err := env.GetWorkflowResult(&workflowResult)
+	s.NoError(err)
+	s.Equal("COMPLETED", workflowResult)
+	s.Len(server.payments, 1)
+	s.True(server.completed)
+	env.AssertExpectations(s.T())
+}
+
+func (s *UnitTestSuite) Test_PaymentWithLostResponses() {
+	env := s.NewTestWorkflowEnvironment()
+	s.registerActivities(env)
+
+	server := newFakeExpenseServer()
 	defer server.Close()
+	// the first payments are made but their responses are lost, so the activity is retried
+	server.lostPaymentResponses = 2
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(DecisionSignalName, Decision{Status: "APPROVED", Approver: "alice"})
+	}, time.Minute)
 
-	// pointing server to test mock
-	expenseServerHostPort = server.URL
+	env.ExecuteWorkflow(SampleExpenseWorkflow, testExpense, ApprovalOptions{})
+
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	var workflowResult string
+	s.NoError(env.GetWorkflowResult(&workflowResult))
+	s.Equal("COMPLETED", workflowResult)
+	// the retries are duplicates of the first request, sent with the same idempotency key
+	s.Len(server.paymentKeys, 3)
+	for _, key := range server.paymentKeys {
+		s.Equal(server.paymentKeys[0], key)
+	}
+	s.Len(server.payments, 1, "the expense must be paid once")
+	s.True(server.completed)
+}
+
+func (s *UnitTestSuite) Test_PaymentRefundedWhenCompletionFails() {
+	env := s.NewTestWorkflowEnvironment()
+	s.registerActivities(env)
+
+	server := newFakeExpenseServer()
+	defer server.Close()
+	server.completeStatus = http.StatusConflict
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(DecisionSignalName, Decision{Status: "APPROVED", Approver: "alice"})
+	}, time.Minute)
+
+	env.ExecuteWorkflow(SampleExpenseWorkflow, testExpense, ApprovalOptions{})
+
+	s.True(env.IsWorkflowCompleted())
+	err := env.GetWorkflowError()
+	s.Error(err)
+	var applicationErr *temporal.ApplicationError
+	s.True(errors.As(err, &applicationErr))
+	s.Equal(ExpenseServerErrorType, applicationErr.Type())
+	s.Len(server.payments, 1)
+	for _, payment := range server.payments {
+		s.Equal([]string{payment.ID}, server.refunds)
+	}
+	s.False(server.completed)
+}
+
+func (s *UnitTestSuite) Test_WorkflowStateQuery() {
+	env := s.NewTestWorkflowEnvironment()
+	s.registerActivities(env)
+
+	server := newFakeExpenseServer()
+	defer server.Close()
+	for _, status := range []string{StatusCreated, StatusPendingApproval} {
+		env.OnUpsertSearchAttributes(map[string]interface{}{
+			SearchAttributeStatus: status,
+			SearchAttributeAmount: int64(5000),
+		}).Return(nil).Once()
+	}
+	// the approver is upserted as soon as it decides
+	for _, status := range []string{StatusPendingApproval, StatusApproved, StatusPaid, StatusCompleted} {
+		env.OnUpsertSearchAttributes(map[string]interface{}{
+			SearchAttributeStatus:   status,
+			SearchAttributeAmount:   int64(5000),
+			SearchAttributeApprover: "alice",
+		}).Return(nil).Once()
+	}
+
+	env.RegisterDelayedCallback(func() {
+		value, err := env.QueryWorkflow(StateQueryName)
+		s.NoError(err)
+		var state ExpenseState
+		s.NoError(value.Get(&state))
+		s.Equal(StatusPendingApproval, state.Status)
+		s.Empty(state.Approvals)
 
-	env.ExecuteWorkflow(SampleExpenseWorkflow, "test-expense-id")
+		env.SignalWorkflow(DecisionSignalName, Decision{Status: "APPROVED", Approver: "alice"})
+	}, time.Minute)
+
+	env.ExecuteWorkflow(SampleExpenseWorkflow, testExpense, ApprovalOptions{UpsertSearchAttributes: true})
+
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	value, err := env.QueryWorkflow(StateQueryName)
+	s.NoError(err)
+	var state ExpenseState
+	s.NoError(value.Get(&state))
+	s.Equal(StatusCompleted, state.Status)
+	var timeline []string
+	for _, change := range state.Timeline {
+		timeline = append(timeline, change.Status)
+	}
+	s.Equal([]string{StatusCreated, StatusPendingApproval, StatusApproved, StatusPaid, StatusCompleted}, timeline)
+	s.Len(state.Approvals, 1)
+	s.Equal("alice", state.Approvals[0].Approver)
+	s.Equal(ApprovalLevelManager, state.Approvals[0].Level)
+	env.AssertExpectations(s.T())
+}
+
+func (s *UnitTestSuite) Test_WorkflowWithoutSearchAttributes() {
+	env := s.NewTestWorkflowEnvironment()
+	s.registerActivities(env)
+
+	server := newFakeExpenseServer()
+	defer server.Close()
+	// once mocked, any other upsert fails the workflow as an unexpected call
+	env.OnUpsertSearchAttributes(map[string]interface{}{"Unexpected": true}).Return(nil)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(DecisionSignalName, Decision{Status: "APPROVED", Approver: "alice"})
+	}, time.Minute)
+
+	env.ExecuteWorkflow(SampleExpenseWorkflow, testExpense, ApprovalOptions{})
+
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+}
+
+func (s *UnitTestSuite) Test_ApprovalChain() {
+	policy := DefaultApprovalPolicy()
+	tests := []struct {
+		amount   int64
+		category string
+		chain    []ApprovalLevel
+	}{
+		{5000, "travel", []ApprovalLevel{ApprovalLevelManager}},
+		{5000, "equipment", []ApprovalLevel{ApprovalLevelManager, ApprovalLevelFinance}},
+		{100000, "travel", []ApprovalLevel{ApprovalLevelManager, ApprovalLevelFinance}},
+		{1000000, "travel", []ApprovalLevel{ApprovalLevelManager, ApprovalLevelFinance, ApprovalLevelDirector}},
+	}
+	for _, test := range tests {
+		expense := Expense{ID: "test-expense-id", Amount: test.amount, Currency: "USD", Category: test.category}
+		s.Equal(test.chain, policy.ApprovalChain(expense), "amount %v, category %v", test.amount, test.category)
+	}
+
+	// an expense matching no rule falls back to the manager approval
+	policy = ApprovalPolicy{Rules: []ApprovalRule{{Level: ApprovalLevelFinance, Currency: "EUR"}}}
+	s.Equal([]ApprovalLevel{ApprovalLevelManager}, policy.ApprovalChain(testExpense))
+}
+
+func (s *UnitTestSuite) Test_WorkflowWithSignalApproval() {
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterActivity(CreateExpenseActivity)
+	env.RegisterActivity(NotifyApproverActivity)
+	env.RegisterActivity(PaymentActivity)
+	env.RegisterActivity(CompleteExpenseActivity)
+
+	env.OnActivity(CreateExpenseActivity, mock.Anything, mock.Anything).Return(nil).Once()
+	env.OnActivity(NotifyApproverActivity, mock.Anything, "test-expense-id", "manager", "approval requested").Return(nil).Once()
+	// reminders are sent at 1h and 2h
+	env.OnActivity(NotifyApproverActivity, mock.Anything, "test-expense-id", "manager", "approval reminder").Return(nil).Twice()
+	env.OnActivity(PaymentActivity, mock.Anything, mock.Anything).Return(Payment{ID: "test-payment-id"}, nil).Once()
+	env.OnActivity(CompleteExpenseActivity, mock.Anything, mock.Anything).Return(nil).Once()
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(DecisionSignalName, Decision{Status: "APPROVED", Approver: "alice"})
+	}, 150*time.Minute)
+
+	env.ExecuteWorkflow(SampleExpenseWorkflow, testExpense, ApprovalOptions{})
 
 	s.True(env.IsWorkflowCompleted())
 	s.NoError(env.GetWorkflowError())
 	var workflowResult string
-	err := env.GetWorkflowResult(&workflowResult)
+	s.NoError(env.GetWorkflowResult(&workflowResult))
+	s.Equal("COMPLETED", workflowResult)
+	env.AssertExpectations(s.T())
+}
+
+func (s *UnitTestSuite) Test_WorkflowWithSignalEscalation() {
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterActivity(CreateExpenseActivity)
+	env.RegisterActivity(NotifyApproverActivity)
+	env.RegisterActivity(RejectExpenseActivity)
+
+	env.OnActivity(CreateExpenseActivity, mock.Anything, mock.Anything).Return(nil).Once()
+	env.OnActivity(NotifyApproverActivity, mock.Anything, "test-expense-id", "alice", mock.Anything).Return(nil)
+	env.OnActivity(NotifyApproverActivity, mock.Anything, "test-expense-id", "vp", "approval escalated").Return(nil).Once()
+	env.OnActivity(RejectExpenseActivity, mock.Anything, "test-expense-id").Return(nil).Once()
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(DecisionSignalName, Decision{Status: "REJECTED", Approver: "vp"})
+	}, 5*time.Hour)
+
+	env.ExecuteWorkflow(SampleExpenseWorkflow, testExpense, ApprovalOptions{
+		Approvers:          map[ApprovalLevel]string{ApprovalLevelManager: "alice"},
+		EscalationApprover: "vp",
+		ReminderInterval:   3 * time.Hour,
+		EscalationDelay:    4 * time.Hour,
+	})
+
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	var workflowResult string
+	s.NoError(env.GetWorkflowResult(&workflowResult))
+	s.Equal("", workflowResult)
+	env.AssertExpectations(s.T())
+}
+
+func (s *UnitTestSuite) Test_WorkflowWithSignalDeadline() {
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterActivity(CreateExpenseActivity)
+	env.RegisterActivity(NotifyApproverActivity)
+	env.RegisterActivity(RejectExpenseActivity)
+
+	env.OnActivity(CreateExpenseActivity, mock.Anything, mock.Anything).Return(nil).Once()
+	env.OnActivity(NotifyApproverActivity, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnActivity(RejectExpenseActivity, mock.Anything, "test-expense-id").Return(nil).Once()
+
+	env.ExecuteWorkflow(SampleExpenseWorkflow, testExpense, ApprovalOptions{Deadline: 2 * time.Hour})
+
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	var workflowResult string
+	s.NoError(env.GetWorkflowResult(&workflowResult))
+	s.Equal("", workflowResult)
+	env.AssertExpectations(s.T())
+}
+
+func (s *UnitTestSuite) Test_WorkflowWithSequentialApprovalChain() {
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterActivity(CreateExpenseActivity)
+	env.RegisterActivity(NotifyApproverActivity)
+	env.RegisterActivity(RejectExpenseActivity)
+
+	env.OnActivity(CreateExpenseActivity, mock.Anything, mock.Anything).Return(nil).Once()
+	env.OnActivity(NotifyApproverActivity, mock.Anything, "test-expense-id", "manager", "approval requested").Return(nil).Once()
+	// finance is not notified as it decided before the manager approved
+	env.OnActivity(RejectExpenseActivity, mock.Anything, "test-expense-id").Return(nil).Once()
+
+	env.RegisterDelayedCallback(func() {
+		// the finance decision is kept until the manager approves
+		env.SignalWorkflow(DecisionSignalName, Decision{Status: "REJECTED", Approver: "bob", Level: ApprovalLevelFinance})
+		env.SignalWorkflow(DecisionSignalName, Decision{Status: "APPROVED", Approver: "alice"})
+	}, 10*time.Minute)
+
+	expense := testExpense
+	expense.Amount = 100000
+	env.ExecuteWorkflow(SampleExpenseWorkflow, expense, ApprovalOptions{})
+
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	var workflowResult string
+	s.NoError(env.GetWorkflowResult(&workflowResult))
+	s.Equal("", workflowResult)
+	value, err := env.QueryWorkflow(StateQueryName)
+	s.NoError(err)
+	var state ExpenseState
+	s.NoError(value.Get(&state))
+	s.Len(state.Approvals, 2)
+	s.Equal(Approval{Level: ApprovalLevelManager, Approver: "alice", Status: "APPROVED", Time: state.Approvals[0].Time}, state.Approvals[0])
+	s.Equal(Approval{Level: ApprovalLevelFinance, Approver: "bob", Status: "REJECTED", Time: state.Approvals[1].Time}, state.Approvals[1])
+	env.AssertExpectations(s.T())
+}
+
+func (s *UnitTestSuite) Test_WorkflowNotificationsDoNotBlockDecisions() {
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterActivity(CreateExpenseActivity)
+	env.RegisterActivity(NotifyApproverActivity)
+	env.RegisterActivity(RejectExpenseActivity)
+
+	env.OnActivity(CreateExpenseActivity, mock.Anything, mock.Anything).Return(nil).Once()
+	env.OnActivity(NotifyApproverActivity, mock.Anything, "test-expense-id", "manager", "approval requested").Return(nil).Once()
+	// the reminder is still being sent when the decision arrives
+	env.OnActivity(NotifyApproverActivity, mock.Anything, "test-expense-id", "manager", "approval reminder").
+		After(50 * time.Second).Return(nil).Once()
+	env.OnActivity(RejectExpenseActivity, mock.Anything, "test-expense-id").Return(nil).Once()
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(DecisionSignalName, Decision{Status: "REJECTED", Approver: "alice"})
+	}, time.Hour+10*time.Second)
+
+	env.ExecuteWorkflow(SampleExpenseWorkflow, testExpense, ApprovalOptions{})
+
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	value, err := env.QueryWorkflow(StateQueryName)
 	s.NoError(err)
+	var state ExpenseState
+	s.NoError(value.Get(&state))
+	s.Len(state.Approvals, 1)
+	s.Equal(time.Hour+10*time.Second, state.Approvals[0].Time.Sub(state.Timeline[0].Time))
+	env.AssertExpectations(s.T())
+}
+
+func (s *UnitTestSuite) Test_WorkflowWithParallelApprovalChain() {
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterActivity(CreateExpenseActivity)
+	env.RegisterActivity(NotifyApproverActivity)
+	env.RegisterActivity(PaymentActivity)
+	env.RegisterActivity(CompleteExpenseActivity)
+
+	env.OnActivity(CreateExpenseActivity, mock.Anything, mock.Anything).Return(nil).Once()
+	for _, approver := range []string{"manager", "finance", "director"} {
+		env.OnActivity(NotifyApproverActivity, mock.Anything, "test-expense-id", approver, "approval requested").Return(nil).Once()
+	}
+	env.OnActivity(PaymentActivity, mock.Anything, mock.Anything).Return(Payment{ID: "test-payment-id"}, nil).Once()
+	env.OnActivity(CompleteExpenseActivity, mock.Anything, mock.Anything).Return(nil).Once()
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(DecisionSignalName, Decision{Status: "APPROVED", Approver: "carol", Level: ApprovalLevelDirector})
+		env.SignalWorkflow(DecisionSignalName, Decision{Status: "APPROVED", Approver: "bob", Level: ApprovalLevelFinance})
+		env.SignalWorkflow(DecisionSignalName, Decision{Status: "APPROVED", Approver: "alice", Level: ApprovalLevelManager})
+	}, 10*time.Minute)
+
+	expense := testExpense
+	expense.Amount = 1000000
+	policy := DefaultApprovalPolicy()
+	policy.Parallel = true
+	env.ExecuteWorkflow(SampleExpenseWorkflow, expense, ApprovalOptions{Policy: policy})
+
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	var workflowResult string
+	s.NoError(env.GetWorkflowResult(&workflowResult))
 	s.Equal("COMPLETED", workflowResult)
 	env.AssertExpectations(s.T())
 }
+
+func (s *UnitTestSuite) Test_WorkflowWithoutMatchingRule() {
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterActivity(CreateExpenseActivity)
+	env.RegisterActivity(NotifyApproverActivity)
+	env.RegisterActivity(RejectExpenseActivity)
+
+	// the expense is not approved without any approver, the manager has to decide
+	env.OnActivity(CreateExpenseActivity, mock.Anything, mock.Anything).Return(nil).Once()
+	env.OnActivity(NotifyApproverActivity, mock.Anything, "test-expense-id", "manager", "approval requested").Return(nil).Once()
+	env.OnActivity(RejectExpenseActivity, mock.Anything, "test-expense-id").Return(nil).Once()
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(DecisionSignalName, Decision{Status: "REJECTED", Approver: "alice"})
+	}, 10*time.Minute)
+
+	policy := ApprovalPolicy{Rules: []ApprovalRule{{Level: ApprovalLevelFinance, Currency: "EUR"}}, Parallel: true}
+	env.ExecuteWorkflow(SampleExpenseWorkflow, testExpense, ApprovalOptions{Policy: policy})
+
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	var workflowResult string
+	s.NoError(env.GetWorkflowResult(&workflowResult))
+	s.Equal("", workflowResult)
+	env.AssertExpectations(s.T())
+}
+
+func (s *UnitTestSuite) registerActivities(env *testsuite.TestWorkflowEnvironment) {
+	env.RegisterActivity(CreateExpenseActivity)
+	env.RegisterActivity(WaitForDecisionActivity)
+	env.RegisterActivity(NotifyApproverActivity)
+	env.RegisterActivity(RejectExpenseActivity)
+	env.RegisterActivity(PaymentActivity)
+	env.RegisterActivity(CompleteExpenseActivity)
+	env.RegisterActivity(RefundPaymentActivity)
+}
+
+// fakeExpenseServer is a local expense server that honours the idempotency keys of payments. It can lose the
+// responses of payments and fail the completion of the expense.
+type fakeExpenseServer struct {
+	*httptest.Server
+	onCallback func(taskToken []byte)
+	// lostPaymentResponses is the number of payments made whose response is replaced by an error
+	lostPaymentResponses int
+	// completeStatus is the status code of the completion requests, 200 if zero
+	completeStatus int
+	// previousHostPort is the expense server of the activities before this one, restored by Close
+	previousHostPort string
+
+	mu          sync.Mutex
+	paymentKeys []string
+	payments    map[string]Payment // by idempotency key
+	refunds     []string
+	completed   bool
+}
+
+// newFakeExpenseServer starts the server and points the activities to it until it is closed
+func newFakeExpenseServer() *fakeExpenseServer {
+	server := &fakeExpenseServer{payments: make(map[string]Payment), previousHostPort: expenseServerHostPort}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.handle))
+	expenseServerHostPort = server.URL
+	return server
+}
+
+// Close stops the server and points the activities back to the previous expense server
+func (f *fakeExpenseServer) Close() {
+	f.Server.Close()
+	expenseServerHostPort = f.previousHostPort
+}
+
+func (f *fakeExpenseServer) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	status, response := http.StatusOK, interface{}(struct{}{})
+	switch strings.TrimPrefix(r.URL.Path, "/api/expenses/test-expense-id/") {
+	case "/api/expenses":
+		status = http.StatusCreated
+	case "callback":
+		var request struct{ TaskToken []byte }
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		if f.onCallback != nil {
+			f.onCallback(request.TaskToken)
+		}
+	case "pay":
+		key := r.Header.Get("Idempotency-Key")
+		f.paymentKeys = append(f.paymentKeys, key)
+		payment, ok := f.payments[key]
+		if !ok {
+			var request Payment
+			_ = json.NewDecoder(r.Body).Decode(&request)
+			payment = Payment{ID: fmt.Sprintf("payment-%d", len(f.payments)+1), Amount: request.Amount, Currency: request.Currency, Status: "PAID"}
+			f.payments[key] = payment
+		}
+		response = payment
+		if f.lostPaymentResponses > 0 {
+			f.lostPaymentResponses--
+			status, response = http.StatusBadGateway, map[string]string{"error": "response lost"}
+		}
+	case "complete":
+		if f.completeStatus != 0 && f.completeStatus != http.StatusOK {
+			status, response = f.completeStatus, map[string]string{"error": "completion failed"}
+			break
+		}
+		f.completed = true
+	case "refund":
+		var request struct{ PaymentID string }
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		f.refunds = append(f.refunds, request.PaymentID)
+	case "reject":
+	default:
+		status = http.StatusNotFound
+	}
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
@@ -2,123 +2,356 @@ package fileprocessing
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
-	"strings"
 	"time"
+	"unicode/utf8"
 
 	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
 )
 
 /**
  * Sample activities used by file processing sample workflow.
  */
 
-type Activities struct {
-	BlobStore *BlobStore
-}
+// DefaultChunkSize is the size of the chunks read by ProcessFileActivity when Activities.ChunkSize is not set
+const DefaultChunkSize = 64 * 1024
+
+// processedSuffix is appended to the name of the processed file
+const processedSuffix = ".processed"
+
+var defaultTranscoders = NewTranscoderRegistry()
+
+// DataErrorType is the type of the non-retryable application errors returned by the activities when a file is
+// invalid or missing, processing it again would fail again
+const DataErrorType = "DataError"
+
+// DefaultDestinationFormat is the format of the name of the processed files when
+// Activities.DestinationFormat is not set
+const DefaultDestinationFormat = "processed/%s"
+
+type (
+	Activities struct {
+		BlobStore BlobStore
+		// DestinationFormat is the fmt format of the name the processed file is uploaded under, given the ID of
+		// the file. DefaultDestinationFormat if not set.
+		DestinationFormat string
+		// ChunkSize is the size of the chunks read by ProcessFileActivity, DefaultChunkSize if not set
+		ChunkSize int
+		// Transcoders run by ProcessFileActivity, NewTranscoderRegistry() if not set
+		Transcoders *TranscoderRegistry
+	}
+
+	// FileProgress is the heartbeat details of ProcessFileActivity
+	FileProgress struct {
+		// Step is the index of the transcoder being run in the pipeline
+		Step int
+		// InputOffset is the offset in the input file of the next chunk to process
+		InputOffset int64
+		// OutputOffset is the size of the output written for the chunks before InputOffset
+		OutputOffset int64
+	}
+)
 
 func (a *Activities) DownloadFileActivity(ctx context.Context, fileID string) (string, error) {
 	logger := activity.GetLogger(ctx)
 	logger.Info("Downloading file...", "FileID", fileID)
-	data := a.BlobStore.downloadFile(fileID)
-
-	tmpFile, err := saveToTmpFile(data)
+	fileName, err := newTmpFileName()
 	if err != nil {
-		logger.Error("downloadFileActivity failed to save tmp file.", "Error", err)
+		logger.Error("downloadFileActivity failed to create tmp file.", "Error", err)
+		return "", err
+	}
+	err = heartbeatUntilDone(ctx, func() error { return a.BlobStore.Download(ctx, fileID, fileName) })
+	if err != nil {
+		_ = os.Remove(fileName)
+		logger.Error("downloadFileActivity failed to download file.", "Error", err)
+		var s3Err *S3Error
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrInvalidBlobName) ||
+			errors.As(err, &s3Err) && s3Err.StatusCode == http.StatusNotFound {
+			return "", temporal.NewNonRetryableApplicationError(err.Error(), DataErrorType, err)
+		}
 		return "", err
 	}
-	fileName := tmpFile.Name()
 	logger.Info("downloadFileActivity succeed.", "SavedFilePath", fileName)
 	return fileName, nil
 }
 
-func (a *Activities) ProcessFileActivity(ctx context.Context, fileName string) (string, error) {
+// ListFilesActivity returns the IDs of the files of the blob store starting with prefix
+func (a *Activities) ListFilesActivity(ctx context.Context, prefix string) ([]string, error) {
+	lister, ok := a.BlobStore.(BlobLister)
+	if !ok {
+		return nil, temporal.NewNonRetryableApplicationError("blob store can't list files", "UnsupportedOperation", nil)
+	}
+	fileIDs, err := lister.List(ctx, prefix)
+	if err != nil {
+		activity.GetLogger(ctx).Error("listFilesActivity failed.", "Prefix", prefix, "Error", err)
+		return nil, err
+	}
+	return fileIDs, nil
+}
+
+// ProcessFileActivity runs the transcoders of the pipeline one after the other, each one writing its output to a
+// file read by the next one. The step of the pipeline reached is recorded in the heartbeat details: the activity is
+// retried on the same host by the session, so a retried attempt resumes from that step instead of starting over.
+//
+// A ChunkTranscoder transcodes the file chunk by chunk, so it never holds the whole file in memory, and the offsets
+// reached are recorded in the heartbeat details after every chunk, so a retried attempt resumes from the middle of
+// the file. The output is truncated to the recorded offset first, which discards what was written after the last
+// heartbeat, so every chunk ends up exactly once in the output. The other transcoders start their step over.
+func (a *Activities) ProcessFileActivity(ctx context.Context, fileName string, pipeline []string) (string, error) {
 	logger := activity.GetLogger(ctx)
-	logger.Info("processFileActivity started.", "FileName", fileName)
+	logger.Info("processFileActivity started.", "FileName", fileName, "Pipeline", pipeline)
 
-	defer func() { _ = os.Remove(fileName) }() // cleanup temp file
+	transcoders := make([]Transcoder, len(pipeline))
+	for i, name := range pipeline {
+		var err error
+		if transcoders[i], err = a.transcoders().Get(name); err != nil {
+			logger.Error("processFileActivity failed to get transcoder.", "Error", err)
+			return "", temporal.NewNonRetryableApplicationError(err.Error(), "UnknownTranscoder", err)
+		}
+	}
 
-	// read downloaded file
-	data, err := ioutil.ReadFile(fileName)
-	if err != nil {
-		logger.Error("processFileActivity failed to read file.", "FileName", fileName, "Error", err)
-		return "", err
+	var progress FileProgress
+	if activity.HasHeartbeatDetails(ctx) {
+		if err := activity.GetHeartbeatDetails(ctx, &progress); err != nil {
+			logger.Error("processFileActivity failed to read heartbeat details.", "Error", err)
+			return "", err
+		}
+		logger.Info("processFileActivity resumed.", "Step", progress.Step, "InputOffset", progress.InputOffset,
+			"OutputOffset", progress.OutputOffset)
+	}
+	heartbeat := func(p FileProgress) error {
+		activity.RecordHeartbeat(ctx, p)
+		return ctx.Err()
 	}
 
-	// process the file
-	transData := transcodeData(ctx, data)
-	tmpFile, err := saveToTmpFile(transData)
-	if err != nil {
-		logger.Error("processFileActivity failed to save tmp file.", "Error", err)
-		return "", err
+	for step := progress.Step; step < len(transcoders); step++ {
+		if step != progress.Step {
+			progress = FileProgress{Step: step}
+		}
+		input, output := stepFileName(fileName, step-1, len(transcoders)), stepFileName(fileName, step, len(transcoders))
+		var err error
+		if chunkTranscoder, ok := transcoders[step].(ChunkTranscoder); ok {
+			err = transcodeFile(input, output, progress, a.chunkSize(), chunkTranscoder.TranscodeChunk, heartbeat)
+		} else {
+			err = streamFile(ctx, transcoders[step], input, output, progress, heartbeat)
+		}
+		if err != nil {
+			// the files are kept for the next attempt to resume
+			logger.Error("processFileActivity failed to process file.", "FileName", fileName, "Transcoder", pipeline[step],
+				"Error", err)
+			var dataErr *DataError
+			if errors.As(err, &dataErr) {
+				return "", temporal.NewNonRetryableApplicationError(err.Error(), DataErrorType, err)
+			}
+			return "", err
+		}
 	}
 
-	processedFileName := tmpFile.Name()
+	// cleanup temp files
+	for step := -1; step < len(transcoders)-1; step++ {
+		_ = os.Remove(stepFileName(fileName, step, len(transcoders)))
+	}
+	processedFileName := stepFileName(fileName, len(transcoders)-1, len(transcoders))
 	logger.Info("processFileActivity succeed.", "SavedFilePath", processedFileName)
 	return processedFileName, nil
 }
 
-func (a *Activities) UploadFileActivity(ctx context.Context, fileName string) error {
+// UploadFileActivity uploads the processed file under the name given by DestinationFormat for the ID of the file
+func (a *Activities) UploadFileActivity(ctx context.Context, fileName, fileID string) error {
+	name := a.destination(fileID)
 	logger := activity.GetLogger(ctx)
-	logger.Info("uploadFileActivity begin.", "UploadedFileName", fileName)
+	logger.Info("uploadFileActivity begin.", "UploadedFileName", fileName, "Destination", name)
 
 	defer func() { _ = os.Remove(fileName) }() // cleanup temp file
 
-	err := a.BlobStore.uploadFile(ctx, fileName)
+	err := heartbeatUntilDone(ctx, func() error { return a.BlobStore.Upload(ctx, fileName, name) })
 	if err != nil {
 		logger.Error("uploadFileActivity uploading failed.", "Error", err)
 		return err
 	}
-	logger.Info("uploadFileActivity succeed.", "UploadedFileName", fileName)
+	logger.Info("uploadFileActivity succeed.", "UploadedFileName", fileName, "Destination", name)
 	return nil
 }
 
-type BlobStore struct{}
+func (a *Activities) destination(fileID string) string {
+	if a.DestinationFormat == "" {
+		return fmt.Sprintf(DefaultDestinationFormat, fileID)
+	}
+	return fmt.Sprintf(a.DestinationFormat, fileID)
+}
 
-func (b *BlobStore) downloadFile(fileID string) []byte {
-	// dummy downloader
-	dummyContent := "dummy content for fileID:" + fileID
-	return []byte(dummyContent)
+func (a *Activities) chunkSize() int {
+	if a.ChunkSize < utf8.UTFMax {
+		return DefaultChunkSize
+	}
+	return a.ChunkSize
 }
 
-func (b *BlobStore) uploadFile(ctx context.Context, filename string) error {
-	// dummy uploader
-	_, err := ioutil.ReadFile(filename)
-	for i := 0; i < 5; i++ {
-		time.Sleep(1 * time.Second)
-		// Demonstrates that heartbeat accepts progress data.
-		// In case of a heartbeat timeout it is included into the error.
-		activity.RecordHeartbeat(ctx, i)
+func (a *Activities) transcoders() *TranscoderRegistry {
+	if a.Transcoders == nil {
+		return defaultTranscoders
 	}
+	return a.Transcoders
+}
+
+// stepFileName returns the name of the file written by the step of a pipeline of the given length, the names must
+// not change between attempts. The step -1 is the input of the pipeline.
+func stepFileName(fileName string, step, length int) string {
+	switch step {
+	case -1:
+		return fileName
+	case length - 1:
+		return fileName + processedSuffix
+	}
+	return fmt.Sprintf("%s.%d", fileName, step)
+}
+
+// transcodeFile transcodes the input file into the output file chunk by chunk from the given progress, calling
+// heartbeat after every chunk written. It stops at the first error returned by heartbeat.
+func transcodeFile(inputName, outputName string, progress FileProgress, chunkSize int, transcode func([]byte) []byte,
+	heartbeat func(FileProgress) error) error {
+	in, err := os.Open(inputName)
 	if err != nil {
 		return err
 	}
-	return nil
+	defer func() { _ = in.Close() }()
+	if _, err := in.Seek(progress.InputOffset, io.SeekStart); err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(outputName, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = out.Close() }()
+	// drop the output of the chunks processed after the last heartbeat of a previous attempt
+	if err := out.Truncate(progress.OutputOffset); err != nil {
+		return err
+	}
+	if _, err := out.Seek(progress.OutputOffset, io.SeekStart); err != nil {
+		return err
+	}
+
+	return transcodeChunks(in, out, chunkSize, transcode, func(read, written int) error {
+		progress.InputOffset += int64(read)
+		progress.OutputOffset += int64(written)
+		return heartbeat(progress)
+	})
 }
 
-func transcodeData(ctx context.Context, data []byte) []byte {
-	// dummy file processor, just do upper case for the data.
-	// in real world case, you would want to avoid load entire file content into memory at once.
-	for i := 0; i < 5; i++ {
-		time.Sleep(1 * time.Second)
-		// Demonstrates that heartbeat accepts progress data.
-		// In case of a heartbeat timeout it is included into the error.
-		activity.RecordHeartbeat(ctx, i)
+// transcodeChunks transcodes r into w chunk by chunk, calling onChunk with the number of bytes read and written
+// after every chunk. It stops at the first error returned by onChunk.
+func transcodeChunks(r io.Reader, w io.Writer, chunkSize int, transcode func([]byte) []byte, onChunk func(read, written int) error) error {
+	buf := make([]byte, chunkSize)
+	// carry is the length of the incomplete rune left at the end of the previous chunk
+	carry := 0
+	for {
+		n, err := io.ReadFull(r, buf[carry:])
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return err
+		}
+		n += carry
+		end := n
+		if !eof {
+			end = runeBoundary(buf[:n])
+		}
+		written, err := w.Write(transcode(buf[:end]))
+		if err != nil {
+			return err
+		}
+		if err := onChunk(end, written); err != nil {
+			return err
+		}
+		if eof {
+			return nil
+		}
+		carry = copy(buf, buf[end:n])
 	}
-	return []byte(strings.ToUpper(string(data)))
 }
 
-func saveToTmpFile(data []byte) (f *os.File, err error) {
-	tmpFile, err := ioutil.TempFile("", "temporal_sample")
+// streamFile transcodes the input file into the output file, from the beginning. It calls heartbeat with the
+// progress, which records the step, before every read.
+func streamFile(ctx context.Context, transcoder Transcoder, inputName, outputName string, progress FileProgress,
+	heartbeat func(FileProgress) error) error {
+	in, err := os.Open(inputName)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	_, err = tmpFile.Write(data)
+	defer func() { _ = in.Close() }()
+	out, err := os.Create(outputName)
 	if err != nil {
-		_ = os.Remove(tmpFile.Name())
-		return nil, err
+		return err
 	}
+	defer func() { _ = out.Close() }()
 
-	return tmpFile, nil
+	progress.InputOffset, progress.OutputOffset = 0, 0
+	r := &heartbeatReader{r: in, heartbeat: func() error { return heartbeat(progress) }}
+	if err := transcoder.Transcode(ctx, r, out); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// heartbeatReader calls heartbeat before every read, the SDK throttles the heartbeats sent to the service
+type heartbeatReader struct {
+	r         io.Reader
+	heartbeat func() error
+}
+
+func (h *heartbeatReader) Read(p []byte) (int, error) {
+	if err := h.heartbeat(); err != nil {
+		return 0, err
+	}
+	return h.r.Read(p)
+}
+
+// runeBoundary returns the length of data without its trailing incomplete rune, so a chunk never splits a rune
+func runeBoundary(data []byte) int {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if utf8.FullRune(data[i:]) {
+				return len(data)
+			}
+			return i
+		}
+	}
+	return len(data)
+}
+
+// heartbeatUntilDone heartbeats while fn runs, as the transfers of the blob stores can last longer than the
+// heartbeat timeout
+func heartbeatUntilDone(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+
+	interval := activity.GetInfo(ctx).HeartbeatTimeout / 2
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-ticker.C:
+			activity.RecordHeartbeat(ctx)
+		}
+	}
+}
+
+func newTmpFileName() (string, error) {
+	tmpFile, err := ioutil.TempFile("", "temporal_sample")
+	if err != nil {
+		return "", err
+	}
+	_ = tmpFile.Close()
+	return tmpFile.Name(), nil
 }
@@ -0,0 +1,143 @@
+package fileprocessing
+
+import (
+	"go.temporal.io/sdk/workflow"
+)
+
+const (
+	// DefaultBatchConcurrency is the number of files processed at once when BatchRequest.Concurrency is not set
+	DefaultBatchConcurrency = 4
+	// DefaultFilesPerRun is the number of files processed by a run of BatchFileProcessingWorkflow when
+	// BatchRequest.FilesPerRun is not set
+	DefaultFilesPerRun = 100
+)
+
+type (
+	// BatchRequest is the input of BatchFileProcessingWorkflow
+	BatchRequest struct {
+		// FileIDs is the manifest of the batch
+		FileIDs []string
+		// Prefix selects the files of the blob store whose name starts with it when FileIDs is empty. The blob
+		// store must implement BlobLister.
+		Prefix string
+		// Concurrency is the maximum number of files processed at once, each in its own session. The sessions
+		// are spread over the workers, which run up to their MaxConcurrentSessionExecutionSize sessions each.
+		// DefaultBatchConcurrency if not set.
+		Concurrency int
+		// MaxAttempts is the number of times the processing of each file is attempted, DefaultMaxAttempts if not set
+		MaxAttempts int
+		// FilesPerRun is the number of files processed by a run of the workflow, which continues as new with the
+		// next files, so the history of a run stays small however many files the batch has. DefaultFilesPerRun if
+		// not set.
+		FilesPerRun int
+		// NextFile and Result carry the progress of the batch when the workflow continues as new: the index in
+		// FileIDs of the next file to process, and the outcomes of the files before it. The listed files are
+		// carried in FileIDs.
+		NextFile int
+		Result   BatchResult
+	}
+
+	// BatchResult is the result of BatchFileProcessingWorkflow
+	BatchResult struct {
+		// Files are the outcomes of the files, in the order of the manifest
+		Files     []FileResult
+		Succeeded int
+		Failed    int
+	}
+
+	// FileResult is the outcome of the processing of a file
+	FileResult struct {
+		FileID   string
+		Attempts int
+		// Error of the last attempt, empty if the file was processed
+		Error string
+	}
+)
+
+// BatchFileProcessingWorkflow processes many files in parallel. Every file is processed in its own session, up to
+// BatchRequest.Concurrency at once, and is retried on its own when it fails, without processing the others again.
+// The workflow completes with the outcome of every file, even if some of them failed. It continues as new every
+// BatchRequest.FilesPerRun files. The AttemptHistoryQueryName query returns the []FileAttempt made to process the
+// files of the current run, by file ID.
+func BatchFileProcessingWorkflow(ctx workflow.Context, request BatchRequest) (BatchResult, error) {
+	logger := workflow.GetLogger(ctx)
+	ctx = withActivityOptions(ctx)
+
+	history := make(map[string][]FileAttempt)
+	err := workflow.SetQueryHandler(ctx, AttemptHistoryQueryName, func() (map[string][]FileAttempt, error) {
+		return history, nil
+	})
+	if err != nil {
+		return BatchResult{}, err
+	}
+
+	fileIDs := request.FileIDs
+	if len(fileIDs) == 0 {
+		var a *Activities
+		if err := workflow.ExecuteActivity(ctx, a.ListFilesActivity, request.Prefix).Get(ctx, &fileIDs); err != nil {
+			logger.Error("Failed to list files.", "Prefix", request.Prefix, "Error", err)
+			return BatchResult{}, err
+		}
+	}
+	concurrency := request.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+	maxAttempts := request.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	filesPerRun := request.FilesPerRun
+	if filesPerRun <= 0 {
+		filesPerRun = DefaultFilesPerRun
+	}
+	start := request.NextFile
+	end := start + filesPerRun
+	if end > len(fileIDs) {
+		end = len(fileIDs)
+	}
+
+	result := request.Result
+	result.Files = append(result.Files, make([]FileResult, end-start)...)
+	// slots holds a value per file being processed, so sending to it blocks once concurrency files are
+	slots := workflow.NewBufferedChannel(ctx, concurrency)
+	wg := workflow.NewWaitGroup(ctx)
+	for i := start; i < end; i++ {
+		slots.Send(ctx, true)
+		wg.Add(1)
+		i, fileID := i, fileIDs[i]
+		workflow.Go(ctx, func(ctx workflow.Context) {
+			defer wg.Done()
+			defer slots.Receive(ctx, nil)
+
+			attempts, err := processFileWithRetries(ctx, fileID, maxAttempts, func(attempt FileAttempt) {
+				history[fileID] = append(history[fileID], attempt)
+			})
+			result.Files[i] = FileResult{FileID: fileID, Attempts: attempts}
+			if err != nil {
+				result.Files[i].Error = err.Error()
+			}
+		})
+	}
+	wg.Wait(ctx)
+
+	for _, file := range result.Files[start:end] {
+		if file.Error == "" {
+			result.Succeeded++
+		} else {
+			result.Failed++
+		}
+	}
+
+	if end < len(fileIDs) {
+		logger.Info("Continuing with the next files.", "NextFile", end, "Succeeded", result.Succeeded,
+			"Failed", result.Failed)
+		request.FileIDs = fileIDs
+		request.NextFile = end
+		request.Result = result
+		return BatchResult{}, workflow.NewContinueAsNewError(ctx, BatchFileProcessingWorkflow, request)
+	}
+
+	logger.Info("Batch completed.", "Succeeded", result.Succeeded, "Failed", result.Failed)
+	return result, nil
+}
@@ -0,0 +1,161 @@
+package fileprocessing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.temporal.io/sdk/activity"
+)
+
+type (
+	// BlobStore stores the files processed by the workflow. Implementations must be safe for concurrent use.
+	BlobStore interface {
+		// Download saves the blob with the given name to the local file
+		Download(ctx context.Context, name, fileName string) error
+		// Upload stores the local file as the blob with the given name, replacing the existing one
+		Upload(ctx context.Context, fileName, name string) error
+	}
+
+	// BlobLister is implemented by the blob stores able to list their blobs
+	BlobLister interface {
+		// List returns the names of the blobs starting with prefix, sorted
+		List(ctx context.Context, prefix string) ([]string, error)
+	}
+
+	// DummyBlobStore makes up the content of the downloaded files and drops the uploaded ones
+	DummyBlobStore struct{}
+
+	// LocalBlobStore stores the blobs as files of a local directory
+	LocalBlobStore struct {
+		Dir string
+	}
+)
+
+// ErrInvalidBlobName is returned for blob names that would escape the directory of a LocalBlobStore
+var ErrInvalidBlobName = errors.New("invalid blob name")
+
+func (b *DummyBlobStore) Download(_ context.Context, name, fileName string) error {
+	// dummy downloader
+	dummyContent := "dummy content for fileID:" + name
+	return ioutil.WriteFile(fileName, []byte(dummyContent), 0644)
+}
+
+func (b *DummyBlobStore) Upload(ctx context.Context, fileName, _ string) error {
+	// dummy uploader
+	_, err := ioutil.ReadFile(fileName)
+	for i := 0; i < 5; i++ {
+		time.Sleep(1 * time.Second)
+		// Demonstrates that heartbeat accepts progress data.
+		// In case of a heartbeat timeout it is included into the error.
+		activity.RecordHeartbeat(ctx, i)
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (b *LocalBlobStore) Download(_ context.Context, name, fileName string) error {
+	path, err := b.path(name)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	return writeFile(fileName, in)
+}
+
+// Upload copies the file to a temporary file of the directory, then renames it, so the blob is never partially
+// written.
+func (b *LocalBlobStore) Upload(_ context.Context, fileName, name string) error {
+	path, err := b.path(name)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), ".upload")
+	if err != nil {
+		return err
+	}
+	_ = tmpFile.Close()
+	if err := writeFile(tmpFile.Name(), in); err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return err
+	}
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return err
+	}
+	return nil
+}
+
+// List walks the directory, skipping the hidden files, which include the temporary files of the uploads
+func (b *LocalBlobStore) List(_ context.Context, prefix string) ([]string, error) {
+	var names []string
+	err := filepath.Walk(b.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == b.Dir {
+				return nil
+			}
+			return err
+		}
+		if strings.HasPrefix(info.Name(), ".") && path != b.Dir {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		name, err := filepath.Rel(b.Dir, path)
+		if err != nil {
+			return err
+		}
+		if name = filepath.ToSlash(name); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+func (b *LocalBlobStore) path(name string) (string, error) {
+	name = filepath.Clean(filepath.FromSlash(name))
+	if name == "." || filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return "", ErrInvalidBlobName
+	}
+	return filepath.Join(b.Dir, name), nil
+}
+
+// writeFile writes the content of r to the file, which is created or truncated
+func writeFile(fileName string, r io.Reader) error {
+	out, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,386 @@
+package fileprocessing
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPartSize is the size of the parts of the multipart uploads when S3Options.PartSize is not set, it is
+// the minimum part size accepted by S3
+const DefaultPartSize = 5 * 1024 * 1024
+
+// checksumHeader is the metadata header storing the SHA-256 checksum of the uploaded blobs
+const checksumHeader = "X-Amz-Meta-Sha256"
+
+// emptyPayloadHash is the SHA-256 hash of an empty payload
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+type (
+	// S3Options configures an S3BlobStore
+	S3Options struct {
+		// Endpoint is the URL of the S3-compatible service, e.g. https://s3.us-east-1.amazonaws.com or
+		// http://localhost:9000 for MinIO. Buckets are addressed in the path.
+		Endpoint        string
+		Region          string
+		Bucket          string
+		AccessKeyID     string
+		SecretAccessKey string
+		// PartSize is the size of the parts of the multipart uploads, files up to PartSize are uploaded at once.
+		// DefaultPartSize if not set.
+		PartSize int64
+		// HTTPClient sends the requests, http.DefaultClient if not set
+		HTTPClient *http.Client
+	}
+
+	// S3BlobStore stores the blobs in a bucket of an S3-compatible service. The requests are signed with AWS
+	// Signature Version 4. The SHA-256 checksum of the uploaded files is stored in their metadata and verified
+	// when they are downloaded, and the MD5 checksum of every uploaded part is verified by the service.
+	S3BlobStore struct {
+		options S3Options
+		// now returns the time the requests are signed at
+		now func() time.Time
+	}
+
+	// S3Error is returned when the service responds with an error
+	S3Error struct {
+		StatusCode int
+		Code       string `xml:"Code"`
+		Message    string `xml:"Message"`
+	}
+
+	initiateMultipartUploadResult struct {
+		UploadID string `xml:"UploadId"`
+	}
+
+	listBucketResult struct {
+		Contents []struct {
+			Key string `xml:"Key"`
+		} `xml:"Contents"`
+		IsTruncated           bool   `xml:"IsTruncated"`
+		NextContinuationToken string `xml:"NextContinuationToken"`
+	}
+
+	completeMultipartUpload struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}
+
+	completedPart struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+)
+
+// ErrChecksumMismatch is returned when the checksum of a transferred file doesn't match the expected one
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// NewS3BlobStore returns an S3BlobStore
+func NewS3BlobStore(options S3Options) *S3BlobStore {
+	if options.PartSize <= 0 {
+		options.PartSize = DefaultPartSize
+	}
+	if options.HTTPClient == nil {
+		options.HTTPClient = http.DefaultClient
+	}
+	options.Endpoint = strings.TrimSuffix(options.Endpoint, "/")
+	return &S3BlobStore{options: options, now: time.Now}
+}
+
+func (e *S3Error) Error() string {
+	return fmt.Sprintf("s3: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Download saves the blob to the file and verifies its checksum, the file is removed if it doesn't match
+func (s *S3BlobStore) Download(ctx context.Context, name, fileName string) error {
+	resp, err := s.do(ctx, http.MethodGet, name, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	hash := sha256.New()
+	if err := writeFile(fileName, io.TeeReader(resp.Body, hash)); err != nil {
+		_ = os.Remove(fileName)
+		return err
+	}
+	if checksum := resp.Header.Get(checksumHeader); checksum != "" && checksum != hex.EncodeToString(hash.Sum(nil)) {
+		_ = os.Remove(fileName)
+		return fmt.Errorf("download %s: %w", name, ErrChecksumMismatch)
+	}
+	return nil
+}
+
+// List lists the objects of the bucket page by page, their keys are sorted by the service
+func (s *S3BlobStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		if err := decodeXML(resp, &result); err != nil {
+			return nil, err
+		}
+		for _, object := range result.Contents {
+			names = append(names, object.Key)
+		}
+		if !result.IsTruncated {
+			return names, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+// Upload uploads the file at once if it fits in a part, and with a multipart upload otherwise
+func (s *S3BlobStore) Upload(ctx context.Context, fileName, name string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	// the checksum of the whole file is stored in the metadata, so it is computed first
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return err
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if size <= s.options.PartSize {
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		_, err = s.putPart(ctx, name, nil, data, http.Header{checksumHeader: {checksum}})
+		return err
+	}
+	return s.multipartUpload(ctx, f, name, checksum)
+}
+
+func (s *S3BlobStore) multipartUpload(ctx context.Context, r io.Reader, name, checksum string) error {
+	resp, err := s.do(ctx, http.MethodPost, name, url.Values{"uploads": {""}}, http.Header{checksumHeader: {checksum}}, nil)
+	if err != nil {
+		return err
+	}
+	var initiated initiateMultipartUploadResult
+	err = decodeXML(resp, &initiated)
+	if err != nil {
+		return err
+	}
+
+	uploadID := initiated.UploadID
+	complete := completeMultipartUpload{}
+	err = func() error {
+		buf := make([]byte, s.options.PartSize)
+		for partNumber := 1; ; partNumber++ {
+			n, err := io.ReadFull(r, buf)
+			if err == io.EOF {
+				break
+			}
+			if err != nil && err != io.ErrUnexpectedEOF {
+				return err
+			}
+			query := url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {uploadID}}
+			etag, err := s.putPart(ctx, name, query, buf[:n], nil)
+			if err != nil {
+				return err
+			}
+			complete.Parts = append(complete.Parts, completedPart{PartNumber: partNumber, ETag: etag})
+		}
+
+		body, err := xml.Marshal(complete)
+		if err != nil {
+			return err
+		}
+		resp, err := s.do(ctx, http.MethodPost, name, url.Values{"uploadId": {uploadID}}, nil, body)
+		if err != nil {
+			return err
+		}
+		// the completion can fail after the response status was sent, the error is then in the body
+		return decodeXML(resp, &struct{}{})
+	}()
+	if err != nil {
+		// best effort, the parts of an upload that is not aborted are kept by the service
+		if resp, abortErr := s.do(ctx, http.MethodDelete, name, url.Values{"uploadId": {uploadID}}, nil, nil); abortErr == nil {
+			_ = resp.Body.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+// putPart uploads an object, or a part of a multipart upload, and verifies its MD5 checksum. It returns the
+// ETag of the uploaded data.
+func (s *S3BlobStore) putPart(ctx context.Context, name string, query url.Values, data []byte, header http.Header) (string, error) {
+	sum := md5.Sum(data)
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Md5", base64.StdEncoding.EncodeToString(sum[:]))
+	resp, err := s.do(ctx, http.MethodPut, name, query, header, data)
+	if err != nil {
+		return "", err
+	}
+	_ = resp.Body.Close()
+	// the ETag of the objects uploaded at once, and of the parts, is their MD5 checksum
+	etag := resp.Header.Get("ETag")
+	if strings.Trim(etag, `"`) != hex.EncodeToString(sum[:]) {
+		return "", fmt.Errorf("upload %s: %w", name, ErrChecksumMismatch)
+	}
+	return etag, nil
+}
+
+// do sends a signed request for the object with the given name, it returns an *S3Error for error responses
+func (s *S3BlobStore) do(ctx context.Context, method, name string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := s.options.Endpoint + "/" + uriEncode(s.options.Bucket, true) + "/" + uriEncode(name, false)
+	if len(query) > 0 {
+		u += "?" + canonicalQuery(query)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+	signV4(req, payloadHash, s.options.Region, s.options.AccessKeyID, s.options.SecretAccessKey, s.now())
+
+	resp, err := s.options.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer func() { _ = resp.Body.Close() }()
+		s3Err := &S3Error{}
+		_ = xml.NewDecoder(resp.Body).Decode(s3Err)
+		s3Err.StatusCode = resp.StatusCode
+		if s3Err.Code == "" {
+			s3Err.Code = http.StatusText(resp.StatusCode)
+		}
+		return nil, s3Err
+	}
+	return resp, nil
+}
+
+// decodeXML decodes the body of the response into v, or returns the error it holds, and closes it
+func decodeXML(resp *http.Response, v interface{}) error {
+	defer func() { _ = resp.Body.Close() }()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var root struct{ XMLName xml.Name }
+	if err := xml.Unmarshal(body, &root); err != nil {
+		return err
+	}
+	if root.XMLName.Local == "Error" {
+		s3Err := &S3Error{StatusCode: resp.StatusCode}
+		_ = xml.Unmarshal(body, s3Err)
+		return s3Err
+	}
+	return xml.Unmarshal(body, v)
+}
+
+// signV4 signs the request with AWS Signature Version 4. Every header of the request is signed, along with the host.
+func signV4(req *http.Request, payloadHash, region, accessKeyID, secretAccessKey string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + secretAccessKey)
+	for _, data := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, data)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery returns the query sorted by key with its keys and values encoded as required by the signature
+func canonicalQuery(query url.Values) string {
+	var params []string
+	for key, values := range query {
+		for _, value := range values {
+			params = append(params, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// uriEncode percent-encodes every byte but the unreserved characters, and the slashes unless encodeSlash is set
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !encodeSlash {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
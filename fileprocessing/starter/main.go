@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
+	"strings"
 
 	"github.com/pborman/uuid"
 	"go.temporal.io/sdk/client"
@@ -11,6 +13,15 @@ import (
 )
 
 func main() {
+	var fileID, batch, prefix string
+	var concurrency, filesPerRun int
+	flag.StringVar(&fileID, "f", uuid.New(), "ID of the file to process, its name in the blob store.")
+	flag.StringVar(&batch, "b", "", "Comma separated IDs of the files to process in a batch.")
+	flag.StringVar(&prefix, "prefix", "", "Process the files of the blob store starting with the prefix in a batch.")
+	flag.IntVar(&concurrency, "c", fileprocessing.DefaultBatchConcurrency, "Number of files of the batch processed at once.")
+	flag.IntVar(&filesPerRun, "files-per-run", fileprocessing.DefaultFilesPerRun, "Number of files of the batch processed before continuing as new.")
+	flag.Parse()
+
 	// The client is a heavyweight object that should be created once per process.
 	c, err := client.NewClient(client.Options{
 		HostPort: client.DefaultHostPort,
@@ -20,13 +31,24 @@ func main() {
 	}
 	defer c.Close()
 
-	fileID := uuid.New()
-	workflowOptions := client.StartWorkflowOptions{
-		ID:        "fileprocessing_" + fileID,
-		TaskQueue: "fileprocessing",
+	var we client.WorkflowRun
+	if batch != "" || prefix != "" {
+		request := fileprocessing.BatchRequest{Prefix: prefix, Concurrency: concurrency, FilesPerRun: filesPerRun}
+		if batch != "" {
+			request.FileIDs = strings.Split(batch, ",")
+		}
+		workflowOptions := client.StartWorkflowOptions{
+			ID:        "fileprocessing_batch_" + uuid.New(),
+			TaskQueue: "fileprocessing",
+		}
+		we, err = c.ExecuteWorkflow(context.Background(), workflowOptions, fileprocessing.BatchFileProcessingWorkflow, request)
+	} else {
+		workflowOptions := client.StartWorkflowOptions{
+			ID:        "fileprocessing_" + fileID,
+			TaskQueue: "fileprocessing",
+		}
+		we, err = c.ExecuteWorkflow(context.Background(), workflowOptions, fileprocessing.SampleFileProcessingWorkflow, fileID)
 	}
-
-	we, err := c.ExecuteWorkflow(context.Background(), workflowOptions, fileprocessing.SampleFileProcessingWorkflow, fileID)
 	if err != nil {
 		log.Fatalln("Unable to execute workflow", err)
 	}
@@ -0,0 +1,328 @@
+package fileprocessing
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// Names of the transcoders of NewTranscoderRegistry
+const (
+	TranscoderUpperCase = "uppercase"
+	TranscoderGzip      = "gzip"
+	TranscoderGunzip    = "gunzip"
+	TranscoderCSVToJSON = "csv2jsonl"
+	TranscoderStats     = "stats"
+	TranscoderResize    = "resize"
+)
+
+// DefaultImageSize is the maximum width and height of the images written by the resize transcoder
+const DefaultImageSize = 256
+
+type (
+	// Transcoder transforms the content of a file, reading it from r and writing the result to w
+	Transcoder interface {
+		Transcode(ctx context.Context, r io.Reader, w io.Writer) error
+	}
+
+	// ChunkTranscoder is a Transcoder transforming every chunk of a file independently, so the processing of a
+	// file can resume from the middle of it
+	ChunkTranscoder interface {
+		Transcoder
+		TranscodeChunk(data []byte) []byte
+	}
+
+	// TranscoderRegistry holds the transcoders by name. It is not safe for concurrent use while transcoders are
+	// registered.
+	TranscoderRegistry struct {
+		transcoders map[string]Transcoder
+	}
+
+	// FileStats is the report written by the stats transcoder
+	FileStats struct {
+		Bytes         int64 `json:"bytes"`
+		Lines         int64 `json:"lines"`
+		Words         int64 `json:"words"`
+		MaxLineLength int   `json:"maxLineLength"`
+	}
+
+	// DataError is returned by the transcoders when the content of the file is invalid
+	DataError struct {
+		Err error
+	}
+
+	upperCaseTranscoder struct{}
+	gzipTranscoder      struct{}
+	gunzipTranscoder    struct{}
+	csvToJSONTranscoder struct{}
+	statsTranscoder     struct{}
+
+	// resizeTranscoder scales the JPEG and PNG images down to fit in MaxSize x MaxSize, keeping their format and
+	// aspect ratio. Smaller images keep their size.
+	resizeTranscoder struct {
+		MaxSize int
+	}
+)
+
+// ErrUnknownTranscoder is returned for transcoders missing from the registry
+var ErrUnknownTranscoder = errors.New("unknown transcoder")
+
+var (
+	// pipelines are the names of the transcoders applied to the files, by MIME type
+	pipelines = map[string][]string{
+		"text/csv":         {TranscoderCSVToJSON, TranscoderGzip},
+		"text/plain":       {TranscoderStats},
+		"application/gzip": {TranscoderGunzip, TranscoderStats},
+		"application/json": {TranscoderGzip},
+		"image/jpeg":       {TranscoderResize},
+		"image/png":        {TranscoderResize},
+	}
+	// defaultPipeline is applied to the files of the other types
+	defaultPipeline = []string{TranscoderUpperCase}
+
+	// mimeTypes are the MIME types of the file extensions. The mime package is not used as its types depend on
+	// the host, while the selection of the pipeline must be deterministic.
+	mimeTypes = map[string]string{
+		".csv":   "text/csv",
+		".txt":   "text/plain",
+		".log":   "text/plain",
+		".gz":    "application/gzip",
+		".json":  "application/json",
+		".jsonl": "application/json",
+		".jpg":   "image/jpeg",
+		".jpeg":  "image/jpeg",
+		".png":   "image/png",
+	}
+)
+
+// SelectPipeline returns the names of the transcoders applied to the file, in order, from the MIME type of
+// its extension. It is deterministic, so it can be called by workflows.
+func SelectPipeline(fileName string) []string {
+	pipeline, ok := pipelines[mimeTypes[strings.ToLower(path.Ext(fileName))]]
+	if !ok {
+		pipeline = defaultPipeline
+	}
+	return append([]string(nil), pipeline...)
+}
+
+// NewTranscoderRegistry returns a registry holding the transcoders named by the Transcoder constants
+func NewTranscoderRegistry() *TranscoderRegistry {
+	r := &TranscoderRegistry{transcoders: make(map[string]Transcoder)}
+	r.Register(TranscoderUpperCase, upperCaseTranscoder{})
+	r.Register(TranscoderGzip, gzipTranscoder{})
+	r.Register(TranscoderGunzip, gunzipTranscoder{})
+	r.Register(TranscoderCSVToJSON, csvToJSONTranscoder{})
+	r.Register(TranscoderStats, statsTranscoder{})
+	r.Register(TranscoderResize, resizeTranscoder{MaxSize: DefaultImageSize})
+	return r
+}
+
+// Register adds the transcoder, replacing the one with the same name
+func (r *TranscoderRegistry) Register(name string, transcoder Transcoder) {
+	r.transcoders[name] = transcoder
+}
+
+// Get returns the transcoder with the given name, or ErrUnknownTranscoder
+func (r *TranscoderRegistry) Get(name string) (Transcoder, error) {
+	transcoder, ok := r.transcoders[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTranscoder, name)
+	}
+	return transcoder, nil
+}
+
+func (e *DataError) Error() string {
+	return "invalid data: " + e.Err.Error()
+}
+
+func (e *DataError) Unwrap() error {
+	return e.Err
+}
+
+func (t upperCaseTranscoder) Transcode(_ context.Context, r io.Reader, w io.Writer) error {
+	return transcodeChunks(r, w, DefaultChunkSize, t.TranscodeChunk, func(int, int) error { return nil })
+}
+
+func (upperCaseTranscoder) TranscodeChunk(data []byte) []byte {
+	// dummy file processor, just do upper case for the data.
+	return bytes.ToUpper(data)
+}
+
+func (gzipTranscoder) Transcode(_ context.Context, r io.Reader, w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	if _, err := io.Copy(zw, r); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func (gunzipTranscoder) Transcode(_ context.Context, r io.Reader, w io.Writer) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return gzipDataError(err)
+	}
+	if _, err := io.Copy(w, zr); err != nil {
+		return gzipDataError(err)
+	}
+	return zr.Close()
+}
+
+// gzipDataError returns a DataError for the errors caused by an invalid compressed file
+func gzipDataError(err error) error {
+	var corruptErr flate.CorruptInputError
+	if errors.Is(err, gzip.ErrHeader) || errors.Is(err, gzip.ErrChecksum) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &corruptErr) {
+		return &DataError{Err: err}
+	}
+	return err
+}
+
+// Transcode writes a JSON object per record, the keys of which are the fields of the header
+func (csvToJSONTranscoder) Transcode(_ context.Context, r io.Reader, w io.Writer) error {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return csvDataError(err)
+	}
+	bw := bufio.NewWriter(w)
+	encoder := json.NewEncoder(bw)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return csvDataError(err)
+		}
+		object := make(map[string]string, len(header))
+		for i, field := range record {
+			object[header[i]] = field
+		}
+		if err := encoder.Encode(object); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// csvDataError returns a DataError for the errors caused by an invalid CSV file
+func csvDataError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return &DataError{Err: err}
+	}
+	return err
+}
+
+// Transcode writes the FileStats of the file as JSON
+func (statsTranscoder) Transcode(_ context.Context, r io.Reader, w io.Writer) error {
+	var stats FileStats
+	reader := bufio.NewReader(r)
+	lineLength, inWord := 0, false
+	for {
+		c, size, err := reader.ReadRune()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		stats.Bytes += int64(size)
+		if c == '\n' {
+			stats.Lines++
+			lineLength = 0
+		} else {
+			lineLength++
+			if lineLength > stats.MaxLineLength {
+				stats.MaxLineLength = lineLength
+			}
+		}
+		if unicode.IsSpace(c) {
+			inWord = false
+		} else if !inWord {
+			inWord = true
+			stats.Words++
+		}
+	}
+	// the last line may not end with a new line
+	if lineLength > 0 {
+		stats.Lines++
+	}
+	return json.NewEncoder(w).Encode(stats)
+}
+
+// Transcode decodes the whole image, scales it down and encodes it in its format
+func (t resizeTranscoder) Transcode(_ context.Context, r io.Reader, w io.Writer) error {
+	img, format, err := image.Decode(r)
+	if err != nil {
+		return imageDataError(err)
+	}
+	resized := resizeImage(img, t.MaxSize)
+	if format == "jpeg" {
+		return jpeg.Encode(w, resized, nil)
+	}
+	return png.Encode(w, resized)
+}
+
+// resizeImage scales the image down to fit in maxSize x maxSize. Every pixel of the result is the average of the
+// pixels of the image it covers.
+func resizeImage(img image.Image, maxSize int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSize && height <= maxSize {
+		return img
+	}
+	newWidth, newHeight := maxSize, maxSize
+	if width > height {
+		newHeight = (height*maxSize + width - 1) / width
+	} else {
+		newWidth = (width*maxSize + height - 1) / height
+	}
+
+	resized := image.NewRGBA64(image.Rect(0, 0, newWidth, newHeight))
+	for y := 0; y < newHeight; y++ {
+		y0, y1 := bounds.Min.Y+y*height/newHeight, bounds.Min.Y+(y+1)*height/newHeight
+		for x := 0; x < newWidth; x++ {
+			x0, x1 := bounds.Min.X+x*width/newWidth, bounds.Min.X+(x+1)*width/newWidth
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa), n+1
+				}
+			}
+			resized.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	return resized
+}
+
+// imageDataError returns a DataError for the errors caused by an invalid or unsupported image
+func imageDataError(err error) error {
+	var jpegFormatErr jpeg.FormatError
+	var jpegUnsupportedErr jpeg.UnsupportedError
+	var pngFormatErr png.FormatError
+	var pngUnsupportedErr png.UnsupportedError
+	if errors.Is(err, image.ErrFormat) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &jpegFormatErr) ||
+		errors.As(err, &jpegUnsupportedErr) || errors.As(err, &pngFormatErr) || errors.As(err, &pngUnsupportedErr) {
+		return &DataError{Err: err}
+	}
+	return err
+}
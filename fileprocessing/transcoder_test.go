@@ -0,0 +1,128 @@
+package fileprocessing
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TranscoderTestSuite struct {
+	suite.Suite
+	registry *TranscoderRegistry
+}
+
+func TestTranscoderTestSuite(t *testing.T) {
+	suite.Run(t, new(TranscoderTestSuite))
+}
+
+func (s *TranscoderTestSuite) SetupTest() {
+	s.registry = NewTranscoderRegistry()
+}
+
+func (s *TranscoderTestSuite) Test_UpperCase() {
+	s.Equal("HÉLLO WÖRLD", s.transcode(TranscoderUpperCase, "héllo wörld"))
+}
+
+func (s *TranscoderTestSuite) Test_Gzip() {
+	data := strings.Repeat("compressible content ", 100)
+	compressed := s.transcode(TranscoderGzip, data)
+	s.Less(len(compressed), len(data))
+	s.Equal(data, s.transcode(TranscoderGunzip, compressed))
+
+	_, err := s.tryTranscode(TranscoderGunzip, "not gzip")
+	s.Error(err)
+}
+
+func (s *TranscoderTestSuite) Test_CSVToJSON() {
+	s.Equal(`{"id":"1","name":"one, two"}`+"\n"+`{"id":"2","name":""}`+"\n",
+		s.transcode(TranscoderCSVToJSON, "id,name\n1,\"one, two\"\n2,\n"))
+	s.Equal("", s.transcode(TranscoderCSVToJSON, ""))
+
+	_, err := s.tryTranscode(TranscoderCSVToJSON, "id,name\n1,one,extra\n")
+	var parseErr *csv.ParseError
+	s.True(errors.As(err, &parseErr))
+	s.Equal(2, parseErr.Line)
+}
+
+func (s *TranscoderTestSuite) Test_Stats() {
+	s.Equal(`{"bytes":27,"lines":4,"words":5,"maxLineLength":11}`+"\n",
+		s.transcode(TranscoderStats, "héllo wörld\n\none  two\nend"))
+	s.Equal(`{"bytes":0,"lines":0,"words":0,"maxLineLength":0}`+"\n", s.transcode(TranscoderStats, ""))
+}
+
+func (s *TranscoderTestSuite) Test_Resize() {
+	// left half red, right half blue
+	img := image.NewRGBA(image.Rect(0, 0, 4*DefaultImageSize, DefaultImageSize))
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= img.Bounds().Dx()/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var data bytes.Buffer
+	s.NoError(png.Encode(&data, img))
+
+	resized, format, err := image.Decode(strings.NewReader(s.transcode(TranscoderResize, data.String())))
+	s.NoError(err)
+	s.Equal("png", format)
+	s.Equal(image.Rect(0, 0, DefaultImageSize, DefaultImageSize/4), resized.Bounds())
+	s.Equal(color.RGBA64{R: 0xffff, A: 0xffff}, color.RGBA64Model.Convert(resized.At(0, 0)))
+	s.Equal(color.RGBA64{B: 0xffff, A: 0xffff}, color.RGBA64Model.Convert(resized.At(DefaultImageSize-1, 0)))
+
+	// JPEG images stay JPEG, small images keep their size
+	data.Reset()
+	s.NoError(jpeg.Encode(&data, image.NewGray(image.Rect(0, 0, 10, 20)), nil))
+	resized, format, err = image.Decode(strings.NewReader(s.transcode(TranscoderResize, data.String())))
+	s.NoError(err)
+	s.Equal("jpeg", format)
+	s.Equal(image.Rect(0, 0, 10, 20), resized.Bounds())
+
+	_, err = s.tryTranscode(TranscoderResize, "not an image")
+	var dataErr *DataError
+	s.True(errors.As(err, &dataErr))
+	_, err = s.tryTranscode(TranscoderResize, data.String()[:data.Len()/2])
+	s.True(errors.As(err, &dataErr))
+}
+
+func (s *TranscoderTestSuite) Test_Registry() {
+	_, err := s.registry.Get("unknown")
+	s.True(errors.Is(err, ErrUnknownTranscoder))
+
+	s.registry.Register("unknown", upperCaseTranscoder{})
+	s.Equal("A", s.transcode("unknown", "a"))
+}
+
+func (s *TranscoderTestSuite) Test_SelectPipeline() {
+	s.Equal([]string{TranscoderCSVToJSON, TranscoderGzip}, SelectPipeline("dir/data.CSV"))
+	s.Equal([]string{TranscoderGunzip, TranscoderStats}, SelectPipeline("app.log.gz"))
+	s.Equal([]string{TranscoderStats}, SelectPipeline("notes.txt"))
+	s.Equal([]string{TranscoderResize}, SelectPipeline("photo.JPG"))
+	s.Equal([]string{TranscoderResize}, SelectPipeline("icon.png"))
+	s.Equal([]string{TranscoderUpperCase}, SelectPipeline("dc5c1fe7-2a9e-4b0f-a1f5-3f0c6f0c0b4e"))
+}
+
+func (s *TranscoderTestSuite) transcode(name, input string) string {
+	output, err := s.tryTranscode(name, input)
+	s.NoError(err)
+	return output
+}
+
+func (s *TranscoderTestSuite) tryTranscode(name, input string) (string, error) {
+	transcoder, err := s.registry.Get(name)
+	s.NoError(err)
+	var out bytes.Buffer
+	err = transcoder.Transcode(context.Background(), strings.NewReader(input), &out)
+	return out.String(), err
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"os"
 
 	"go.temporal.io/sdk/client"
 	"go.temporal.io/sdk/worker"
@@ -10,6 +12,33 @@ import (
 )
 
 func main() {
+	var storeType, dir, destination string
+	var s3Options fileprocessing.S3Options
+	flag.StringVar(&storeType, "store", "dummy", "Blob store: dummy, local or s3.")
+	flag.StringVar(&dir, "dir", "blobs", "Directory of the local blob store.")
+	flag.StringVar(&s3Options.Endpoint, "endpoint", "http://localhost:9000", "Endpoint of the S3-compatible service.")
+	flag.StringVar(&s3Options.Region, "region", "us-east-1", "Region of the S3 bucket.")
+	flag.StringVar(&s3Options.Bucket, "bucket", "fileprocessing", "S3 bucket.")
+	var sessions int
+	flag.IntVar(&sessions, "sessions", 1000, "Maximum number of sessions run at once by the worker.")
+	flag.StringVar(&destination, "dest", fileprocessing.DefaultDestinationFormat, "Format of the name of the processed files, given the file ID.")
+	flag.Parse()
+	// the credentials are read from the environment, like the AWS tools do
+	s3Options.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	s3Options.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+
+	var blobStore fileprocessing.BlobStore
+	switch storeType {
+	case "dummy":
+		blobStore = &fileprocessing.DummyBlobStore{}
+	case "local":
+		blobStore = &fileprocessing.LocalBlobStore{Dir: dir}
+	case "s3":
+		blobStore = fileprocessing.NewS3BlobStore(s3Options)
+	default:
+		log.Fatalln("Unknown blob store", storeType)
+	}
+
 	// The client and worker are heavyweight objects that should be created once per process.
 	c, err := client.NewClient(client.Options{
 		HostPort: client.DefaultHostPort,
@@ -21,11 +50,14 @@ func main() {
 
 	workerOptions := worker.Options{
 		EnableSessionWorker: true, // Important for a worker to participate in the session
+		// Limits the sessions, so the files of a batch are spread over the workers
+		MaxConcurrentSessionExecutionSize: sessions,
 	}
 	w := worker.New(c, "fileprocessing", workerOptions)
 
 	w.RegisterWorkflow(fileprocessing.SampleFileProcessingWorkflow)
-	w.RegisterActivity(&fileprocessing.Activities{BlobStore: &fileprocessing.BlobStore{}})
+	w.RegisterWorkflow(fileprocessing.BatchFileProcessingWorkflow)
+	w.RegisterActivity(&fileprocessing.Activities{BlobStore: blobStore, DestinationFormat: destination})
 
 	err = w.Run(worker.InterruptCh())
 	if err != nil {
@@ -1,6 +1,8 @@
 package fileprocessing
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"go.temporal.io/sdk/temporal"
@@ -8,8 +10,58 @@ import (
 	"go.temporal.io/sdk/workflow"
 )
 
-// SampleFileProcessingWorkflow workflow definition
+// DefaultMaxAttempts is the number of times the processing of a file is attempted when no other value is given
+const DefaultMaxAttempts = 4
+
+// AttemptHistoryQueryName is the name of the query returning the attempts made to process the files
+const AttemptHistoryQueryName = "attempt-history"
+
+// Outcomes of the attempts to process a file
+const (
+	AttemptCompleted     = "completed"
+	AttemptSessionFailed = "session-failed"
+	AttemptDataError     = "data-error"
+	AttemptFailed        = "failed"
+)
+
+// FileAttempt is an attempt to process a file in a session
+type FileAttempt struct {
+	Attempt int
+	// Host of the session, empty if the session could not be created
+	Host    string
+	Start   time.Time
+	End     time.Time
+	Outcome string
+	Error   string
+}
+
+// SampleFileProcessingWorkflow workflow definition. The AttemptHistoryQueryName query returns the []FileAttempt
+// made to process the file.
 func SampleFileProcessingWorkflow(ctx workflow.Context, fileName string) (err error) {
+	ctx = withActivityOptions(ctx)
+
+	var history []FileAttempt
+	err = workflow.SetQueryHandler(ctx, AttemptHistoryQueryName, func() ([]FileAttempt, error) {
+		return history, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = processFileWithRetries(ctx, fileName, DefaultMaxAttempts, func(attempt FileAttempt) {
+		history = append(history, attempt)
+	})
+	if err != nil {
+		workflow.GetLogger(ctx).Error("Workflow failed.", "Error", err.Error())
+	} else {
+		workflow.GetLogger(ctx).Info("Workflow completed.")
+	}
+	return err
+}
+
+// withActivityOptions retries the activities a few times on the host of their session, which covers the transient
+// errors. Data errors are not retried, see DataErrorType.
+func withActivityOptions(ctx workflow.Context) workflow.Context {
 	ao := workflow.ActivityOptions{
 		StartToCloseTimeout: time.Minute,
 		HeartbeatTimeout:    time.Second * 2, // such a short timeout to make sample fail over very fast
@@ -17,52 +69,98 @@ func SampleFileProcessingWorkflow(ctx workflow.Context, fileName string) (err er
 			InitialInterval:    time.Second,
 			BackoffCoefficient: 2.0,
 			MaximumInterval:    time.Minute,
+			MaximumAttempts:    5,
 		},
 	}
-	ctx = workflow.WithActivityOptions(ctx, ao)
-
-	// Retry the whole sequence from the first activity on any error
-	// to retry it on a different host. In a real application it might be reasonable to
-	// retry individual activities as well as the whole sequence discriminating between different types of errors.
-	// See the retryactivity sample for a more sophisticated retry implementation.
-	for i := 1; i < 5; i++ {
-		err = processFile(ctx, fileName)
-		if err == nil {
-			break
+	return workflow.WithActivityOptions(ctx, ao)
+}
+
+// processFileWithRetries processes the file, up to maxAttempts times, calling record after every attempt. It
+// returns the number of attempts made.
+//
+// The whole sequence is only retried in a new session when the session failed, i.e. the worker hosting it died,
+// as the downloaded file is lost with it. The new session is created on a worker still running. The activities
+// already retry the transient errors on the host of the session, so the processing fails when they give up, and
+// fails fast on data errors, as processing the same data again would fail again.
+func processFileWithRetries(ctx workflow.Context, fileName string, maxAttempts int, record func(FileAttempt)) (attempts int, err error) {
+	logger := workflow.GetLogger(ctx)
+	for attempts < maxAttempts {
+		attempts++
+		attempt := FileAttempt{Attempt: attempts, Start: workflow.Now(ctx)}
+		attempt.Host, err = processFile(ctx, fileName)
+		attempt.End = workflow.Now(ctx)
+		attempt.Outcome = attemptOutcome(err)
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+		record(attempt)
+
+		switch attempt.Outcome {
+		case AttemptCompleted:
+			return attempts, nil
+		case AttemptSessionFailed:
+			logger.Info("Session failed, processing the file in a new session.", "FileName", fileName,
+				"Attempt", attempts, "Host", attempt.Host, "Error", err)
+		default:
+			logger.Info("File processing failed.", "FileName", fileName, "Attempt", attempts, "Outcome", attempt.Outcome,
+				"Error", err)
+			return attempts, err
 		}
 	}
-	if err != nil {
-		workflow.GetLogger(ctx).Error("Workflow failed.", "Error", err.Error())
-	} else {
-		workflow.GetLogger(ctx).Info("Workflow completed.")
+	return attempts, err
+}
+
+// attemptOutcome classifies the error returned by processFile
+func attemptOutcome(err error) string {
+	var applicationErr *temporal.ApplicationError
+	switch {
+	case err == nil:
+		return AttemptCompleted
+	case errors.Is(err, workflow.ErrSessionFailed):
+		return AttemptSessionFailed
+	case errors.As(err, &applicationErr) && applicationErr.Type() == DataErrorType:
+		return AttemptDataError
 	}
-	return err
+	return AttemptFailed
 }
 
-func processFile(ctx workflow.Context, fileName string) (err error) {
+// processFile runs the activities in a session, it returns the host of the session. The error wraps
+// workflow.ErrSessionFailed if the session could not be created or failed.
+func processFile(ctx workflow.Context, fileName string) (host string, err error) {
 	so := &workflow.SessionOptions{
 		CreationTimeout:  time.Minute,
 		ExecutionTimeout: time.Minute,
 	}
 	sessionCtx, err := workflow.CreateSession(ctx, so)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("%w: %v", workflow.ErrSessionFailed, err)
 	}
 	defer workflow.CompleteSession(sessionCtx)
+	host = workflow.GetSessionInfo(sessionCtx).HostName
 
+	err = processFileInSession(sessionCtx, fileName)
+	// The activities running when the session fails are canceled, the next ones fail with ErrSessionFailed. The SDK
+	// does not expose the state of the session, but it cancels the session context when the session fails, while
+	// an activity canceling itself leaves it live.
+	if temporal.IsCanceledError(err) && sessionCtx.Err() != nil && ctx.Err() == nil {
+		return host, fmt.Errorf("%w: %v", workflow.ErrSessionFailed, err)
+	}
+	return host, err
+}
+
+func processFileInSession(sessionCtx workflow.Context, fileName string) error {
 	var downloadedName string
 	var a *Activities
-	err = workflow.ExecuteActivity(sessionCtx, a.DownloadFileActivity, fileName).Get(sessionCtx, &downloadedName)
+	err := workflow.ExecuteActivity(sessionCtx, a.DownloadFileActivity, fileName).Get(sessionCtx, &downloadedName)
 	if err != nil {
 		return err
 	}
 
 	var processedFileName string
-	err = workflow.ExecuteActivity(sessionCtx, a.ProcessFileActivity, downloadedName).Get(sessionCtx, &processedFileName)
+	err = workflow.ExecuteActivity(sessionCtx, a.ProcessFileActivity, downloadedName, SelectPipeline(fileName)).Get(sessionCtx, &processedFileName)
 	if err != nil {
 		return err
 	}
 
-	err = workflow.ExecuteActivity(sessionCtx, a.UploadFileActivity, processedFileName).Get(sessionCtx, nil)
-	return err
+	return workflow.ExecuteActivity(sessionCtx, a.UploadFileActivity, processedFileName, fileName).Get(sessionCtx, nil)
 }
@@ -1,10 +1,22 @@
 package fileprocessing
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
 
 	"github.com/stretchr/testify/suite"
 	"go.temporal.io/sdk/testsuite"
@@ -27,8 +39,8 @@ func (s *UnitTestSuite) Test_SampleFileProcessingWorkflow() {
 	var a *Activities
 
 	env.OnActivity(a.DownloadFileActivity, mock.Anything, "file1").Return("file2", nil)
-	env.OnActivity(a.ProcessFileActivity, mock.Anything, "file2").Return("file3", nil)
-	env.OnActivity(a.UploadFileActivity, mock.Anything, "file3").Return(nil)
+	env.OnActivity(a.ProcessFileActivity, mock.Anything, "file2", []string{TranscoderUpperCase}).Return("file3", nil)
+	env.OnActivity(a.UploadFileActivity, mock.Anything, "file3", "file1").Return(nil)
 
 	env.RegisterActivity(a)
 
@@ -39,3 +51,348 @@ func (s *UnitTestSuite) Test_SampleFileProcessingWorkflow() {
 
 	env.AssertExpectations(s.T())
 }
+
+func (s *UnitTestSuite) Test_BatchFileProcessingWorkflow() {
+	env := s.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{
+		EnableSessionWorker: true,
+	})
+	var a *Activities
+
+	for _, fileID := range []string{"file1", "flaky"} {
+		env.OnActivity(a.ProcessFileActivity, mock.Anything, fileID+"-downloaded", []string{TranscoderUpperCase}).
+			Return(fileID+"-processed", nil)
+		env.OnActivity(a.UploadFileActivity, mock.Anything, fileID+"-processed", fileID).Return(nil)
+	}
+	env.OnActivity(a.DownloadFileActivity, mock.Anything, "file1").Return("file1-downloaded", nil).Once()
+	// the session of flaky fails once, it is processed again without processing the other files again
+	failSessions(env, "flaky", 1)
+	env.OnActivity(a.DownloadFileActivity, mock.Anything, "flaky").Return("flaky-downloaded", nil).After(time.Minute).Once()
+	env.OnActivity(a.DownloadFileActivity, mock.Anything, "flaky").Return("flaky-downloaded", nil).Once()
+	// bad is not processed again after a data error
+	env.OnActivity(a.DownloadFileActivity, mock.Anything, "bad").
+		Return("", temporal.NewNonRetryableApplicationError("corrupted", DataErrorType, nil)).Once()
+	env.OnActivity(a.ListFilesActivity, mock.Anything, "files/").Return([]string{"file1", "flaky", "bad"}, nil)
+
+	env.RegisterActivity(a)
+
+	env.ExecuteWorkflow(BatchFileProcessingWorkflow, BatchRequest{Prefix: "files/", Concurrency: 2, MaxAttempts: 2})
+
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	var result BatchResult
+	s.NoError(env.GetWorkflowResult(&result))
+	s.Equal(2, result.Succeeded)
+	s.Equal(1, result.Failed)
+	s.Equal([]FileResult{
+		{FileID: "file1", Attempts: 1},
+		{FileID: "flaky", Attempts: 2},
+		{FileID: "bad", Attempts: 1, Error: result.Files[2].Error},
+	}, result.Files)
+	s.Contains(result.Files[2].Error, "corrupted")
+
+	val, err := env.QueryWorkflow(AttemptHistoryQueryName)
+	s.NoError(err)
+	var history map[string][]FileAttempt
+	s.NoError(val.Get(&history))
+	s.Equal([]string{AttemptCompleted}, attemptOutcomes(history["file1"]))
+	s.Equal([]string{AttemptSessionFailed, AttemptCompleted}, attemptOutcomes(history["flaky"]))
+	s.Equal([]string{AttemptDataError}, attemptOutcomes(history["bad"]))
+
+	env.AssertExpectations(s.T())
+}
+
+func (s *UnitTestSuite) Test_BatchFileProcessingWorkflowContinuesAsNew() {
+	env := s.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{
+		EnableSessionWorker: true,
+	})
+	var a *Activities
+
+	for _, fileID := range []string{"file1", "file2"} {
+		env.OnActivity(a.DownloadFileActivity, mock.Anything, fileID).Return(fileID+"-downloaded", nil).Once()
+		env.OnActivity(a.ProcessFileActivity, mock.Anything, fileID+"-downloaded", []string{TranscoderUpperCase}).
+			Return(fileID+"-processed", nil)
+		env.OnActivity(a.UploadFileActivity, mock.Anything, fileID+"-processed", fileID).Return(nil)
+	}
+	env.OnActivity(a.ListFilesActivity, mock.Anything, "files/").Return([]string{"file1", "file2", "bad"}, nil).Once()
+
+	env.RegisterActivity(a)
+
+	env.ExecuteWorkflow(BatchFileProcessingWorkflow, BatchRequest{Prefix: "files/", FilesPerRun: 2})
+
+	s.True(env.IsWorkflowCompleted())
+	err := env.GetWorkflowError()
+	var continueAsNewErr *workflow.ContinueAsNewError
+	s.True(errors.As(err, &continueAsNewErr))
+	var request BatchRequest
+	s.NoError(converter.GetDefaultDataConverter().FromPayloads(continueAsNewErr.Input, &request))
+	// the listed files are carried, they are not listed again
+	s.Equal(BatchRequest{
+		FileIDs:     []string{"file1", "file2", "bad"},
+		Prefix:      "files/",
+		FilesPerRun: 2,
+		NextFile:    2,
+		Result: BatchResult{
+			Files:     []FileResult{{FileID: "file1", Attempts: 1}, {FileID: "file2", Attempts: 1}},
+			Succeeded: 2,
+		},
+	}, request)
+	env.AssertExpectations(s.T())
+
+	env = s.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{
+		EnableSessionWorker: true,
+	})
+	env.OnActivity(a.DownloadFileActivity, mock.Anything, "bad").
+		Return("", temporal.NewNonRetryableApplicationError("corrupted", DataErrorType, nil)).Once()
+
+	env.RegisterActivity(a)
+
+	env.ExecuteWorkflow(BatchFileProcessingWorkflow, request)
+
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	var result BatchResult
+	s.NoError(env.GetWorkflowResult(&result))
+	s.Equal(2, result.Succeeded)
+	s.Equal(1, result.Failed)
+	s.Equal([]FileResult{
+		{FileID: "file1", Attempts: 1},
+		{FileID: "file2", Attempts: 1},
+		{FileID: "bad", Attempts: 1, Error: result.Files[2].Error},
+	}, result.Files)
+	s.Contains(result.Files[2].Error, "corrupted")
+
+	env.AssertExpectations(s.T())
+}
+
+func (s *UnitTestSuite) Test_SampleFileProcessingWorkflowRecreatesFailedSessions() {
+	env := s.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{
+		EnableSessionWorker: true,
+	})
+	var a *Activities
+
+	// the activities of a failed session are canceled
+	failSessions(env, "file1", DefaultMaxAttempts)
+	env.OnActivity(a.DownloadFileActivity, mock.Anything, "file1").Return("file2", nil).Times(DefaultMaxAttempts)
+	env.OnActivity(a.ProcessFileActivity, mock.Anything, "file2", []string{TranscoderUpperCase}).
+		Return("file3", nil).After(time.Minute).Times(DefaultMaxAttempts)
+
+	env.RegisterActivity(a)
+
+	env.ExecuteWorkflow(SampleFileProcessingWorkflow, "file1")
+
+	s.True(env.IsWorkflowCompleted())
+	s.Error(env.GetWorkflowError())
+	s.Contains(env.GetWorkflowError().Error(), workflow.ErrSessionFailed.Error())
+
+	val, err := env.QueryWorkflow(AttemptHistoryQueryName)
+	s.NoError(err)
+	var history []FileAttempt
+	s.NoError(val.Get(&history))
+	s.Len(history, DefaultMaxAttempts)
+	for i, attempt := range history {
+		s.Equal(i+1, attempt.Attempt)
+		s.Equal(AttemptSessionFailed, attempt.Outcome)
+		s.NotEmpty(attempt.Host)
+	}
+
+	env.AssertExpectations(s.T())
+}
+
+func (s *UnitTestSuite) Test_SampleFileProcessingWorkflowFailsFastOnErrors() {
+	env := s.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{
+		EnableSessionWorker: true,
+	})
+	var a *Activities
+
+	// the activities gave up retrying on the host of the session, which is still alive
+	env.OnActivity(a.DownloadFileActivity, mock.Anything, "file1").Return("", errors.New("unavailable"))
+
+	env.RegisterActivity(a)
+
+	env.ExecuteWorkflow(SampleFileProcessingWorkflow, "file1")
+
+	s.True(env.IsWorkflowCompleted())
+	s.Error(env.GetWorkflowError())
+	val, err := env.QueryWorkflow(AttemptHistoryQueryName)
+	s.NoError(err)
+	var history []FileAttempt
+	s.NoError(val.Get(&history))
+	s.Equal([]string{AttemptFailed}, attemptOutcomes(history))
+
+	env.AssertExpectations(s.T())
+}
+
+func (s *UnitTestSuite) Test_SampleFileProcessingWorkflowDoesNotRetryCanceledActivities() {
+	env := s.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{
+		EnableSessionWorker: true,
+	})
+	var a *Activities
+
+	// the activity canceled itself, the session is still alive
+	env.OnActivity(a.DownloadFileActivity, mock.Anything, "file1").Return("", temporal.NewCanceledError()).Once()
+
+	env.RegisterActivity(a)
+
+	env.ExecuteWorkflow(SampleFileProcessingWorkflow, "file1")
+
+	s.True(env.IsWorkflowCompleted())
+	s.Error(env.GetWorkflowError())
+	val, err := env.QueryWorkflow(AttemptHistoryQueryName)
+	s.NoError(err)
+	var history []FileAttempt
+	s.NoError(val.Get(&history))
+	s.Equal([]string{AttemptFailed}, attemptOutcomes(history))
+
+	env.AssertExpectations(s.T())
+}
+
+func (s *UnitTestSuite) Test_ProcessFileActivityResumesAfterKill() {
+	dir, err := ioutil.TempDir("", "fileprocessing")
+	s.NoError(err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	// multi-byte runes are split between chunks
+	data := []byte(strings.Repeat("héllo wörld ", 1000))
+	fileName := filepath.Join(dir, "file")
+	s.NoError(ioutil.WriteFile(fileName, data, 0644))
+
+	// The first attempt is killed after writing its 5th chunk, before its heartbeat is recorded.
+	var heartbeats []FileProgress
+	upperCase := upperCaseTranscoder{}
+	err = transcodeFile(fileName, fileName+processedSuffix, FileProgress{}, 100, upperCase.TranscodeChunk, func(p FileProgress) error {
+		if len(heartbeats) == 4 {
+			return errors.New("killed")
+		}
+		heartbeats = append(heartbeats, p)
+		return nil
+	})
+	s.EqualError(err, "killed")
+	last := heartbeats[len(heartbeats)-1]
+	s.Less(last.InputOffset, int64(len(data)))
+	output, err := ioutil.ReadFile(fileName + processedSuffix)
+	s.NoError(err)
+	s.Greater(int64(len(output)), last.OutputOffset)
+
+	// The retried attempt resumes from the last heartbeat details.
+	env := s.NewTestActivityEnvironment()
+	env.RegisterActivity(&Activities{ChunkSize: 100})
+	env.SetHeartbeatDetails(last)
+	var a *Activities
+	val, err := env.ExecuteActivity(a.ProcessFileActivity, fileName, []string{TranscoderUpperCase})
+	s.NoError(err)
+	var processedFileName string
+	s.NoError(val.Get(&processedFileName))
+	s.Equal(fileName+processedSuffix, processedFileName)
+
+	output, err = ioutil.ReadFile(processedFileName)
+	s.NoError(err)
+	s.Equal(string(bytes.ToUpper(data)), string(output))
+	_, err = os.Stat(fileName)
+	s.True(os.IsNotExist(err))
+}
+
+func (s *UnitTestSuite) Test_ProcessFileActivityPipeline() {
+	dir, err := ioutil.TempDir("", "fileprocessing")
+	s.NoError(err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	fileName := filepath.Join(dir, "file")
+	s.NoError(ioutil.WriteFile(fileName, []byte("id,name\n1,one\n2,two\n"), 0644))
+	pipeline := SelectPipeline("data.csv")
+	s.Equal([]string{TranscoderCSVToJSON, TranscoderGzip}, pipeline)
+
+	env := s.NewTestActivityEnvironment()
+	env.RegisterActivity(&Activities{})
+	var a *Activities
+	val, err := env.ExecuteActivity(a.ProcessFileActivity, fileName, pipeline)
+	s.NoError(err)
+	var processedFileName string
+	s.NoError(val.Get(&processedFileName))
+	s.Equal(`{"id":"1","name":"one"}`+"\n"+`{"id":"2","name":"two"}`+"\n", s.gunzipFile(processedFileName))
+	files, err := ioutil.ReadDir(dir)
+	s.NoError(err)
+	s.Len(files, 1)
+
+	// A retried attempt resumes from the step recorded in the heartbeat details, the input of the pipeline is
+	// not read again.
+	s.NoError(ioutil.WriteFile(stepFileName(fileName, 0, 2), []byte("resumed"), 0644))
+	env.SetHeartbeatDetails(FileProgress{Step: 1})
+	_, err = env.ExecuteActivity(a.ProcessFileActivity, fileName, pipeline)
+	s.NoError(err)
+	s.Equal("resumed", s.gunzipFile(processedFileName))
+
+	_, err = env.ExecuteActivity(a.ProcessFileActivity, fileName, []string{"unknown"})
+	var applicationErr *temporal.ApplicationError
+	s.True(errors.As(err, &applicationErr))
+	s.True(applicationErr.NonRetryable())
+
+	// invalid data is not retried
+	s.NoError(ioutil.WriteFile(fileName, []byte("id,name\n1\n"), 0644))
+	env.SetHeartbeatDetails(FileProgress{})
+	_, err = env.ExecuteActivity(a.ProcessFileActivity, fileName, pipeline)
+	s.True(errors.As(err, &applicationErr))
+	s.Equal(DataErrorType, applicationErr.Type())
+	s.True(applicationErr.NonRetryable())
+}
+
+// failSessions fails the first sessions downloading fileName 10 seconds after their creation, as if their worker
+// died. The session creation activity of the test environment never fails, it is mocked to create the sessions in
+// its place, each one with its own task queue to tell them apart.
+func failSessions(env *testsuite.TestWorkflowEnvironment, fileName string, sessions int) {
+	failed := make(map[string]bool)
+	env.SetOnActivityStartedListener(func(info *activity.Info, _ context.Context, args converter.EncodedValues) {
+		switch info.ActivityType.Name {
+		case sessionCreationActivityName:
+			var sessionID string
+			if err := args.Get(&sessionID); err != nil {
+				panic(err)
+			}
+			env.SignalWorkflow(sessionID, sessionCreationResponse{Taskqueue: sessionID, HostName: "host", ResourceID: "host"})
+		case "DownloadFileActivity":
+			var name string
+			if err := args.Get(&name); err != nil {
+				panic(err)
+			}
+			if name == fileName && len(failed) < sessions {
+				failed[info.TaskQueue] = true
+			}
+		}
+	})
+	env.OnActivity(sessionCreationActivityName, mock.Anything, mock.Anything).Return(func(_ context.Context, sessionID string) error {
+		if failed[sessionID] {
+			return temporal.NewNonRetryableApplicationError("worker died", "", nil)
+		}
+		return nil
+	}).After(10 * time.Second)
+}
+
+// sessionCreationResponse is the signal sent by the session creation activity once the session is created
+type sessionCreationResponse struct {
+	Taskqueue  string
+	HostName   string
+	ResourceID string
+}
+
+const sessionCreationActivityName = "internalSessionCreationActivity"
+
+func attemptOutcomes(history []FileAttempt) []string {
+	var outcomes []string
+	for _, attempt := range history {
+		outcomes = append(outcomes, attempt.Outcome)
+	}
+	return outcomes
+}
+
+func (s *UnitTestSuite) gunzipFile(fileName string) string {
+	f, err := os.Open(fileName)
+	s.NoError(err)
+	defer func() { _ = f.Close() }()
+	var out bytes.Buffer
+	s.NoError(gunzipTranscoder{}.Transcode(context.Background(), f, &out))
+	return out.String()
+}
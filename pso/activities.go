@@ -14,23 +14,25 @@ const (
 	UpdateParticleActivityName = "updateParticleActivityName"
 )
 
-func InitParticleActivity(ctx context.Context, swarm Swarm) (Particle, error) {
+// InitParticleActivity creates the individual at particleIdx in the initial population with the optimizer of the swarm
+func InitParticleActivity(ctx context.Context, swarm Swarm, particleIdx int) (Particle, error) {
 	logger := activity.GetLogger(ctx)
 	logger.Info("initParticleActivity started.")
 
-	particle := NewParticle(&swarm)
-	particle.UpdateFitness(&swarm)
+	rng := swarm.Settings.rand(0, particleIdx)
+	particle := swarm.Settings.optimizer.Init(&swarm, rng)
 
 	return *particle, nil
 }
 
-func UpdateParticleActivity(ctx context.Context, swarm Swarm, particleIdx int) (Particle, error) {
+// UpdateParticleActivity returns the individual at particleIdx in the population of the step with the optimizer of the
+// swarm
+func UpdateParticleActivity(ctx context.Context, swarm Swarm, particleIdx int, step int) (Particle, error) {
 	logger := activity.GetLogger(ctx)
 	logger.Info("updateParticleActivity started.")
 
-	particle := swarm.Particles[particleIdx]
-	particle.UpdateLocation(&swarm)
-	particle.UpdateFitness(&swarm)
+	rng := swarm.Settings.rand(step, particleIdx)
+	particle := swarm.Settings.optimizer.Step(&swarm, particleIdx, rng)
 
 	return *particle, nil
 }
@@ -101,7 +101,14 @@ func (dc *jsonDataConverter) FromPayload(payload *commonpb.Payload, valuePtr int
 	case *Swarm:
 		t.Settings = new(SwarmSettings)
 		_ = dec.Decode(t.Settings)
-		t.Settings.function = FunctionFactory(t.Settings.FunctionName)
+		t.Settings.function, err = FunctionFactory(t.Settings.FunctionName, t.Settings.FunctionParams)
+		if err != nil {
+			break
+		}
+		t.Settings.optimizer, err = OptimizerFactory(t.Settings.Algorithm)
+		if err != nil {
+			break
+		}
 		t.Gbest = NewPosition(t.Settings.function.dim)
 		err = dec.Decode(t.Gbest)
 		t.Particles = make([]*Particle, t.Settings.Size)
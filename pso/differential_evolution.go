@@ -0,0 +1,63 @@
+package pso
+
+import "math/rand"
+
+// deOptimizer is the DE/rand/1/bin differential evolution. Each individual is replaced by a trial position when it is
+// better, the trial position crosses the individual over with the weighted difference of two other individuals added
+// to a third one.
+type deOptimizer struct{}
+
+func (deOptimizer) Init(swarm *Swarm, rng *rand.Rand) *Particle {
+	return randomIndividual(swarm, rng)
+}
+
+func (deOptimizer) Step(swarm *Swarm, particleIdx int, rng *rand.Rand) *Particle {
+	settings := swarm.Settings
+	current := swarm.Particles[particleIdx]
+
+	// three distinct individuals other than the current one
+	picked := []int{particleIdx}
+	for len(picked) < 4 {
+		idx := rng.Intn(len(swarm.Particles))
+		if !containsIndex(picked, idx) {
+			picked = append(picked, idx)
+		}
+	}
+	a := swarm.Particles[picked[1]].Position
+	b := swarm.Particles[picked[2]].Position
+	c := swarm.Particles[picked[3]].Position
+
+	dim := settings.function.dim
+	trial := NewPosition(dim)
+	// at least one coordinate comes from the mutant
+	mutated := rng.Intn(dim)
+	for i := 0; i < dim; i++ {
+		if i == mutated || rng.Float64() < settings.DECrossover {
+			trial.Location[i] = settings.bound(a.Location[i] + settings.DEWeight*(b.Location[i]-c.Location[i]))
+		} else {
+			trial.Location[i] = current.Position.Location[i]
+		}
+	}
+	trial.Fitness = settings.function.Evaluate(trial.Location)
+
+	if trial.IsBetterThan(current.Position) {
+		return &Particle{
+			Position: trial,
+			Pbest:    trial.Copy(),
+		}
+	}
+	return current
+}
+
+func (deOptimizer) Best(particle *Particle) *Position {
+	return particle.Position
+}
+
+func containsIndex(indexes []int, idx int) bool {
+	for _, i := range indexes {
+		if i == idx {
+			return true
+		}
+	}
+	return false
+}
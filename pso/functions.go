@@ -1,6 +1,29 @@
 package pso
 
-import "math"
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+var (
+	// ErrUnknownFunction when no objective function is registered with the name
+	ErrUnknownFunction = errors.New("unknown objective function")
+	// ErrInvalidFunctionParams when the dimension is not positive or the lower range limit is not below the higher one
+	ErrInvalidFunctionParams = errors.New("invalid objective function params")
+	// ErrFunctionAlreadyRegistered when an objective function is registered twice with the same name
+	ErrFunctionAlreadyRegistered = errors.New("objective function already registered")
+)
+
+// FunctionParams are the problem dimensionality, range limits and goal of an objective function. The zero values keep
+// the ones of the function, the range limits are replaced only when at least one of them is set.
+type FunctionParams struct {
+	Dim  int
+	XLo  float64
+	XHi  float64
+	Goal float64
+}
 
 type ObjectiveFunction struct {
 	name     string                      // name of the function
@@ -37,6 +60,84 @@ var Griewank = ObjectiveFunction{
 	Evaluate: EvalGriewank,
 }
 
+var (
+	functionsMut sync.RWMutex
+	functions    = map[string]ObjectiveFunction{
+		Sphere.name:     Sphere,
+		Rosenbrock.name: Rosenbrock,
+		Griewank.name:   Griewank,
+	}
+)
+
+// RegisterFunction registers a custom objective function by name, with its default params which must set the
+// dimension and the range limits. It must be registered by every worker running the workflows which minimize it, before
+// the worker starts.
+func RegisterFunction(name string, evaluate func(vec []float64) float64, defaults FunctionParams) error {
+	if err := defaults.validate(); err != nil {
+		return err
+	}
+
+	functionsMut.Lock()
+	defer functionsMut.Unlock()
+	if _, ok := functions[name]; ok {
+		return fmt.Errorf("%w: %s", ErrFunctionAlreadyRegistered, name)
+	}
+	functions[name] = ObjectiveFunction{
+		name:     name,
+		dim:      defaults.Dim,
+		xLo:      defaults.XLo,
+		xHi:      defaults.XHi,
+		Goal:     defaults.Goal,
+		Evaluate: evaluate,
+	}
+	return nil
+}
+
+// FunctionFactory returns the objective function registered with the name, with the params replacing its defaults
+func FunctionFactory(functionName string, params FunctionParams) (ObjectiveFunction, error) {
+	functionsMut.RLock()
+	function, ok := functions[functionName]
+	functionsMut.RUnlock()
+	if !ok {
+		return ObjectiveFunction{}, fmt.Errorf("%w: %s", ErrUnknownFunction, functionName)
+	}
+
+	if params.Dim != 0 {
+		function.dim = params.Dim
+	}
+	if params.XLo != 0 || params.XHi != 0 {
+		function.xLo = params.XLo
+		function.xHi = params.XHi
+	}
+	if params.Goal != 0 {
+		function.Goal = params.Goal
+	}
+	if err := function.Params().validate(); err != nil {
+		return ObjectiveFunction{}, err
+	}
+	return function, nil
+}
+
+// Params returns the dimension, range limits and goal of the function
+func (function ObjectiveFunction) Params() FunctionParams {
+	return FunctionParams{
+		Dim:  function.dim,
+		XLo:  function.xLo,
+		XHi:  function.xHi,
+		Goal: function.Goal,
+	}
+}
+
+func (params FunctionParams) validate() error {
+	if params.Dim <= 0 {
+		return fmt.Errorf("%w: dimension %d", ErrInvalidFunctionParams, params.Dim)
+	}
+	if params.XLo >= params.XHi {
+		return fmt.Errorf("%w: range [%g, %g]", ErrInvalidFunctionParams, params.XLo, params.XHi)
+	}
+	return nil
+}
+
 func EvalSphere(vec []float64) float64 {
 	var sum float64 = 0
 	for i := 0; i < len(vec); i++ {
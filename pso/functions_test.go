@@ -0,0 +1,129 @@
+package pso
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+// registerFunction registers the function for the duration of the test
+func registerFunction(t *testing.T, name string, evaluate func(vec []float64) float64, defaults FunctionParams) {
+	require.NoError(t, RegisterFunction(name, evaluate, defaults))
+	t.Cleanup(func() {
+		functionsMut.Lock()
+		defer functionsMut.Unlock()
+		delete(functions, name)
+	})
+}
+
+func Test_FunctionFactory(t *testing.T) {
+	function, err := FunctionFactory("sphere", FunctionParams{})
+	require.NoError(t, err)
+	require.Equal(t, FunctionParams{Dim: 3, XLo: -100, XHi: 100, Goal: 1e-5}, function.Params())
+
+	function, err = FunctionFactory("rosenbrock", FunctionParams{Dim: 10, Goal: 1e-3})
+	require.NoError(t, err)
+	require.Equal(t, FunctionParams{Dim: 10, XLo: -2.048, XHi: 2.048, Goal: 1e-3}, function.Params())
+
+	function, err = FunctionFactory("griewank", FunctionParams{XLo: 0, XHi: 10})
+	require.NoError(t, err)
+	require.Equal(t, FunctionParams{Dim: 3, XLo: 0, XHi: 10, Goal: 1e-5}, function.Params())
+
+	_, err = FunctionFactory("ackley", FunctionParams{})
+	require.ErrorIs(t, err, ErrUnknownFunction)
+	_, err = FunctionFactory("sphere", FunctionParams{Dim: -1})
+	require.ErrorIs(t, err, ErrInvalidFunctionParams)
+	_, err = FunctionFactory("sphere", FunctionParams{XLo: 10, XHi: -10})
+	require.ErrorIs(t, err, ErrInvalidFunctionParams)
+}
+
+func Test_RegisterFunction(t *testing.T) {
+	evalSum := func(vec []float64) float64 {
+		sum := 0.0
+		for _, x := range vec {
+			sum += x
+		}
+		return sum
+	}
+	registerFunction(t, "test_sum", evalSum, FunctionParams{Dim: 2, XLo: 0, XHi: 1, Goal: 1e-3})
+	require.ErrorIs(t, RegisterFunction("test_sum", evalSum, FunctionParams{Dim: 2, XLo: 0, XHi: 1}), ErrFunctionAlreadyRegistered)
+	require.ErrorIs(t, RegisterFunction("sphere", EvalSphere, FunctionParams{Dim: 2, XLo: 0, XHi: 1}), ErrFunctionAlreadyRegistered)
+	require.ErrorIs(t, RegisterFunction("test_invalid", evalSum, FunctionParams{Dim: 2}), ErrInvalidFunctionParams)
+
+	function, err := FunctionFactory("test_sum", FunctionParams{Dim: 4})
+	require.NoError(t, err)
+	require.Equal(t, FunctionParams{Dim: 4, XLo: 0, XHi: 1, Goal: 1e-3}, function.Params())
+	require.Equal(t, 10.0, function.Evaluate([]float64{1, 2, 3, 4}))
+
+	_, err = FunctionFactory("test_invalid", FunctionParams{})
+	require.ErrorIs(t, err, ErrUnknownFunction)
+}
+
+func Test_WorkflowCustomFunction(t *testing.T) {
+	registerFunction(t, "test_cube", func(vec []float64) float64 {
+		sum := 0.0
+		for _, x := range vec {
+			sum += x * x * x
+		}
+		return sum
+	}, FunctionParams{Dim: 3, XLo: 0, XHi: 10, Goal: 1e-5})
+
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(PSOChildWorkflow)
+	env.RegisterActivityWithOptions(InitParticleActivity, activity.RegisterOptions{Name: InitParticleActivityName})
+	env.RegisterActivityWithOptions(UpdateParticleActivity, activity.RegisterOptions{Name: UpdateParticleActivityName})
+	env.SetDataConverter(NewJSONDataConverter())
+
+	// the particles stay within the range limits given to the workflow
+	activities := 0
+	env.SetOnActivityCompletedListener(func(activityInfo *activity.Info, result converter.EncodedValue, err error) {
+		activities++
+		require.NoError(t, err)
+		var particle Particle
+		require.NoError(t, result.Get(&particle))
+		require.Len(t, particle.Position.Location, 5)
+		for _, x := range particle.Position.Location {
+			require.GreaterOrEqual(t, x, 1.0)
+			require.LessOrEqual(t, x, 2.0)
+		}
+	})
+
+	env.ExecuteWorkflow(PSOWorkflow, WorkflowParams{
+		FunctionName:   "test_cube",
+		FunctionParams: FunctionParams{Dim: 5, XLo: 1, XHi: 2},
+		Algorithm:      AlgorithmDE,
+	})
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.Greater(t, activities, 0)
+	// the child workflow continues as new with the params of the function
+	var continueAsNewErr *workflow.ContinueAsNewError
+	require.True(t, errors.As(env.GetWorkflowError(), &continueAsNewErr))
+	var swarm Swarm
+	var step int
+	require.NoError(t, NewJSONDataConverter().FromPayloads(continueAsNewErr.Input, &swarm, &step))
+	require.Equal(t, FunctionParams{Dim: 5, XLo: 1, XHi: 2, Goal: 1e-5}, swarm.Settings.FunctionParams)
+	require.Len(t, swarm.Gbest.Location, 5)
+}
+
+func Test_WorkflowUnknownFunction(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.SetDataConverter(NewJSONDataConverter())
+	env.SetOnActivityStartedListener(func(*activity.Info, context.Context, converter.EncodedValues) {
+		require.Fail(t, "unexpected activity call")
+	})
+
+	env.ExecuteWorkflow(PSOWorkflow, WorkflowParams{FunctionName: "ackley"})
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.Error(t, env.GetWorkflowError())
+	require.Contains(t, env.GetWorkflowError().Error(), ErrUnknownFunction.Error())
+}
@@ -0,0 +1,84 @@
+package pso
+
+import (
+	"math"
+	"math/rand"
+)
+
+// blendAlpha extends the range of the blend crossover beyond the parents, which keeps the population diverse
+const blendAlpha = 0.5
+
+// gaOptimizer is a generational genetic algorithm. Each individual is replaced by a child of two parents selected by
+// tournament, crossed over by blending their coordinates and mutated by a gaussian noise. The best individual is kept
+// as is.
+type gaOptimizer struct{}
+
+func (gaOptimizer) Init(swarm *Swarm, rng *rand.Rand) *Particle {
+	return randomIndividual(swarm, rng)
+}
+
+func (gaOptimizer) Step(swarm *Swarm, particleIdx int, rng *rand.Rand) *Particle {
+	settings := swarm.Settings
+	current := swarm.Particles[particleIdx]
+	if particleIdx == bestIndividual(swarm) {
+		return current
+	}
+
+	parent1 := tournament(swarm, rng)
+	parent2 := tournament(swarm, rng)
+	crossover := rng.Float64() < settings.GACrossover
+	sigma := settings.GAMutationScale * (settings.function.xHi - settings.function.xLo)
+
+	dim := settings.function.dim
+	child := NewPosition(dim)
+	for i := 0; i < dim; i++ {
+		x := parent1.Location[i]
+		if crossover {
+			lo := math.Min(parent1.Location[i], parent2.Location[i])
+			hi := math.Max(parent1.Location[i], parent2.Location[i])
+			extent := blendAlpha * (hi - lo)
+			x = lo - extent + (hi-lo+2*extent)*rng.Float64()
+		}
+		if rng.Float64() < settings.GAMutation {
+			x += sigma * rng.NormFloat64()
+		}
+		child.Location[i] = settings.bound(x)
+	}
+	child.Fitness = settings.function.Evaluate(child.Location)
+
+	particle := &Particle{
+		Position: child,
+		Pbest:    current.Pbest,
+	}
+	if child.IsBetterThan(particle.Pbest) {
+		particle.Pbest = child.Copy()
+	}
+	return particle
+}
+
+func (gaOptimizer) Best(particle *Particle) *Position {
+	return particle.Pbest
+}
+
+// bestIndividual returns the index of the individual at the best position, the first one on a tie
+func bestIndividual(swarm *Swarm) int {
+	best := 0
+	for i, particle := range swarm.Particles {
+		if particle.Position.IsBetterThan(swarm.Particles[best].Position) {
+			best = i
+		}
+	}
+	return best
+}
+
+// tournament returns the best position among GATournamentSize individuals picked at random
+func tournament(swarm *Swarm, rng *rand.Rand) *Position {
+	var winner *Position
+	for i := 0; i < swarm.Settings.GATournamentSize; i++ {
+		position := swarm.Particles[rng.Intn(len(swarm.Particles))].Position
+		if winner == nil || position.IsBetterThan(winner) {
+			winner = position
+		}
+	}
+	return winner
+}
@@ -0,0 +1,76 @@
+package pso
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+// Optimization algorithms
+const (
+	// AlgorithmPSO is the particle swarm optimization
+	AlgorithmPSO = "pso"
+	// AlgorithmDE is the differential evolution
+	AlgorithmDE = "de"
+	// AlgorithmGA is a genetic algorithm
+	AlgorithmGA = "ga"
+)
+
+// ErrUnknownAlgorithm when the optimization algorithm is not one of AlgorithmPSO, AlgorithmDE or AlgorithmGA
+var ErrUnknownAlgorithm = errors.New("unknown optimization algorithm")
+
+// Optimizer is a population based optimization algorithm. The individuals of the population are Particles of the
+// Swarm, each one is initialized and then updated at every step by its own activity, from the population of the
+// previous step. The algorithms which do not need a velocity leave it empty.
+type Optimizer interface {
+	// Init creates a random individual of the initial population, with its fitness
+	Init(swarm *Swarm, rng *rand.Rand) *Particle
+	// Step returns the individual at particleIdx in the next population, with its fitness
+	Step(swarm *Swarm, particleIdx int, rng *rand.Rand) *Particle
+	// Best returns the best position found by the individual
+	Best(particle *Particle) *Position
+}
+
+// OptimizerFactory returns the optimizer of the algorithm
+func OptimizerFactory(algorithm string) (Optimizer, error) {
+	switch algorithm {
+	case AlgorithmPSO:
+		return psoOptimizer{}, nil
+	case AlgorithmDE:
+		return deOptimizer{}, nil
+	case AlgorithmGA:
+		return gaOptimizer{}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, algorithm)
+	}
+}
+
+// psoOptimizer moves each particle from its velocity, its best position and the best position of the swarm
+type psoOptimizer struct{}
+
+func (psoOptimizer) Init(swarm *Swarm, rng *rand.Rand) *Particle {
+	particle := NewParticle(swarm, rng)
+	particle.UpdateFitness(swarm)
+	return particle
+}
+
+func (psoOptimizer) Step(swarm *Swarm, particleIdx int, rng *rand.Rand) *Particle {
+	particle := swarm.Particles[particleIdx]
+	particle.UpdateLocation(swarm, rng)
+	particle.UpdateFitness(swarm)
+	return particle
+}
+
+func (psoOptimizer) Best(particle *Particle) *Position {
+	return particle.Pbest
+}
+
+// randomIndividual creates an individual without velocity at a random position
+func randomIndividual(swarm *Swarm, rng *rand.Rand) *Particle {
+	position := RandomPosition(swarm.Settings.function, rng)
+	position.Fitness = swarm.Settings.function.Evaluate(position.Location)
+	return &Particle{
+		Position: position,
+		Pbest:    position.Copy(),
+	}
+}
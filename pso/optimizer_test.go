@@ -0,0 +1,127 @@
+package pso
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+// optimize runs the algorithm on the function without the workflow, as the activities do, with a fixed seed
+func optimize(t *testing.T, functionName, algorithm string, steps int) (*Swarm, int) {
+	settings, err := PSODefaultSettings(functionName, FunctionParams{})
+	require.NoError(t, err)
+	require.NoError(t, settings.SetAlgorithm(algorithm))
+	settings.Seed = 1
+
+	swarm := &Swarm{
+		Settings:  settings,
+		Gbest:     NewPosition(settings.function.dim),
+		Particles: make([]*Particle, settings.Size),
+	}
+	swarm.Gbest.Fitness = 1e20
+	for i := range swarm.Particles {
+		swarm.Particles[i] = settings.optimizer.Init(swarm, settings.rand(0, i))
+	}
+	swarm.updateBest()
+
+	for step := 1; step <= steps; step++ {
+		// every individual of the next population is computed from the current one
+		current := *swarm
+		current.Particles = make([]*Particle, len(swarm.Particles))
+		for i, particle := range swarm.Particles {
+			current.Particles[i] = copyParticle(particle)
+		}
+		for i := range swarm.Particles {
+			swarm.Particles[i] = settings.optimizer.Step(&current, i, settings.rand(step, i))
+		}
+		swarm.updateBest()
+		if swarm.Gbest.Fitness < settings.function.Goal {
+			return swarm, step
+		}
+	}
+	return swarm, steps
+}
+
+func copyParticle(particle *Particle) *Particle {
+	return &Particle{
+		Position: particle.Position.Copy(),
+		Pbest:    particle.Pbest.Copy(),
+		Velocity: append(Vector(nil), particle.Velocity...),
+	}
+}
+
+func Test_OptimizersReachSphereGoal(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmPSO, AlgorithmDE, AlgorithmGA} {
+		t.Run(algorithm, func(t *testing.T) {
+			swarm, steps := optimize(t, "sphere", algorithm, 1000)
+			require.Less(t, swarm.Gbest.Fitness, Sphere.Goal)
+			require.Less(t, steps, 1000)
+
+			// the same seed finds the same position
+			again, againSteps := optimize(t, "sphere", algorithm, 1000)
+			require.Equal(t, steps, againSteps)
+			require.Equal(t, swarm.Gbest, again.Gbest)
+		})
+	}
+}
+
+func Test_OptimizerFactory(t *testing.T) {
+	settings, err := PSODefaultSettings("sphere", FunctionParams{})
+	require.NoError(t, err)
+	require.NoError(t, settings.SetAlgorithm(""))
+	require.Equal(t, AlgorithmPSO, settings.Algorithm)
+	require.ErrorIs(t, settings.SetAlgorithm("annealing"), ErrUnknownAlgorithm)
+}
+
+func Test_WorkflowAlgorithms(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmDE, AlgorithmGA} {
+		t.Run(algorithm, func(t *testing.T) {
+			testSuite := &testsuite.WorkflowTestSuite{}
+			env := testSuite.NewTestWorkflowEnvironment()
+			env.RegisterWorkflow(PSOChildWorkflow)
+			env.RegisterActivityWithOptions(InitParticleActivity, activity.RegisterOptions{Name: InitParticleActivityName})
+			env.RegisterActivityWithOptions(UpdateParticleActivity, activity.RegisterOptions{Name: UpdateParticleActivityName})
+			env.SetDataConverter(NewJSONDataConverter())
+
+			var algorithms []string
+			env.SetOnActivityStartedListener(func(activityInfo *activity.Info, ctx context.Context, args converter.EncodedValues) {
+				var swarm Swarm
+				var particleIdx, step int
+				if activityInfo.ActivityType.Name == InitParticleActivityName {
+					require.NoError(t, args.Get(&swarm, &particleIdx))
+				} else {
+					require.NoError(t, args.Get(&swarm, &particleIdx, &step))
+				}
+				algorithms = append(algorithms, swarm.Settings.Algorithm)
+			})
+
+			env.ExecuteWorkflow(PSOWorkflow, WorkflowParams{FunctionName: "sphere", Algorithm: algorithm})
+
+			require.True(t, env.IsWorkflowCompleted())
+			var continueAsNewErr *workflow.ContinueAsNewError
+			require.True(t, errors.As(env.GetWorkflowError(), &continueAsNewErr))
+			require.NotEmpty(t, algorithms)
+			for _, a := range algorithms {
+				require.Equal(t, algorithm, a)
+			}
+		})
+	}
+}
+
+func Test_WorkflowUnknownAlgorithm(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.SetDataConverter(NewJSONDataConverter())
+
+	env.ExecuteWorkflow(PSOWorkflow, WorkflowParams{FunctionName: "sphere", Algorithm: "annealing"})
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.Error(t, env.GetWorkflowError())
+	require.Contains(t, env.GetWorkflowError().Error(), ErrUnknownAlgorithm.Error())
+}
@@ -1,9 +1,6 @@
 package pso
 
-import (
-	"math/rand"
-	"time"
-)
+import "math/rand"
 
 type Particle struct {
 	Position *Position
@@ -11,8 +8,7 @@ type Particle struct {
 	Velocity Vector
 }
 
-func NewParticle(swarm *Swarm) *Particle {
-	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+func NewParticle(swarm *Swarm, rng *rand.Rand) *Particle {
 	particle := new(Particle)
 	particle.Position = RandomPosition(swarm.Settings.function, rng)
 
@@ -30,9 +26,7 @@ func NewParticle(swarm *Swarm) *Particle {
 	return particle
 }
 
-func (particle *Particle) UpdateLocation(swarm *Swarm) {
-	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
-
+func (particle *Particle) UpdateLocation(swarm *Swarm, rng *rand.Rand) {
 	for i := 0; i < swarm.Settings.function.dim; i++ {
 		// calculate stochastic coefficients
 		rho1 := swarm.Settings.C1 * rng.Float64()
@@ -1,11 +1,24 @@
 package pso
 
+import (
+	"math"
+	"math/rand"
+)
+
 const pso_max_size int = 100
 const pso_inertia float64 = 0.7298 // default value of w (see clerc02)
 
 type SwarmSettings struct {
 	FunctionName string
-	function     ObjectiveFunction // lower case to avoid data converter export
+	// dimension, range limits and goal of the function
+	FunctionParams FunctionParams
+	function       ObjectiveFunction // lower case to avoid data converter export
+	// seed of the random numbers, each particle derives its own seed at every step from it, so the runs with the
+	// same seed are identical
+	Seed int64
+	// optimization algorithm, one of AlgorithmPSO, AlgorithmDE or AlgorithmGA
+	Algorithm string
+	optimizer Optimizer // lower case to avoid data converter export
 	// swarm size (number of particles)
 	Size int
 	// ... N steps (set to 0 for no output)
@@ -27,26 +40,33 @@ type SwarmSettings struct {
 	ClampPosition bool
 
 	Inertia float64 // current inertia weight value
-}
 
-func FunctionFactory(functionName string) ObjectiveFunction {
-	var function ObjectiveFunction
-	switch functionName {
-	case "sphere":
-		function = Sphere
-	case "rosenbrock":
-		function = Rosenbrock
-	case "griewank":
-		function = Griewank
-	}
-	return function
+	// differential weight of the differential evolution (F)
+	DEWeight float64
+	// crossover probability of the differential evolution (CR)
+	DECrossover float64
+
+	// number of individuals competing to be selected as a parent by the genetic algorithm
+	GATournamentSize int
+	// probability to cross the parents over rather than copying the first one
+	GACrossover float64
+	// probability to mutate each coordinate of a child
+	GAMutation float64
+	// standard deviation of a mutation, relative to the range of the function
+	GAMutationScale float64
 }
 
-func PSODefaultSettings(functionName string) *SwarmSettings {
+// PSODefaultSettings returns the default settings to minimize the function, with the params replacing its defaults
+func PSODefaultSettings(functionName string, params FunctionParams) (*SwarmSettings, error) {
+	function, err := FunctionFactory(functionName, params)
+	if err != nil {
+		return nil, err
+	}
 	settings := new(SwarmSettings)
 
 	settings.FunctionName = functionName
-	settings.function = FunctionFactory(functionName)
+	settings.FunctionParams = function.Params()
+	settings.function = function
 
 	settings.Size = CalculateSwarmSize(settings.function.dim, pso_max_size)
 	settings.PrintEvery = 10
@@ -60,5 +80,46 @@ func PSODefaultSettings(functionName string) *SwarmSettings {
 
 	settings.ClampPosition = true
 
-	return settings
+	settings.Algorithm = AlgorithmPSO
+	settings.optimizer = psoOptimizer{}
+
+	settings.DEWeight = 0.7
+	settings.DECrossover = 0.9
+
+	settings.GATournamentSize = 2
+	settings.GACrossover = 0.9
+	settings.GAMutation = 0.1
+	settings.GAMutationScale = 0.01
+
+	return settings, nil
+}
+
+// SetAlgorithm selects the optimization algorithm, AlgorithmPSO if empty
+func (settings *SwarmSettings) SetAlgorithm(algorithm string) error {
+	if algorithm == "" {
+		algorithm = AlgorithmPSO
+	}
+	optimizer, err := OptimizerFactory(algorithm)
+	if err != nil {
+		return err
+	}
+	settings.Algorithm = algorithm
+	settings.optimizer = optimizer
+	return nil
+}
+
+// rand returns the random numbers of the particle at the step, the initialization being step 0
+func (settings *SwarmSettings) rand(step, particleIdx int) *rand.Rand {
+	return rand.New(rand.NewSource(DeriveSeed(settings.Seed, step, particleIdx)))
+}
+
+// bound brings a coordinate back within the range of the function, either by clamping it or by applying periodic
+// boundary conditions
+func (settings *SwarmSettings) bound(x float64) float64 {
+	xLo := settings.function.xLo
+	xHi := settings.function.xHi
+	if settings.ClampPosition {
+		return math.Max(xLo, math.Min(xHi, x))
+	}
+	return xLo + math.Mod(math.Mod(x-xLo, xHi-xLo)+xHi-xLo, xHi-xLo)
 }
@@ -12,8 +12,16 @@ import (
 )
 
 func main() {
-	var functionName string
-	flag.StringVar(&functionName, "f", "sphere", "One of [sphere, rosenbrock, griewank]")
+	var functionName, algorithm string
+	var functionParams pso.FunctionParams
+	var seed int64
+	flag.StringVar(&functionName, "f", "sphere", "One of [sphere, rosenbrock, griewank, rastrigin]")
+	flag.IntVar(&functionParams.Dim, "d", 0, "Problem dimensionality, the one of the function if not set")
+	flag.Float64Var(&functionParams.XLo, "lo", 0, "Lower range limit, the one of the function if neither limit is set")
+	flag.Float64Var(&functionParams.XHi, "hi", 0, "Higher range limit, the one of the function if neither limit is set")
+	flag.Float64Var(&functionParams.Goal, "g", 0, "Optimization goal, the one of the function if not set")
+	flag.Int64Var(&seed, "s", 0, "Seed of the random numbers, a random one if not set")
+	flag.StringVar(&algorithm, "a", pso.AlgorithmPSO, "One of ["+pso.AlgorithmPSO+", "+pso.AlgorithmDE+", "+pso.AlgorithmGA+"]")
 	flag.Parse()
 
 	// The client is a heavyweight object that should be created once per process.
@@ -31,7 +39,12 @@ func main() {
 		TaskQueue: "pso",
 	}
 
-	we, err := c.ExecuteWorkflow(context.Background(), workflowOptions, pso.PSOWorkflow, functionName)
+	we, err := c.ExecuteWorkflow(context.Background(), workflowOptions, pso.PSOWorkflow, pso.WorkflowParams{
+		FunctionName:   functionName,
+		FunctionParams: functionParams,
+		Algorithm:      algorithm,
+		Seed:           seed,
+	})
 	if err != nil {
 		log.Fatalln("Unable to execute workflow", err)
 	}
@@ -33,7 +33,7 @@ func NewSwarm(ctx workflow.Context, settings *SwarmSettings) (*Swarm, error) {
 		particleIdx := i
 		workflow.Go(ctx, func(ctx workflow.Context) {
 			var particle Particle
-			err := workflow.ExecuteActivity(ctx, InitParticleActivityName, swarm).Get(ctx, &particle)
+			err := workflow.ExecuteActivity(ctx, InitParticleActivityName, swarm, particleIdx).Get(ctx, &particle)
 			if err == nil {
 				swarm.Particles[particleIdx] = &particle
 			}
@@ -60,8 +60,8 @@ func NewSwarm(ctx workflow.Context, settings *SwarmSettings) (*Swarm, error) {
 
 func (swarm *Swarm) updateBest() {
 	for i := 0; i < swarm.Settings.Size; i++ {
-		if swarm.Particles[i].Pbest.IsBetterThan(swarm.Gbest) {
-			swarm.Gbest = swarm.Particles[i].Pbest.Copy()
+		if best := swarm.Settings.optimizer.Best(swarm.Particles[i]); best.IsBetterThan(swarm.Gbest) {
+			swarm.Gbest = best.Copy()
 		}
 	}
 }
@@ -88,7 +88,7 @@ func (swarm *Swarm) Run(ctx workflow.Context, step int) (ParticleResult, error)
 			particleIdx := i
 			workflow.Go(ctx, func(ctx workflow.Context) {
 				var particle Particle
-				err := workflow.ExecuteActivity(ctx, UpdateParticleActivityName, *swarm, particleIdx).Get(ctx, &particle)
+				err := workflow.ExecuteActivity(ctx, UpdateParticleActivityName, *swarm, particleIdx, step).Get(ctx, &particle)
 				if err == nil {
 					swarm.Particles[particleIdx] = &particle
 				}
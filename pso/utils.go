@@ -4,6 +4,23 @@ import (
 	"math"
 )
 
+// DeriveSeed returns a seed derived from the seed and the values, the same ones always derive the same seed
+func DeriveSeed(seed int64, values ...int) int64 {
+	x := splitMix64(uint64(seed))
+	for _, value := range values {
+		x = splitMix64(x ^ splitMix64(uint64(value)))
+	}
+	return int64(x)
+}
+
+// splitMix64 scrambles the bits of x, so close inputs give unrelated outputs
+func splitMix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
 func CalculateSwarmSize(dim, max_size int) int {
 	s := 10. + 2.*math.Sqrt(float64(dim))
 	size := int(math.Floor(s + 0.5))
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"math"
 
 	"go.temporal.io/sdk/activity"
 	"go.temporal.io/sdk/client"
@@ -10,7 +11,22 @@ import (
 	"github.com/temporalio/samples-go/pso"
 )
 
+// evalRastrigin is a custom objective function, which has many local minima around its global minimum at the origin
+func evalRastrigin(vec []float64) float64 {
+	sum := 10 * float64(len(vec))
+	for _, x := range vec {
+		sum += x*x - 10*math.Cos(2*math.Pi*x)
+	}
+	return sum
+}
+
 func main() {
+	// Custom objective functions must be registered by every worker
+	err := pso.RegisterFunction("rastrigin", evalRastrigin, pso.FunctionParams{Dim: 3, XLo: -5.12, XHi: 5.12, Goal: 1e-5})
+	if err != nil {
+		log.Fatalln("Unable to register objective function", err)
+	}
+
 	// The client and worker are heavyweight objects that should be created once per process.
 	c, err := client.NewClient(client.Options{
 		HostPort:      client.DefaultHostPort,
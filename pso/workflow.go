@@ -10,6 +10,21 @@ import (
 	"go.temporal.io/sdk/workflow"
 )
 
+// WorkflowParams are the input of PSOWorkflow
+type WorkflowParams struct {
+	// FunctionName is the objective function, one of sphere, rosenbrock, griewank or the functions registered with
+	// RegisterFunction
+	FunctionName string
+	// FunctionParams replace the dimension, range limits and goal of the function when set
+	FunctionParams
+	// Seed of the random numbers, the runs with the same seed find the same positions. A random seed is picked if
+	// not set.
+	Seed int64
+	// Algorithm is the optimization algorithm, one of AlgorithmPSO, AlgorithmDE or AlgorithmGA. AlgorithmPSO if not
+	// set.
+	Algorithm string
+}
+
 type WorkflowResult struct {
 	Msg     string // Uppercase the members otherwise serialization won't work!
 	Success bool
@@ -31,16 +46,27 @@ var ActivityOptions = workflow.ActivityOptions{
 const ContinueAsNewStr = "CONTINUEASNEW"
 
 // PSOWorkflow workflow definition
-func PSOWorkflow(ctx workflow.Context, functionName string) (string, error) {
+// It minimizes the function with the algorithm selected by the params, particle swarm optimization by default
+func PSOWorkflow(ctx workflow.Context, params WorkflowParams) (string, error) {
 	logger := workflow.GetLogger(ctx)
-	logger.Info(fmt.Sprintf("Optimizing function %s", functionName))
+	logger.Info(fmt.Sprintf("Optimizing function %s with %s", params.FunctionName, params.Algorithm))
+
+	settings, err := PSODefaultSettings(params.FunctionName, params.FunctionParams)
+	if err == nil {
+		err = settings.SetAlgorithm(params.Algorithm)
+	}
+	if err != nil {
+		msg := fmt.Sprintf("Invalid params. " + err.Error())
+		logger.Error(msg)
+		return msg, err
+	}
 
 	// Set activity options
 	ctx = workflow.WithActivityOptions(ctx, ActivityOptions)
 
 	// Setup query handler for query type "child"
 	var childWorkflowID string
-	err := workflow.SetQueryHandler(ctx, "child", func(input []byte) (string, error) {
+	err = workflow.SetQueryHandler(ctx, "child", func(input []byte) (string, error) {
 		return childWorkflowID, nil
 	})
 	if err != nil {
@@ -49,11 +75,25 @@ func PSOWorkflow(ctx workflow.Context, functionName string) (string, error) {
 		return msg, err
 	}
 
+	// The random seed is recorded in the history, so the run can be reproduced
+	seed := params.Seed
+	if seed == 0 {
+		err = workflow.SideEffect(ctx, func(ctx workflow.Context) interface{} {
+			return time.Now().UnixNano()
+		}).Get(&seed)
+		if err != nil {
+			msg := fmt.Sprintf("Seed failed. " + err.Error())
+			logger.Error(msg)
+			return msg, err
+		}
+	}
+	logger.Info(fmt.Sprintf("Seed %d", seed))
+
 	// Retry with different random seed
-	settings := PSODefaultSettings(functionName)
 	const NumberOfAttempts = 5
 	for i := 1; i < NumberOfAttempts; i++ {
 		logger.Info(fmt.Sprintf("Attempt #%d", i))
+		settings.Seed = DeriveSeed(seed, i)
 
 		swarm, err := NewSwarm(ctx, settings)
 		if err != nil {
@@ -51,7 +51,7 @@ func Test_Workflow(t *testing.T) {
 		childWorkflowID = workflowInfo.WorkflowExecution.ID
 	})
 
-	env.ExecuteWorkflow(PSOWorkflow, "sphere")
+	env.ExecuteWorkflow(PSOWorkflow, WorkflowParams{FunctionName: "sphere"})
 
 	require.True(t, env.IsWorkflowCompleted())
 	queryAndVerify(t, env, "child", childWorkflowID)
@@ -72,3 +72,52 @@ func queryAndVerify(t *testing.T, env *testsuite.TestWorkflowEnvironment, query
 	require.NoError(t, err)
 	require.Equal(t, expectedState, state)
 }
+
+// gbestTrajectory runs the workflow and returns the best position of the swarm at every step, as passed to the
+// activities, and at the end of the child workflow run
+func gbestTrajectory(t *testing.T, params WorkflowParams) []Position {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(PSOChildWorkflow)
+	env.RegisterActivityWithOptions(InitParticleActivity, activity.RegisterOptions{Name: InitParticleActivityName})
+	env.RegisterActivityWithOptions(UpdateParticleActivity, activity.RegisterOptions{Name: UpdateParticleActivityName})
+	env.SetDataConverter(NewJSONDataConverter())
+
+	var trajectory []Position
+	env.SetOnActivityStartedListener(func(activityInfo *activity.Info, ctx context.Context, args converter.EncodedValues) {
+		if activityInfo.ActivityType.Name != UpdateParticleActivityName {
+			return
+		}
+		var swarm Swarm
+		var particleIdx, step int
+		require.NoError(t, args.Get(&swarm, &particleIdx, &step))
+		if particleIdx == 0 {
+			require.Len(t, trajectory, step-1)
+			trajectory = append(trajectory, *swarm.Gbest)
+		}
+	})
+
+	env.ExecuteWorkflow(PSOWorkflow, params)
+
+	require.True(t, env.IsWorkflowCompleted())
+	var continueAsNewErr *workflow.ContinueAsNewError
+	require.True(t, errors.As(env.GetWorkflowError(), &continueAsNewErr))
+	var swarm Swarm
+	var step int
+	require.NoError(t, NewJSONDataConverter().FromPayloads(continueAsNewErr.Input, &swarm, &step))
+	return append(trajectory, *swarm.Gbest)
+}
+
+func Test_WorkflowReproducible(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmPSO, AlgorithmDE, AlgorithmGA} {
+		t.Run(algorithm, func(t *testing.T) {
+			params := WorkflowParams{FunctionName: "griewank", Algorithm: algorithm, Seed: 42}
+			trajectory := gbestTrajectory(t, params)
+			require.Len(t, trajectory, 11)
+			require.Equal(t, trajectory, gbestTrajectory(t, params))
+
+			params.Seed = 43
+			require.NotEqual(t, trajectory, gbestTrajectory(t, params))
+		})
+	}
+}
@@ -24,6 +24,14 @@ type Cache interface {
 
 	// Size returns the number of entries currently stored in the Cache
 	Size() int
+
+	// Range calls f for the entries which have not expired, from the most
+	// recently used, until f returns false. The cache is locked while f runs,
+	// so f must not call the cache, use Snapshot instead if it has to.
+	Range(f func(key string, value interface{}) bool)
+
+	// Snapshot returns a copy of the entries which have not expired
+	Snapshot() map[string]interface{}
 }
 
 // Options control the behavior of the cache
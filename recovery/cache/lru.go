@@ -140,6 +140,33 @@ func (c *lru) Size() int {
 	return len(c.byKey)
 }
 
+// Range calls f for the entries which have not expired, from the most recently used
+func (c *lru) Range(f func(key string, value interface{}) bool) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	now := time.Now()
+	for elt := c.byAccess.Front(); elt != nil; elt = elt.Next() {
+		entry := elt.Value.(*cacheEntry)
+		if entry.expired(now) {
+			continue
+		}
+		if !f(entry.key, entry.value) {
+			return
+		}
+	}
+}
+
+// Snapshot returns a copy of the entries which have not expired
+func (c *lru) Snapshot() map[string]interface{} {
+	snapshot := make(map[string]interface{})
+	c.Range(func(key string, value interface{}) bool {
+		snapshot[key] = value
+		return true
+	})
+	return snapshot
+}
+
 // Put puts a new value associated with a given key, returning the existing value (if present)
 // allowUpdate flag is used to control overwrite behavior if the value exists
 func (c *lru) putInternal(key string, value interface{}, allowUpdate bool) (interface{}, error) {
@@ -203,4 +230,11 @@ type cacheEntry struct {
 	expiration time.Time
 	value      interface{}
 	refCount   int
+	// size of the value, as returned by the Sizer of the sharded cache
+	size int64
+}
+
+// expired tells whether the entry has expired and can be removed, which pinned entries cannot
+func (e *cacheEntry) expired(now time.Time) bool {
+	return e.refCount == 0 && !e.expiration.IsZero() && now.After(e.expiration)
 }
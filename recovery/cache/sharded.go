@@ -0,0 +1,385 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/uber-go/tally"
+)
+
+// Names of the counters of the sharded cache
+const (
+	MetricHits      = "cache_hits"
+	MetricMisses    = "cache_misses"
+	MetricEvictions = "cache_evictions"
+)
+
+// Sizer returns the size of a value in bytes
+type Sizer func(value interface{}) int64
+
+// ShardedOptions control the behavior of the sharded cache
+type ShardedOptions struct {
+	Options
+
+	// Shards is the number of shards, each with its own lock. 16 if not set.
+	Shards int
+
+	// MaxBytes is the maximum total size of the values, as returned by Sizer.
+	// The size is not limited if not set.
+	MaxBytes int64
+
+	// Sizer returns the size of the values, NewSharded panics if MaxBytes is
+	// set without it
+	Sizer Sizer
+
+	// MetricsScope receives the hit, miss and eviction counters
+	MetricsScope tally.Scope
+}
+
+// sharded is a concurrent cache made of lru shards, the entries are spread by
+// the hash of their key so concurrent calls rarely contend on the same lock
+type sharded struct {
+	shards    []*shard
+	hits      tally.Counter
+	misses    tally.Counter
+	evictions tally.Counter
+}
+
+// shard is a fixed size cache that evicts elements in lru order, also when
+// the total size of its values exceeds maxBytes
+type shard struct {
+	mut      sync.Mutex
+	byAccess *list.List
+	byKey    map[string]*list.Element
+	maxSize  int
+	maxBytes int64
+	bytes    int64
+	ttl      time.Duration
+	pin      bool
+	rmFunc   RemovedFunc
+	sizer    Sizer
+	cache    *sharded
+}
+
+const defaultShards = 16
+
+// NewSharded creates a new sharded cache holding up to maxSize entries, or
+// only limited by opts.MaxBytes if maxSize is 0. The limits are split between
+// the shards, which never hold more than maxSize entries and opts.MaxBytes in
+// total. Each shard evicts its least recently used entries once it exceeds its
+// own share of the limits, so entries may be evicted before the whole cache
+// reaches them when the keys are unevenly spread. There are no more shards
+// than maxSize.
+func NewSharded(maxSize int, opts *ShardedOptions) Cache {
+	if opts == nil {
+		opts = &ShardedOptions{}
+	}
+	if opts.MaxBytes > 0 && opts.Sizer == nil {
+		panic("Cannot limit the size of the values without a Sizer")
+	}
+	shards := opts.Shards
+	if shards <= 0 {
+		shards = defaultShards
+	}
+	if maxSize > 0 && shards > maxSize {
+		shards = maxSize
+	}
+	if opts.MaxBytes > 0 && int64(shards) > opts.MaxBytes {
+		shards = int(opts.MaxBytes)
+	}
+	scope := opts.MetricsScope
+	if scope == nil {
+		scope = tally.NoopScope
+	}
+
+	c := &sharded{
+		shards:    make([]*shard, shards),
+		hits:      scope.Counter(MetricHits),
+		misses:    scope.Counter(MetricMisses),
+		evictions: scope.Counter(MetricEvictions),
+	}
+	for i := range c.shards {
+		c.shards[i] = &shard{
+			byAccess: list.New(),
+			byKey:    make(map[string]*list.Element, divideRoundUp(opts.InitialCapacity, shards)),
+			maxSize:  int(shareOf(int64(maxSize), shards, i)),
+			maxBytes: shareOf(opts.MaxBytes, shards, i),
+			ttl:      opts.TTL,
+			pin:      opts.Pin,
+			rmFunc:   opts.RemovedFunc,
+			sizer:    opts.Sizer,
+			cache:    c,
+		}
+	}
+	return c
+}
+
+// Get retrieves the value stored under the given key
+func (c *sharded) Get(key string) interface{} {
+	return c.shard(key).get(key)
+}
+
+// Put puts a new value associated with a given key, returning the existing value (if present)
+func (c *sharded) Put(key string, value interface{}) interface{} {
+	s := c.shard(key)
+	if s.pin {
+		panic("Cannot use Put API in Pin mode. Use Delete and PutIfNotExist if necessary")
+	}
+	val, _ := s.put(key, value, true)
+	return val
+}
+
+// PutIfNotExist puts a value associated with a given key if it does not exist
+func (c *sharded) PutIfNotExist(key string, value interface{}) (interface{}, error) {
+	existing, err := c.shard(key).put(key, value, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing == nil {
+		// This is a new value
+		return value, err
+	}
+
+	return existing, err
+}
+
+// Delete deletes a key, value pair associated with a key
+func (c *sharded) Delete(key string) {
+	s := c.shard(key)
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if elt := s.byKey[key]; elt != nil {
+		s.remove(elt)
+	}
+}
+
+// Release decrements the ref count of a pinned element.
+func (c *sharded) Release(key string) {
+	s := c.shard(key)
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if elt := s.byKey[key]; elt != nil {
+		elt.Value.(*cacheEntry).refCount--
+	}
+}
+
+// Size returns the number of entries currently in the cache
+func (c *sharded) Size() int {
+	size := 0
+	for _, s := range c.shards {
+		s.mut.Lock()
+		size += len(s.byKey)
+		s.mut.Unlock()
+	}
+	return size
+}
+
+// Range calls f for the entries which have not expired, shard by shard, from
+// the most recently used of every shard. A single shard is locked at a time.
+func (c *sharded) Range(f func(key string, value interface{}) bool) {
+	for _, s := range c.shards {
+		if !s.rangeEntries(f) {
+			return
+		}
+	}
+}
+
+// Snapshot returns a copy of the entries which have not expired
+func (c *sharded) Snapshot() map[string]interface{} {
+	snapshot := make(map[string]interface{})
+	c.Range(func(key string, value interface{}) bool {
+		snapshot[key] = value
+		return true
+	})
+	return snapshot
+}
+
+func (c *sharded) shard(key string) *shard {
+	return c.shards[fnv32a(key)%uint32(len(c.shards))]
+}
+
+func (s *shard) get(key string) interface{} {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	elt := s.byKey[key]
+	if elt == nil {
+		s.cache.misses.Inc(1)
+		return nil
+	}
+
+	entry := elt.Value.(*cacheEntry)
+	if s.ttl != 0 && entry.expired(time.Now()) {
+		s.remove(elt)
+		s.cache.evictions.Inc(1)
+		s.cache.misses.Inc(1)
+		return nil
+	}
+
+	if s.pin {
+		entry.refCount++
+	}
+	s.byAccess.MoveToFront(elt)
+	s.cache.hits.Inc(1)
+	return entry.value
+}
+
+// put puts a new value associated with a given key, returning the existing value (if present)
+// allowUpdate flag is used to control overwrite behavior if the value exists
+func (s *shard) put(key string, value interface{}, allowUpdate bool) (interface{}, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	elt := s.byKey[key]
+	size := s.size(value)
+	// A value larger than the shard would evict all the others, it is evicted right away instead
+	tooLarge := s.maxBytes > 0 && size > s.maxBytes
+	if tooLarge && s.pin {
+		return nil, ErrCacheFull
+	}
+
+	if elt != nil {
+		entry := elt.Value.(*cacheEntry)
+		existing := entry.value
+		if allowUpdate && tooLarge {
+			s.remove(elt)
+			s.cache.evictions.Inc(1)
+			return existing, nil
+		}
+		if allowUpdate {
+			entry.value = value
+			s.bytes += size - entry.size
+			entry.size = size
+		}
+		if s.ttl != 0 {
+			entry.expiration = time.Now().Add(s.ttl)
+		}
+		s.byAccess.MoveToFront(elt)
+		if s.pin {
+			entry.refCount++
+		}
+		return existing, s.evict()
+	}
+
+	if tooLarge {
+		s.cache.evictions.Inc(1)
+		if s.rmFunc != nil {
+			go s.rmFunc(value)
+		}
+		return nil, nil
+	}
+
+	entry := &cacheEntry{
+		key:   key,
+		value: value,
+		size:  size,
+	}
+
+	if s.pin {
+		entry.refCount++
+	}
+
+	if s.ttl != 0 {
+		entry.expiration = time.Now().Add(s.ttl)
+	}
+
+	s.byKey[key] = s.byAccess.PushFront(entry)
+	s.bytes += entry.size
+	if err := s.evict(); err != nil {
+		// revert the insert
+		s.byAccess.Remove(s.byKey[key])
+		delete(s.byKey, key)
+		s.bytes -= entry.size
+		return nil, err
+	}
+	return nil, nil
+}
+
+// evict removes the least recently used entries which are not pinned until the
+// shard fits in its limits. It returns ErrCacheFull if the entries left are
+// pinned.
+func (s *shard) evict() error {
+	elt := s.byAccess.Back()
+	for s.overflows() {
+		for elt != nil && elt.Value.(*cacheEntry).refCount > 0 {
+			elt = elt.Prev()
+		}
+		if elt == nil {
+			return ErrCacheFull
+		}
+		prev := elt.Prev()
+		s.remove(elt)
+		s.cache.evictions.Inc(1)
+		elt = prev
+	}
+	return nil
+}
+
+func (s *shard) overflows() bool {
+	return (s.maxSize > 0 && len(s.byKey) > s.maxSize) || (s.maxBytes > 0 && s.bytes > s.maxBytes)
+}
+
+func (s *shard) remove(elt *list.Element) {
+	entry := s.byAccess.Remove(elt).(*cacheEntry)
+	delete(s.byKey, entry.key)
+	s.bytes -= entry.size
+	if s.rmFunc != nil {
+		go s.rmFunc(entry.value)
+	}
+}
+
+func (s *shard) size(value interface{}) int64 {
+	if s.sizer == nil {
+		return 0
+	}
+	return s.sizer(value)
+}
+
+func (s *shard) rangeEntries(f func(key string, value interface{}) bool) bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	now := time.Now()
+	for elt := s.byAccess.Front(); elt != nil; elt = elt.Next() {
+		entry := elt.Value.(*cacheEntry)
+		if entry.expired(now) {
+			continue
+		}
+		if !f(entry.key, entry.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// fnv32a is the 32-bit FNV-1a hash of the key, computed without allocating
+func fnv32a(key string) uint32 {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+	hash := uint32(offset32)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= prime32
+	}
+	return hash
+}
+
+func divideRoundUp(n, d int) int {
+	return (n + d - 1) / d
+}
+
+// shareOf returns the share of the limit n of the shard i, the shares add up
+// to n
+func shareOf(n int64, shards, i int) int64 {
+	share := n / int64(shards)
+	if int64(i) < n%int64(shards) {
+		share++
+	}
+	return share
+}
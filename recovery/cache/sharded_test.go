@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func Test_ShardedEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewSharded(2, &ShardedOptions{Shards: 1})
+
+	c.Put("A", "Foo")
+	c.Put("B", "Bar")
+	require.Equal(t, "Foo", c.Get("A"))
+	c.Put("C", "Baz")
+
+	require.Equal(t, 2, c.Size())
+	require.Nil(t, c.Get("B"))
+	require.Equal(t, "Foo", c.Get("A"))
+	require.Equal(t, "Baz", c.Get("C"))
+
+	c.Delete("A")
+	require.Nil(t, c.Get("A"))
+	require.Equal(t, 1, c.Size())
+}
+
+func Test_ShardedEvictsBySize(t *testing.T) {
+	c := NewSharded(0, &ShardedOptions{
+		Shards:   1,
+		MaxBytes: 10,
+		Sizer: func(value interface{}) int64 {
+			return int64(len(value.(string)))
+		},
+	})
+
+	c.Put("A", "aaaa")
+	c.Put("B", "bbbb")
+	c.Put("C", "cc")
+	require.Equal(t, 3, c.Size())
+
+	// Updating a value changes the size of the entry
+	c.Put("A", "aaaaaa")
+	require.Equal(t, map[string]interface{}{"A": "aaaaaa", "C": "cc"}, c.Snapshot())
+
+	// A value larger than the cache is evicted right away
+	c.Put("D", "ddddddddddd")
+	require.Nil(t, c.Get("D"))
+	require.Equal(t, 2, c.Size())
+}
+
+func Test_ShardedSizeWithDefaultShards(t *testing.T) {
+	for _, maxSize := range []int{1, 10, 17, 100} {
+		c := NewSharded(maxSize, nil)
+		for i := 0; i < 10*maxSize; i++ {
+			c.Put(strconv.Itoa(i), i)
+			require.LessOrEqual(t, c.Size(), maxSize)
+		}
+	}
+
+	c := NewSharded(0, &ShardedOptions{
+		MaxBytes: 10,
+		Sizer: func(interface{}) int64 {
+			return 1
+		},
+	})
+	for i := 0; i < 100; i++ {
+		c.Put(strconv.Itoa(i), i)
+		require.LessOrEqual(t, c.Size(), 10)
+	}
+}
+
+func Test_ShardedMaxBytesRequiresSizer(t *testing.T) {
+	require.Panics(t, func() {
+		NewSharded(10, &ShardedOptions{MaxBytes: 10})
+	})
+}
+
+func Test_ShardedPinnedEntriesAreNotEvicted(t *testing.T) {
+	c := NewSharded(2, &ShardedOptions{Shards: 1, Options: Options{Pin: true}})
+
+	_, err := c.PutIfNotExist("A", "Foo")
+	require.NoError(t, err)
+	_, err = c.PutIfNotExist("B", "Bar")
+	require.NoError(t, err)
+	_, err = c.PutIfNotExist("C", "Baz")
+	require.Equal(t, ErrCacheFull, err)
+
+	c.Release("A")
+	_, err = c.PutIfNotExist("C", "Baz")
+	require.NoError(t, err)
+	require.Nil(t, c.Get("A"))
+	require.Equal(t, "Bar", c.Get("B"))
+}
+
+func Test_ShardedTTL(t *testing.T) {
+	c := NewSharded(5, &ShardedOptions{Options: Options{TTL: 50 * time.Millisecond}})
+
+	c.Put("A", "Foo")
+	require.Equal(t, map[string]interface{}{"A": "Foo"}, c.Snapshot())
+	time.Sleep(100 * time.Millisecond)
+	require.Empty(t, c.Snapshot())
+	require.Nil(t, c.Get("A"))
+	require.Equal(t, 0, c.Size())
+}
+
+func Test_ShardedMetrics(t *testing.T) {
+	scope := tally.NewTestScope("", nil)
+	c := NewSharded(2, &ShardedOptions{Shards: 1, MetricsScope: scope})
+
+	c.Put("A", "Foo")
+	c.Put("B", "Bar")
+	c.Put("C", "Baz")
+	c.Get("A")
+	c.Get("B")
+	c.Get("C")
+
+	counters := scope.Snapshot().Counters()
+	require.Equal(t, int64(2), counters[MetricHits+"+"].Value())
+	require.Equal(t, int64(1), counters[MetricMisses+"+"].Value())
+	require.Equal(t, int64(1), counters[MetricEvictions+"+"].Value())
+}
+
+func Test_Range(t *testing.T) {
+	for name, c := range map[string]Cache{
+		"lru":     NewLRU(10),
+		"sharded": NewSharded(10, &ShardedOptions{Shards: 4}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 5; i++ {
+				c.Put(strconv.Itoa(i), i)
+			}
+
+			entries := make(map[string]interface{})
+			c.Range(func(key string, value interface{}) bool {
+				entries[key] = value
+				return true
+			})
+			require.Equal(t, map[string]interface{}{"0": 0, "1": 1, "2": 2, "3": 3, "4": 4}, entries)
+			require.Equal(t, entries, c.Snapshot())
+
+			calls := 0
+			c.Range(func(string, interface{}) bool {
+				calls++
+				return calls < 2
+			})
+			require.Equal(t, 2, calls)
+		})
+	}
+}
+
+const benchmarkKeys = 1 << 12
+
+func benchmarkCache(b *testing.B, c Cache) {
+	keys := make([]string, benchmarkKeys)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+		c.Put(keys[i], i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		// half of the keys fit in the caches
+		random := rand.New(rand.NewSource(rand.Int63()))
+		i := 0
+		for pb.Next() {
+			key := keys[random.Intn(benchmarkKeys)]
+			// 1 write for 7 reads
+			if i%8 == 0 {
+				c.Put(key, i)
+			} else {
+				c.Get(key)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkLRU(b *testing.B) {
+	benchmarkCache(b, NewLRU(benchmarkKeys/2))
+}
+
+func BenchmarkSharded(b *testing.B) {
+	benchmarkCache(b, NewSharded(benchmarkKeys/2, nil))
+}
+
+func BenchmarkShardedWithSizer(b *testing.B) {
+	benchmarkCache(b, NewSharded(benchmarkKeys/2, &ShardedOptions{
+		MaxBytes: benchmarkKeys * 4,
+		Sizer: func(interface{}) int64 {
+			return 8
+		},
+		MetricsScope: tally.NewTestScope("", nil),
+	}))
+}
@@ -11,8 +11,9 @@ import (
 )
 
 func main() {
-	var workflowID string
+	var workflowID, queryType string
 	flag.StringVar(&workflowID, "w", "trip_workflow", "WorkflowID.")
+	flag.StringVar(&queryType, "q", recovery.QueryName, "Query type ("+recovery.QueryName+"|"+recovery.RecoveryReportQueryName+").")
 	flag.Parse()
 
 	// The client is a heavyweight object that should be created once per process.
@@ -24,7 +25,7 @@ func main() {
 	}
 	defer c.Close()
 
-	resp, err := c.QueryWorkflow(context.Background(), workflowID, "", recovery.QueryName)
+	resp, err := c.QueryWorkflow(context.Background(), workflowID, "", queryType)
 	if err != nil {
 		log.Fatalln("Unable to query workflow", err)
 	}
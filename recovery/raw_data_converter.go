@@ -0,0 +1,63 @@
+package recovery
+
+import (
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/sdk/converter"
+)
+
+// RawDataConverter wraps a DataConverter, passing the values which are already payloads as is, so the recovery can
+// restart and signal the workflows with the payloads of their history, whatever their type and encoding. The client
+// used by the recovery activities must be created with it.
+type RawDataConverter struct {
+	dataConverter converter.DataConverter
+}
+
+// NewRawDataConverter creates a new instance of RawDataConverter wrapping a DataConverter
+func NewRawDataConverter(dataConverter converter.DataConverter) *RawDataConverter {
+	return &RawDataConverter{
+		dataConverter: dataConverter,
+	}
+}
+
+// ToPayload returns a *commonpb.Payload value as is, and converts the other values with the wrapped DataConverter
+func (dc *RawDataConverter) ToPayload(value interface{}) (*commonpb.Payload, error) {
+	if payload, ok := value.(*commonpb.Payload); ok {
+		return payload, nil
+	}
+	return dc.dataConverter.ToPayload(value)
+}
+
+// ToPayloads returns a single *commonpb.Payloads value as is, which holds all the arguments of a call
+func (dc *RawDataConverter) ToPayloads(values ...interface{}) (*commonpb.Payloads, error) {
+	if len(values) == 1 {
+		if payloads, ok := values[0].(*commonpb.Payloads); ok {
+			return payloads, nil
+		}
+	}
+
+	result := &commonpb.Payloads{}
+	for _, value := range values {
+		payload, err := dc.ToPayload(value)
+		if err != nil {
+			return nil, err
+		}
+		result.Payloads = append(result.Payloads, payload)
+	}
+	return result, nil
+}
+
+func (dc *RawDataConverter) FromPayload(payload *commonpb.Payload, valuePtr interface{}) error {
+	return dc.dataConverter.FromPayload(payload, valuePtr)
+}
+
+func (dc *RawDataConverter) FromPayloads(payloads *commonpb.Payloads, valuePtrs ...interface{}) error {
+	return dc.dataConverter.FromPayloads(payloads, valuePtrs...)
+}
+
+func (dc *RawDataConverter) ToString(payload *commonpb.Payload) string {
+	return dc.dataConverter.ToString(payload)
+}
+
+func (dc *RawDataConverter) ToStrings(payloads *commonpb.Payloads) []string {
+	return dc.dataConverter.ToStrings(payloads)
+}
@@ -2,76 +2,200 @@ package recovery
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
-	"github.com/pborman/uuid"
 	commonpb "go.temporal.io/api/common/v1"
 	enumspb "go.temporal.io/api/enums/v1"
 	filterpb "go.temporal.io/api/filter/v1"
 	historypb "go.temporal.io/api/history/v1"
+	workflowpb "go.temporal.io/api/workflow/v1"
 	"go.temporal.io/api/workflowservice/v1"
 	"go.temporal.io/sdk/activity"
 	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
 	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/workflow"
-
-	"github.com/temporalio/samples-go/recovery/cache"
 )
 
 type (
 	// Params is the input parameters to RecoveryWorkflow
 	Params struct {
-		ID          string
-		Type        string
+		ID string
+		// Type selects the executions of the workflow type, all of them if empty and Query is set
+		Type string
+		// Query selects the executions with a visibility list query, e.g. "CustomKeywordField = 'trip'", which
+		// requires advanced visibility. The open executions are selected when not set.
+		Query string
+		// Concurrency is the maximum number of batches recovered at once, 1 if not set
 		Concurrency int
-	}
-
-	// ListOpenExecutionsResult is the result returned from listOpenExecutions activity
-	ListOpenExecutionsResult struct {
-		ID     string
-		Count  int
-		HostID string
+		// BatchSize is the number of executions recovered by a batch, DefaultBatchSize if not set
+		BatchSize int
+		// MaxRestartsPerSecond limits the rate at which the executions are restarted, or reset, over all the batches.
+		// The rate is not limited if not set.
+		MaxRestartsPerSecond float64
+		// Reset recovers the executions by resetting them to the reset point it selects when set, instead of
+		// terminating and restarting them
+		Reset *ResetParams
+		// DryRun only reports the executions which would be recovered, without terminating nor restarting them
+		DryRun bool
+		// PageSize is the number of executions listed and recovered by a run of the workflow, which continues as new
+		// with the next page. DefaultPageSize if not set.
+		PageSize int
+		// StartedBefore selects the executions started before it. It is set to the start of the recovery when not
+		// set, so the runs started by the recovery are not listed by the next pages.
+		StartedBefore time.Time
+		// NextPageToken and Report carry the progress of the recovery when the workflow continues as new
+		NextPageToken []byte
+		Report        RecoveryReport
+	}
+
+	// Execution identifies a run of a workflow
+	Execution struct {
+		WorkflowID string
+		RunID      string
+	}
+
+	// ListExecutionsParams are the parameters of ListExecutions activity
+	ListExecutionsParams struct {
+		Type          string
+		Query         string
+		StartedBefore time.Time
+		PageSize      int
+		NextPageToken []byte
+	}
+
+	// ListExecutionsResult is a page of executions returned from ListExecutions activity
+	ListExecutionsResult struct {
+		Executions []Execution
+		// NextPageToken is empty for the last page
+		NextPageToken []byte
 	}
 
 	// RestartParams are parameters extracted from StartWorkflowExecution history event
 	RestartParams struct {
-		Options client.StartWorkflowOptions
-		State   UserState
+		WorkflowType string
+		Options      client.StartWorkflowOptions
+		// Input is the raw input of the workflow, passed as is to the new run
+		Input *commonpb.Payloads
+	}
+
+	// RecoveryReport is the result of RecoverWorkflow
+	RecoveryReport struct {
+		DryRun bool
+		// Pages is the number of pages of executions listed so far
+		Pages int
+		// Executions are the outcomes of the executions of the current page, in the order they were listed. The ones
+		// of the batches still running are empty.
+		Executions []ExecutionReport
+		// Recovered is the number of executions of all the pages recovered, or which would be in a dry run
+		Recovered int
+		Skipped   int
+		Failed    int
+	}
+
+	// ExecutionReport is the outcome of the recovery of an execution
+	ExecutionReport struct {
+		WorkflowID   string
+		RunID        string
+		WorkflowType string
+		// Terminated is true if the run was terminated, or would be in a dry run
+		Terminated bool
+		// ResetEventID is the reset point of the executions recovered by a reset
+		ResetEventID int64
+		// Signals is the number of signals replayed to the new run, or which would be in a dry run
+		Signals  int
+		NewRunID string
+		Outcome  string
+		Error    string
 	}
 
 	// SignalParams are the parameters extracted from SignalWorkflowExecution history event
 	SignalParams struct {
 		Name string
-		Data TripEvent
+		// Input is the raw input of the signal, passed as is to the new run
+		Input *commonpb.Payloads
 	}
 )
 
+const (
+	// DefaultPageSize is the number of executions recovered by a run of RecoverWorkflow when Params.PageSize is not
+	// set
+	DefaultPageSize = 1000
+	// DefaultBatchSize is the number of executions recovered by a batch when Params.BatchSize is not set
+	DefaultBatchSize = 100
+)
+
+// RecoveryReportQueryName is the name of the query returning the RecoveryReport of a running RecoverWorkflow
+const RecoveryReportQueryName = "recovery-report"
+
+// Outcomes of the recovery of an execution
+const (
+	ExecutionRecovered = "recovered"
+	// ExecutionWouldRecover is the outcome of the executions which would be recovered in a dry run
+	ExecutionWouldRecover = "would-recover"
+	// ExecutionSkipped is the outcome of the executions without history, or whose current run is not the listed one,
+	// e.g. because it was already restarted by a previous attempt of the recovery
+	ExecutionSkipped = "skipped"
+	ExecutionFailed  = "failed"
+)
+
 // ClientKey is the key for lookup
 type ClientKey int
 
 const (
 	// TemporalClientKey for retrieving client from context
 	TemporalClientKey ClientKey = iota
-	// WorkflowExecutionCacheKey for retrieving executions cache from context
-	WorkflowExecutionCacheKey
 )
 
-// HostID - Use a new uuid just for demo so we can run 2 host specific activity workers on same machine.
-// In real world case, you would use a hostname or ip address as HostID.
-var HostID = "recovery_" + uuid.New()
-
 var (
 	// ErrClientNotFound when client is not found on context
 	ErrClientNotFound = errors.New("failed to retrieve client from context")
-	// ErrExecutionCacheNotFound when executions cache is not found on context
-	ErrExecutionCacheNotFound = errors.New("failed to retrieve cache from context")
+	// ErrUnsupportedEncoding when a memo or a search attribute of an execution cannot be passed to its new run
+	ErrUnsupportedEncoding = errors.New("unsupported payload encoding")
 )
 
-// RecoverWorkflow is the workflow implementation to recover TripWorkflow executions
-func RecoverWorkflow(ctx workflow.Context, params Params) error {
+// RecoverWorkflow is the workflow implementation to recover the open executions of a workflow type, or the
+// executions selected by a visibility query. Every execution is terminated and started again with the input and the options of its run, then all the signals it received are
+// sent again to the new run. The client of the activities must use a RawDataConverter.
+//
+// The executions are listed by pages, each page is recovered by batches, up to Params.Concurrency at once, then the
+// workflow
+// continues as new with the next page, so its history stays small whatever the number of executions. The pages and
+// the batches are passed to the activities through their inputs and results, which are kept in the history, so the
+// recovery carries on from any worker.
+//
+// The RecoveryReportQueryName query returns the report of the executions recovered so far, which is updated as the
+// batches complete.
+func RecoverWorkflow(ctx workflow.Context, params Params) (RecoveryReport, error) {
 	logger := workflow.GetLogger(ctx)
-	logger.Info("Recover workflow started.")
+	logger.Info("Recover workflow started.", "DryRun", params.DryRun, "Page", params.Report.Pages+1)
+
+	report := params.Report
+	report.DryRun = params.DryRun
+	err := workflow.SetQueryHandler(ctx, RecoveryReportQueryName, func() (RecoveryReport, error) {
+		return report, nil
+	})
+	if err != nil {
+		return RecoveryReport{}, err
+	}
+
+	if params.Reset != nil {
+		if err := params.Reset.validate(); err != nil {
+			logger.Error("Invalid reset parameters.", "Error", err)
+			return RecoveryReport{}, err
+		}
+	}
+	if params.StartedBefore.IsZero() {
+		params.StartedBefore = workflow.Now(ctx)
+	}
+	pageSize := DefaultPageSize
+	if params.PageSize > 0 {
+		pageSize = params.PageSize
+	}
 
 	ao := workflow.ActivityOptions{
 		ScheduleToStartTimeout: 10 * time.Minute,
@@ -80,30 +204,34 @@ func RecoverWorkflow(ctx workflow.Context, params Params) error {
 	}
 	ctx = workflow.WithActivityOptions(ctx, ao)
 
-	var result ListOpenExecutionsResult
-	err := workflow.ExecuteActivity(ctx, ListOpenExecutions, params.Type).Get(ctx, &result)
+	var page ListExecutionsResult
+	err = workflow.ExecuteActivity(ctx, ListExecutions, ListExecutionsParams{
+		Type:          params.Type,
+		Query:         params.Query,
+		StartedBefore: params.StartedBefore,
+		PageSize:      pageSize,
+		NextPageToken: params.NextPageToken,
+	}).Get(ctx, &page)
 	if err != nil {
-		logger.Error("Failed to list open workflow executions.", "Error", err)
-		return err
+		logger.Error("Failed to list workflow executions.", "Error", err)
+		return RecoveryReport{}, err
 	}
+	report.Pages++
+	report.Executions = make([]ExecutionReport, len(page.Executions))
 
 	concurrency := 1
 	if params.Concurrency > 0 {
 		concurrency = params.Concurrency
 	}
-
-	if result.Count < concurrency {
-		concurrency = result.Count
-	}
-
-	batchSize := result.Count / concurrency
-	if result.Count%concurrency != 0 {
-		batchSize++
+	batchSize := DefaultBatchSize
+	if params.BatchSize > 0 {
+		batchSize = params.BatchSize
 	}
+	// The batches running at once share the rate
+	restartsPerSecond := params.MaxRestartsPerSecond / float64(concurrency)
 
-	// Setup retry policy for recovery activity
-	info := workflow.GetInfo(ctx)
-	expiration := info.WorkflowExecutionTimeout
+	// Setup retry policy for recovery activity. The progress of a batch is kept in the heartbeats, so its retries
+	// carry on from the last execution recovered.
 	retryPolicy := &temporal.RetryPolicy{
 		InitialInterval:    time.Second,
 		BackoffCoefficient: 2,
@@ -111,120 +239,272 @@ func RecoverWorkflow(ctx workflow.Context, params Params) error {
 		MaximumAttempts:    100,
 	}
 	ao = workflow.ActivityOptions{
-		ScheduleToStartTimeout: expiration,
-		StartToCloseTimeout:    expiration,
+		ScheduleToStartTimeout: time.Hour,
+		StartToCloseTimeout:    time.Hour,
 		HeartbeatTimeout:       time.Second * 30,
 		RetryPolicy:            retryPolicy,
 	}
 	ctx = workflow.WithActivityOptions(ctx, ao)
 
-	doneCh := workflow.NewChannel(ctx)
-	for i := 0; i < concurrency; i++ {
-		startIndex := i * batchSize
+	// slots holds a value per batch being recovered, so sending to it blocks once concurrency batches are
+	slots := workflow.NewBufferedChannel(ctx, concurrency)
+	wg := workflow.NewWaitGroup(ctx)
+	for startIndex := 0; startIndex < len(page.Executions); startIndex += batchSize {
+		startIndex := startIndex
+		endIndex := startIndex + batchSize
+		if endIndex > len(page.Executions) {
+			endIndex = len(page.Executions)
+		}
+		batch := page.Executions[startIndex:endIndex]
 
+		slots.Send(ctx, true)
+		wg.Add(1)
 		workflow.Go(ctx, func(ctx workflow.Context) {
-			err = workflow.ExecuteActivity(ctx, RecoverExecutions, result.ID, startIndex, batchSize).Get(ctx, nil)
+			defer wg.Done()
+			defer slots.Receive(ctx, nil)
+
+			var executions []ExecutionReport
+			err := workflow.ExecuteActivity(ctx, RecoverExecutions, batch, params.DryRun, restartsPerSecond, params.Reset).Get(ctx, &executions)
 			if err != nil {
 				logger.Error("Recover executions failed.", "StartIndex", startIndex, "Error", err)
+				executions = failedExecutions(batch, err)
 			} else {
 				logger.Info("Recover executions completed.", "StartIndex", startIndex)
 			}
-
-			doneCh.Send(ctx, "done")
+			copy(report.Executions[startIndex:], executions)
+			report.count(executions)
 		})
 	}
+	wg.Wait(ctx)
 
-	for i := 0; i < concurrency; i++ {
-		doneCh.Receive(ctx, nil)
+	if len(page.NextPageToken) > 0 {
+		logger.Info("Continuing with the next page.", "Recovered", report.Recovered, "Skipped", report.Skipped,
+			"Failed", report.Failed)
+		params.NextPageToken = page.NextPageToken
+		params.Report = report
+		params.Report.Executions = nil
+		return RecoveryReport{}, workflow.NewContinueAsNewError(ctx, "RecoverWorkflow", params)
 	}
 
-	logger.Info("Workflow completed.", "Result", result.Count)
+	logger.Info("Workflow completed.", "Pages", report.Pages, "Recovered", report.Recovered,
+		"Skipped", report.Skipped, "Failed", report.Failed)
 
-	return nil
+	return report, nil
+}
+
+// count adds the outcomes of the executions to the totals of the report
+func (r *RecoveryReport) count(executions []ExecutionReport) {
+	for _, execution := range executions {
+		switch execution.Outcome {
+		case ExecutionRecovered, ExecutionWouldRecover:
+			r.Recovered++
+		case ExecutionSkipped:
+			r.Skipped++
+		default:
+			r.Failed++
+		}
+	}
 }
 
-func ListOpenExecutions(ctx context.Context, workflowType string) (*ListOpenExecutionsResult, error) {
-	key := uuid.New()
+// failedExecutions reports the executions of a batch which failed with err
+func failedExecutions(batch []Execution, err error) []ExecutionReport {
+	reports := make([]ExecutionReport, len(batch))
+	for i, execution := range batch {
+		reports[i] = ExecutionReport{
+			WorkflowID: execution.WorkflowID,
+			RunID:      execution.RunID,
+			Outcome:    ExecutionFailed,
+			Error:      err.Error(),
+		}
+	}
+	return reports
+}
+
+// ListExecutions lists a page of the executions started before params.StartedBefore, selected by the visibility query
+// if set, or the open executions of the workflow type otherwise
+func ListExecutions(ctx context.Context, params ListExecutionsParams) (*ListExecutionsResult, error) {
 	logger := activity.GetLogger(ctx)
-	logger.Info("List all open executions of type.",
-		"WorkflowType", workflowType,
-		"HostID", HostID)
+	logger.Info("List executions.",
+		"WorkflowType", params.Type,
+		"Query", params.Query,
+		"StartedBefore", params.StartedBefore)
 
 	c, err := getClientFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	executionsCache := ctx.Value(WorkflowExecutionCacheKey).(cache.Cache)
-	if executionsCache == nil {
-		logger.Error("Could not retrieve cache from context.")
-		return nil, ErrExecutionCacheNotFound
+	var executions []*workflowpb.WorkflowExecutionInfo
+	var nextPageToken []byte
+	if params.Query != "" {
+		resp, err := c.ListWorkflow(ctx, &workflowservice.ListWorkflowExecutionsRequest{
+			Namespace:     client.DefaultNamespace,
+			PageSize:      int32(params.PageSize),
+			NextPageToken: params.NextPageToken,
+			Query:         listQuery(params.Type, params.Query, params.StartedBefore),
+		})
+		if err != nil {
+			return nil, err
+		}
+		executions, nextPageToken = resp.Executions, resp.NextPageToken
+	} else {
+		zeroTime := time.Time{}
+		resp, err := c.ListOpenWorkflow(ctx, &workflowservice.ListOpenWorkflowExecutionsRequest{
+			Namespace:       client.DefaultNamespace,
+			MaximumPageSize: int32(params.PageSize),
+			NextPageToken:   params.NextPageToken,
+			StartTimeFilter: &filterpb.StartTimeFilter{
+				EarliestTime: &zeroTime,
+				LatestTime:   &params.StartedBefore,
+			},
+			Filters: &workflowservice.ListOpenWorkflowExecutionsRequest_TypeFilter{TypeFilter: &filterpb.WorkflowTypeFilter{
+				Name: params.Type,
+			}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		executions, nextPageToken = resp.Executions, resp.NextPageToken
 	}
 
-	openExecutions, err := getAllExecutionsOfType(ctx, c, workflowType)
-	if err != nil {
-		return nil, err
+	result := &ListExecutionsResult{NextPageToken: nextPageToken}
+	for _, r := range executions {
+		result.Executions = append(result.Executions, Execution{
+			WorkflowID: r.Execution.GetWorkflowId(),
+			RunID:      r.Execution.GetRunId(),
+		})
 	}
+	return result, nil
+}
 
-	executionsCache.Put(key, openExecutions)
-	return &ListOpenExecutionsResult{
-		ID:     key,
-		Count:  len(openExecutions),
-		HostID: HostID,
-	}, nil
+// listQuery restricts the query to the executions of the workflow type, if set, started before startedBefore. The
+// runs started by the recovery may match the query, so they would be listed by the next pages otherwise.
+func listQuery(workflowType, query string, startedBefore time.Time) string {
+	conditions := []string{"StartTime < '" + startedBefore.UTC().Format(time.RFC3339Nano) + "'"}
+	if workflowType != "" {
+		conditions = append(conditions, "WorkflowType = '"+workflowType+"'")
+	}
+	conditions = append(conditions, "("+query+")")
+	return strings.Join(conditions, " and ")
 }
 
-func RecoverExecutions(ctx context.Context, key string, startIndex, batchSize int) error {
+// RecoverExecutions recovers a batch of the executions listed by ListExecutions, or only reports them in a dry run.
+// The executions which fail to be recovered are reported with their error, without failing the batch. The executions
+// are restarted, or reset if reset is not nil, up to restartsPerSecond times per second, the rate is not limited if it
+// is 0.
+func RecoverExecutions(ctx context.Context, executions []Execution, dryRun bool, restartsPerSecond float64, reset *ResetParams) ([]ExecutionReport, error) {
 	logger := activity.GetLogger(ctx)
 	logger.Info("Starting execution recovery.",
-		"HostID", HostID,
-		"Key", key,
-		"StartIndex", startIndex,
-		"BatchSize", batchSize)
-
-	executionsCache := ctx.Value(WorkflowExecutionCacheKey).(cache.Cache)
-	if executionsCache == nil {
-		logger.Error("Could not retrieve cache from context.")
-		return ErrExecutionCacheNotFound
-	}
-
-	openExecutions := executionsCache.Get(key).([]*commonpb.WorkflowExecution)
-	endIndex := startIndex + batchSize
+		"BatchSize", len(executions),
+		"DryRun", dryRun,
+		"RestartsPerSecond", restartsPerSecond)
 
 	// Check if this activity has previous heartbeat to retrieve progress from it
+	var reports []ExecutionReport
 	if activity.HasHeartbeatDetails(ctx) {
-		var finishedIndex int
-		if err := activity.GetHeartbeatDetails(ctx, &finishedIndex); err == nil {
-			// we have finished progress
-			startIndex = finishedIndex + 1 // start from next one.
+		if err := activity.GetHeartbeatDetails(ctx, &reports); err != nil {
+			reports = nil
 		}
 	}
 
-	for index := startIndex; index < endIndex && index < len(openExecutions); index++ {
-		execution := openExecutions[index]
-		if err := recoverSingleExecution(ctx, execution.GetWorkflowId()); err != nil {
+	limiter := newRestartLimiter(restartsPerSecond)
+	for index := len(reports); index < len(executions); index++ {
+		if !dryRun {
+			if err := limiter.wait(ctx, func() { activity.RecordHeartbeat(ctx, reports) }); err != nil {
+				return nil, err
+			}
+		}
+
+		execution := executions[index]
+		report := ExecutionReport{
+			WorkflowID: execution.WorkflowID,
+			RunID:      execution.RunID,
+		}
+		if err := recoverSingleExecution(ctx, execution, dryRun, reset, &report); err != nil {
 			logger.Error("Failed to recover execution.",
-				"WorkflowID", execution.GetWorkflowId(),
+				"WorkflowID", execution.WorkflowID,
 				"Error", err)
-			return err
+			report.Outcome = ExecutionFailed
+			report.Error = err.Error()
 		}
+		reports = append(reports, report)
 
-		// Record a heartbeat after each recovery of execution
-		activity.RecordHeartbeat(ctx, index)
+		// Record a heartbeat after each recovery of execution, with the reports of the batch so far
+		activity.RecordHeartbeat(ctx, reports)
 	}
 
+	return reports, nil
+}
+
+// restartLimiter spaces the restarts of the executions to limit their rate
+type restartLimiter struct {
+	interval time.Duration
+	next     time.Time
+}
+
+func newRestartLimiter(restartsPerSecond float64) *restartLimiter {
+	if restartsPerSecond <= 0 {
+		return &restartLimiter{}
+	}
+	return &restartLimiter{interval: time.Duration(float64(time.Second) / restartsPerSecond)}
+}
+
+// wait blocks until the next restart is allowed, calling heartbeat every few seconds, so long waits do not time the
+// activity out
+func (l *restartLimiter) wait(ctx context.Context, heartbeat func()) error {
+	if l.interval == 0 {
+		return nil
+	}
+	for {
+		delay := time.Until(l.next)
+		if delay <= 0 {
+			break
+		}
+		if delay > 5*time.Second {
+			delay = 5 * time.Second
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		heartbeat()
+	}
+	l.next = time.Now().Add(l.interval)
 	return nil
 }
 
-func recoverSingleExecution(ctx context.Context, workflowID string) error {
+// recoverSingleExecution recovers the listed run of the workflow, filling the report as it goes, so it tells what
+// was done when an error is returned. The execution is skipped if the listed run is no longer the current one, so a
+// retry does not terminate the run it already started. The current run is recovered if the RunID is not set.
+func recoverSingleExecution(ctx context.Context, listed Execution, dryRun bool, reset *ResetParams, report *ExecutionReport) error {
 	logger := activity.GetLogger(ctx)
 	c, err := getClientFromContext(ctx)
 	if err != nil {
 		return err
 	}
 
+	if listed.RunID != "" {
+		resp, err := c.DescribeWorkflowExecution(ctx, listed.WorkflowID, "")
+		if err != nil {
+			return err
+		}
+		if currentRunID := resp.GetWorkflowExecutionInfo().GetExecution().GetRunId(); currentRunID != listed.RunID {
+			logger.Info("Skipping execution whose current run is not the listed one.",
+				"WorkflowID", listed.WorkflowID,
+				"RunID", listed.RunID,
+				"CurrentRunID", currentRunID)
+			report.Outcome = ExecutionSkipped
+			return nil
+		}
+	}
+
+	workflowID := listed.WorkflowID
 	execution := &commonpb.WorkflowExecution{
 		WorkflowId: workflowID,
+		RunId:      listed.RunID,
 	}
 	history, err := getHistory(ctx, execution)
 	if err != nil {
@@ -233,22 +513,32 @@ func recoverSingleExecution(ctx context.Context, workflowID string) error {
 
 	if len(history) == 0 {
 		// Nothing to recover
+		report.Outcome = ExecutionSkipped
 		return nil
 	}
 
 	firstEvent := history[0]
 	lastEvent := history[len(history)-1]
+	report.WorkflowType = firstEvent.GetWorkflowExecutionStartedEventAttributes().GetWorkflowType().GetName()
+
+	if reset != nil {
+		return resetExecution(ctx, c, execution, history, dryRun, reset, report)
+	}
 
 	// Extract information from StartWorkflowExecution parameters so we can start a new run
-	params, err := extractStateFromEvent(workflowID, firstEvent)
+	params, err := extractRestartParams(workflowID, firstEvent)
 	if err != nil {
 		return err
 	}
 
 	// Parse the entire history and extract all signals so they can be replayed back to new run
-	signals, err := extractSignals(history)
-	if err != nil {
-		return err
+	signals := extractSignals(history)
+
+	if dryRun {
+		report.Terminated = !isExecutionCompleted(lastEvent)
+		report.Signals = len(signals)
+		report.Outcome = ExecutionWouldRecover
+		return nil
 	}
 
 	// First terminate existing run if already running
@@ -257,71 +547,125 @@ func recoverSingleExecution(ctx context.Context, workflowID string) error {
 		if err != nil {
 			return err
 		}
+		report.Terminated = true
 	}
 
-	// Start new execution run
-	newRun, err := c.ExecuteWorkflow(ctx, params.Options, "TripWorkflow", params.State)
+	// Start new execution run. The raw input holds all the arguments of the workflow.
+	var args []interface{}
+	if params.Input != nil {
+		args = append(args, params.Input)
+	}
+	newRun, err := c.ExecuteWorkflow(ctx, params.Options, params.WorkflowType, args...)
 	if err != nil {
 		return err
 	}
+	report.NewRunID = newRun.GetRunID()
 
 	// re-inject all signals to new run
 	for _, s := range signals {
-		_ = c.SignalWorkflow(ctx, execution.GetWorkflowId(), newRun.GetRunID(), s.Name, s.Data)
+		err := c.SignalWorkflow(ctx, execution.GetWorkflowId(), newRun.GetRunID(), s.Name, s.Input)
+		if err != nil {
+			return err
+		}
+		report.Signals++
 	}
 
 	logger.Info("Successfully restarted workflow.",
 		"WorkflowID", execution.GetWorkflowId(),
 		"NewRunID", newRun.GetRunID())
 
+	report.Outcome = ExecutionRecovered
 	return nil
 }
 
-func extractStateFromEvent(workflowID string, event *historypb.HistoryEvent) (*RestartParams, error) {
+func extractRestartParams(workflowID string, event *historypb.HistoryEvent) (*RestartParams, error) {
 	switch event.GetEventType() {
 	case enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED:
 		attr := event.GetWorkflowExecutionStartedEventAttributes()
-		state, err := deserializeUserState(attr.GetInput())
+		memo, err := payloadValues(attr.GetMemo().GetFields())
+		if err != nil {
+			return nil, err
+		}
+		searchAttributes, err := payloadValues(attr.GetSearchAttributes().GetIndexedFields())
 		if err != nil {
-			// Corrupted Workflow Execution State
 			return nil, err
 		}
 		return &RestartParams{
+			WorkflowType: attr.GetWorkflowType().GetName(),
 			Options: client.StartWorkflowOptions{
-				ID:                  workflowID,
-				TaskQueue:           attr.TaskQueue.GetName(),
-				WorkflowTaskTimeout: *attr.GetWorkflowTaskTimeout(),
-				// RetryPolicy: attr.RetryPolicy,
+				ID:                       workflowID,
+				TaskQueue:                attr.GetTaskQueue().GetName(),
+				WorkflowExecutionTimeout: durationValue(attr.GetWorkflowExecutionTimeout()),
+				WorkflowRunTimeout:       durationValue(attr.GetWorkflowRunTimeout()),
+				WorkflowTaskTimeout:      durationValue(attr.GetWorkflowTaskTimeout()),
+				RetryPolicy:              retryPolicy(attr.GetRetryPolicy()),
+				CronSchedule:             attr.GetCronSchedule(),
+				Memo:                     memo,
+				SearchAttributes:         searchAttributes,
 			},
-			State: state,
+			Input: attr.GetInput(),
 		}, nil
 	default:
 		return nil, errors.New("unknown event type")
 	}
 }
 
-func extractSignals(events []*historypb.HistoryEvent) ([]*SignalParams, error) {
+// payloadValues returns values which the client encodes back to the given payloads. The client encodes the memo and
+// the search attributes with the default data converter, so only its encodings are supported.
+func payloadValues(fields map[string]*commonpb.Payload) (map[string]interface{}, error) {
+	if fields == nil {
+		return nil, nil
+	}
+	values := make(map[string]interface{}, len(fields))
+	for name, payload := range fields {
+		switch encoding := string(payload.GetMetadata()[converter.MetadataEncoding]); encoding {
+		case converter.MetadataEncodingJSON:
+			// kept as is rather than decoded, which would round the numbers to float64
+			values[name] = json.RawMessage(payload.GetData())
+		case converter.MetadataEncodingBinary:
+			values[name] = payload.GetData()
+		case converter.MetadataEncodingNil:
+			values[name] = nil
+		default:
+			return nil, fmt.Errorf("%w: %s of field %s", ErrUnsupportedEncoding, encoding, name)
+		}
+	}
+	return values, nil
+}
+
+func retryPolicy(policy *commonpb.RetryPolicy) *temporal.RetryPolicy {
+	if policy == nil {
+		return nil
+	}
+	return &temporal.RetryPolicy{
+		InitialInterval:        durationValue(policy.GetInitialInterval()),
+		BackoffCoefficient:     policy.GetBackoffCoefficient(),
+		MaximumInterval:        durationValue(policy.GetMaximumInterval()),
+		MaximumAttempts:        policy.GetMaximumAttempts(),
+		NonRetryableErrorTypes: policy.GetNonRetryableErrorTypes(),
+	}
+}
+
+func durationValue(d *time.Duration) time.Duration {
+	if d == nil {
+		return 0
+	}
+	return *d
+}
+
+func extractSignals(events []*historypb.HistoryEvent) []*SignalParams {
 	var signals []*SignalParams
 	for _, event := range events {
 		if event.GetEventType() == enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_SIGNALED {
 			attr := event.GetWorkflowExecutionSignaledEventAttributes()
-			if attr.GetSignalName() == TripSignalName && attr.GetInput() != nil {
-				signalData, err := deserializeTripEvent(attr.GetInput())
-				if err != nil {
-					// Corrupted Signal Payload
-					return nil, err
-				}
-
-				signal := &SignalParams{
-					Name: attr.GetSignalName(),
-					Data: signalData,
-				}
-				signals = append(signals, signal)
-			}
+			signals = append(signals, &SignalParams{
+				Name:  attr.GetSignalName(),
+				Input: attr.GetInput(),
+			})
 		}
 	}
 
-	return signals, nil
+	return signals
 }
 
 func isExecutionCompleted(event *historypb.HistoryEvent) bool {
@@ -335,39 +679,6 @@ func isExecutionCompleted(event *historypb.HistoryEvent) bool {
 	}
 }
 
-func getAllExecutionsOfType(ctx context.Context, c client.Client, workflowType string) ([]*commonpb.WorkflowExecution, error) {
-	var openExecutions []*commonpb.WorkflowExecution
-	var nextPageToken []byte
-	for hasMore := true; hasMore; hasMore = len(nextPageToken) > 0 {
-		zeroTime := time.Time{}
-		now := time.Now()
-		resp, err := c.ListOpenWorkflow(ctx, &workflowservice.ListOpenWorkflowExecutionsRequest{
-			Namespace:       client.DefaultNamespace,
-			MaximumPageSize: 10,
-			NextPageToken:   nextPageToken,
-			StartTimeFilter: &filterpb.StartTimeFilter{
-				EarliestTime: &zeroTime,
-				LatestTime:   &now,
-			},
-			Filters: &workflowservice.ListOpenWorkflowExecutionsRequest_TypeFilter{TypeFilter: &filterpb.WorkflowTypeFilter{
-				Name: workflowType,
-			}},
-		})
-		if err != nil {
-			return nil, err
-		}
-
-		for _, r := range resp.Executions {
-			openExecutions = append(openExecutions, r.Execution)
-		}
-
-		nextPageToken = resp.NextPageToken
-		activity.RecordHeartbeat(ctx, nextPageToken)
-	}
-
-	return openExecutions, nil
-}
-
 func getHistory(ctx context.Context, execution *commonpb.WorkflowExecution) ([]*historypb.HistoryEvent, error) {
 	c, err := getClientFromContext(ctx)
 	if err != nil {
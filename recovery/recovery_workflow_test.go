@@ -0,0 +1,424 @@
+package recovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	commonpb "go.temporal.io/api/common/v1"
+	enumspb "go.temporal.io/api/enums/v1"
+	historypb "go.temporal.io/api/history/v1"
+	taskqueuepb "go.temporal.io/api/taskqueue/v1"
+	workflowpb "go.temporal.io/api/workflow/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/mocks"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+)
+
+func Test_RecoverWorkflow(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	executions := []Execution{{WorkflowID: "trip1"}, {WorkflowID: "trip2"}, {WorkflowID: "trip3"}}
+	env.OnActivity(ListExecutions, mock.Anything, mock.MatchedBy(func(params ListExecutionsParams) bool {
+		return params.Type == "TripWorkflow" && params.PageSize == DefaultPageSize && params.NextPageToken == nil
+	})).Return(&ListExecutionsResult{Executions: executions}, nil)
+	// The batches running at once share the rate
+	env.OnActivity(RecoverExecutions, mock.Anything, executions[:2], false, 5.0, (*ResetParams)(nil)).Return([]ExecutionReport{
+		{WorkflowID: "trip1", Terminated: true, Signals: 2, NewRunID: "run1", Outcome: ExecutionRecovered},
+		{WorkflowID: "trip2", Outcome: ExecutionFailed, Error: "terminate failed"},
+	}, nil)
+	env.OnActivity(RecoverExecutions, mock.Anything, executions[2:], false, 5.0, (*ResetParams)(nil)).Return([]ExecutionReport{
+		{WorkflowID: "trip3", Outcome: ExecutionSkipped},
+	}, nil)
+
+	env.ExecuteWorkflow(RecoverWorkflow, Params{Type: "TripWorkflow", Concurrency: 2, BatchSize: 2, MaxRestartsPerSecond: 10})
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	var report RecoveryReport
+	require.NoError(t, env.GetWorkflowResult(&report))
+	require.Equal(t, RecoveryReport{
+		Pages: 1,
+		Executions: []ExecutionReport{
+			{WorkflowID: "trip1", Terminated: true, Signals: 2, NewRunID: "run1", Outcome: ExecutionRecovered},
+			{WorkflowID: "trip2", Outcome: ExecutionFailed, Error: "terminate failed"},
+			{WorkflowID: "trip3", Outcome: ExecutionSkipped},
+		},
+		Recovered: 1,
+		Skipped:   1,
+		Failed:    1,
+	}, report)
+
+	value, err := env.QueryWorkflow(RecoveryReportQueryName)
+	require.NoError(t, err)
+	var queried RecoveryReport
+	require.NoError(t, value.Get(&queried))
+	require.Equal(t, report.Executions, queried.Executions)
+}
+
+func Test_RecoverWorkflowContinuesWithNextPage(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	startedBefore := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	executions := []Execution{{WorkflowID: "trip3"}, {WorkflowID: "trip4"}}
+	env.OnActivity(ListExecutions, mock.Anything, ListExecutionsParams{
+		Type:          "TripWorkflow",
+		StartedBefore: startedBefore,
+		PageSize:      2,
+		NextPageToken: []byte("page2"),
+	}).Return(&ListExecutionsResult{Executions: executions, NextPageToken: []byte("page3")}, nil)
+	env.OnActivity(RecoverExecutions, mock.Anything, executions, true, 0.0, (*ResetParams)(nil)).Return(nil, errors.New("worker lost"))
+
+	env.ExecuteWorkflow(RecoverWorkflow, Params{
+		Type:          "TripWorkflow",
+		DryRun:        true,
+		PageSize:      2,
+		StartedBefore: startedBefore,
+		NextPageToken: []byte("page2"),
+		Report:        RecoveryReport{Pages: 1, Recovered: 2},
+	})
+
+	require.True(t, env.IsWorkflowCompleted())
+	err := env.GetWorkflowError()
+	var continueAsNewErr *workflow.ContinueAsNewError
+	require.True(t, errors.As(err, &continueAsNewErr))
+	var params Params
+	require.NoError(t, converter.GetDefaultDataConverter().FromPayloads(continueAsNewErr.Input, &params))
+	require.Equal(t, Params{
+		Type:          "TripWorkflow",
+		DryRun:        true,
+		PageSize:      2,
+		StartedBefore: startedBefore,
+		NextPageToken: []byte("page3"),
+		Report:        RecoveryReport{DryRun: true, Pages: 2, Recovered: 2, Failed: 2},
+	}, params)
+}
+
+func Test_RecoverExecutionsDryRun(t *testing.T) {
+	dc := converter.GetDefaultDataConverter()
+	input, err := dc.ToPayloads(UserState{TripCounter: 3})
+	require.NoError(t, err)
+	trip, err := dc.ToPayloads(TripEvent{ID: "Trip1", Total: 10})
+	require.NoError(t, err)
+	history := []*historypb.HistoryEvent{
+		{
+			EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED,
+			Attributes: &historypb.HistoryEvent_WorkflowExecutionStartedEventAttributes{
+				WorkflowExecutionStartedEventAttributes: &historypb.WorkflowExecutionStartedEventAttributes{
+					WorkflowType: &commonpb.WorkflowType{Name: "TripWorkflow"},
+					TaskQueue:    &taskqueuepb.TaskQueue{Name: "recovery"},
+					Input:        input,
+				},
+			},
+		},
+		{
+			EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_SIGNALED,
+			Attributes: &historypb.HistoryEvent_WorkflowExecutionSignaledEventAttributes{
+				WorkflowExecutionSignaledEventAttributes: &historypb.WorkflowExecutionSignaledEventAttributes{
+					SignalName: TripSignalName,
+					Input:      trip,
+				},
+			},
+		},
+	}
+
+	// The dry run only reads the history, terminating or starting a workflow would fail the test
+	c := &mocks.Client{}
+	c.On("DescribeWorkflowExecution", mock.Anything, "trip1", "").Return(describeResponse("trip1", "run1"), nil)
+	c.On("GetWorkflowHistory", mock.Anything, "trip1", "run1", false, enumspb.HISTORY_EVENT_FILTER_TYPE_ALL_EVENT).
+		Return(historyIterator(history))
+
+	ctx := context.WithValue(context.Background(), TemporalClientKey, c)
+
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestActivityEnvironment()
+	env.SetWorkerOptions(worker.Options{BackgroundActivityContext: ctx})
+	env.RegisterActivity(RecoverExecutions)
+
+	value, err := env.ExecuteActivity(RecoverExecutions, []Execution{{WorkflowID: "trip1", RunID: "run1"}}, true, 0.0, (*ResetParams)(nil))
+	require.NoError(t, err)
+	var reports []ExecutionReport
+	require.NoError(t, value.Get(&reports))
+	require.Equal(t, []ExecutionReport{{
+		WorkflowID:   "trip1",
+		RunID:        "run1",
+		WorkflowType: "TripWorkflow",
+		Terminated:   true,
+		Signals:      1,
+		Outcome:      ExecutionWouldRecover,
+	}}, reports)
+	c.AssertExpectations(t)
+}
+
+func Test_RecoverExecutionsTwice(t *testing.T) {
+	dc := converter.GetDefaultDataConverter()
+	input, err := dc.ToPayloads(UserState{TripCounter: 3})
+	require.NoError(t, err)
+	trip1, err := dc.ToPayloads(TripEvent{ID: "Trip1", Total: 10})
+	require.NoError(t, err)
+	trip2, err := dc.ToPayloads(TripEvent{ID: "Trip2", Total: 20})
+	require.NoError(t, err)
+	signaled := func(input *commonpb.Payloads) *historypb.HistoryEvent {
+		return &historypb.HistoryEvent{
+			EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_SIGNALED,
+			Attributes: &historypb.HistoryEvent_WorkflowExecutionSignaledEventAttributes{
+				WorkflowExecutionSignaledEventAttributes: &historypb.WorkflowExecutionSignaledEventAttributes{
+					SignalName: TripSignalName,
+					Input:      input,
+				},
+			},
+		}
+	}
+	history := []*historypb.HistoryEvent{
+		{
+			EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED,
+			Attributes: &historypb.HistoryEvent_WorkflowExecutionStartedEventAttributes{
+				WorkflowExecutionStartedEventAttributes: &historypb.WorkflowExecutionStartedEventAttributes{
+					WorkflowType: &commonpb.WorkflowType{Name: "TripWorkflow"},
+					TaskQueue:    &taskqueuepb.TaskQueue{Name: "recovery"},
+					Input:        input,
+				},
+			},
+		},
+		signaled(trip1),
+		signaled(trip2),
+	}
+
+	// The first recovery restarts run1 as run2 but fails to send the second signal
+	c := &mocks.Client{}
+	c.On("DescribeWorkflowExecution", mock.Anything, "trip1", "").Return(describeResponse("trip1", "run1"), nil).Once()
+	c.On("GetWorkflowHistory", mock.Anything, "trip1", "run1", false, enumspb.HISTORY_EVENT_FILTER_TYPE_ALL_EVENT).
+		Return(historyIterator(history)).Once()
+	c.On("TerminateWorkflow", mock.Anything, "trip1", "run1", "Recover", mock.Anything).Return(nil).Once()
+	newRun := &mocks.WorkflowRun{}
+	newRun.On("GetRunID").Return("run2")
+	c.On("ExecuteWorkflow", mock.Anything, mock.Anything, "TripWorkflow", input).Return(newRun, nil).Once()
+	c.On("SignalWorkflow", mock.Anything, "trip1", "run2", TripSignalName, trip1).Return(nil).Once()
+	c.On("SignalWorkflow", mock.Anything, "trip1", "run2", TripSignalName, trip2).Return(errors.New("signal failed")).Once()
+	// The second recovery finds run2 current and leaves it alone
+	c.On("DescribeWorkflowExecution", mock.Anything, "trip1", "").Return(describeResponse("trip1", "run2"), nil).Once()
+	ctx := context.WithValue(context.Background(), TemporalClientKey, c)
+
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestActivityEnvironment()
+	env.SetWorkerOptions(worker.Options{BackgroundActivityContext: ctx})
+	env.RegisterActivity(RecoverExecutions)
+
+	executions := []Execution{{WorkflowID: "trip1", RunID: "run1"}}
+	value, err := env.ExecuteActivity(RecoverExecutions, executions, false, 0.0, (*ResetParams)(nil))
+	require.NoError(t, err)
+	var reports []ExecutionReport
+	require.NoError(t, value.Get(&reports))
+	require.Equal(t, []ExecutionReport{{
+		WorkflowID:   "trip1",
+		RunID:        "run1",
+		WorkflowType: "TripWorkflow",
+		Terminated:   true,
+		Signals:      1,
+		NewRunID:     "run2",
+		Outcome:      ExecutionFailed,
+		Error:        "signal failed",
+	}}, reports)
+
+	value, err = env.ExecuteActivity(RecoverExecutions, executions, false, 0.0, (*ResetParams)(nil))
+	require.NoError(t, err)
+	require.NoError(t, value.Get(&reports))
+	require.Equal(t, []ExecutionReport{{
+		WorkflowID: "trip1",
+		RunID:      "run1",
+		Outcome:    ExecutionSkipped,
+	}}, reports)
+	c.AssertExpectations(t)
+}
+
+// describeResponse describes the current run of the workflow
+func describeResponse(workflowID, runID string) *workflowservice.DescribeWorkflowExecutionResponse {
+	return &workflowservice.DescribeWorkflowExecutionResponse{
+		WorkflowExecutionInfo: &workflowpb.WorkflowExecutionInfo{
+			Execution: &commonpb.WorkflowExecution{WorkflowId: workflowID, RunId: runID},
+		},
+	}
+}
+
+// historyIterator iterates over the events of the history
+func historyIterator(history []*historypb.HistoryEvent) *mocks.HistoryEventIterator {
+	iter := &mocks.HistoryEventIterator{}
+	iter.On("HasNext").Return(true).Times(len(history))
+	for _, event := range history {
+		iter.On("Next").Return(event, nil).Once()
+	}
+	iter.On("HasNext").Return(false)
+	return iter
+}
+
+func Test_ListQuery(t *testing.T) {
+	startedBefore := time.Date(2021, 3, 1, 12, 30, 0, 0, time.FixedZone("CET", 3600))
+	require.Equal(t, "StartTime < '2021-03-01T11:30:00Z' and WorkflowType = 'TripWorkflow' and "+
+		"(CustomKeywordField = 'trip' or ExecutionStatus = 'Failed')",
+		listQuery("TripWorkflow", "CustomKeywordField = 'trip' or ExecutionStatus = 'Failed'", startedBefore))
+	require.Equal(t, "StartTime < '2021-03-01T11:30:00Z' and (ExecutionStatus = 'Running')",
+		listQuery("", "ExecutionStatus = 'Running'", startedBefore))
+}
+
+func Test_RestartLimiter(t *testing.T) {
+	limiter := newRestartLimiter(20)
+	heartbeats := 0
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, limiter.wait(context.Background(), func() { heartbeats++ }))
+	}
+	// The first restart is not delayed
+	require.GreaterOrEqual(t, int64(time.Since(start)), int64(100*time.Millisecond))
+	require.Equal(t, 2, heartbeats)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, limiter.wait(ctx, func() {}), context.Canceled)
+
+	require.NoError(t, newRestartLimiter(0).wait(ctx, func() {}))
+}
+
+func Test_ExtractRestartParams(t *testing.T) {
+	dc := converter.GetDefaultDataConverter()
+	input, err := dc.ToPayloads("order-1", 42)
+	require.NoError(t, err)
+	customer, err := dc.ToPayload("customer-1")
+	require.NoError(t, err)
+	count, err := dc.ToPayload(int64(9007199254740993))
+	require.NoError(t, err)
+
+	executionTimeout, runTimeout, taskTimeout := time.Hour, 10*time.Minute, 10*time.Second
+	initialInterval, maximumInterval := time.Second, time.Minute
+	event := &historypb.HistoryEvent{
+		EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED,
+		Attributes: &historypb.HistoryEvent_WorkflowExecutionStartedEventAttributes{
+			WorkflowExecutionStartedEventAttributes: &historypb.WorkflowExecutionStartedEventAttributes{
+				WorkflowType:             &commonpb.WorkflowType{Name: "OrderWorkflow"},
+				TaskQueue:                &taskqueuepb.TaskQueue{Name: "orders"},
+				Input:                    input,
+				WorkflowExecutionTimeout: &executionTimeout,
+				WorkflowRunTimeout:       &runTimeout,
+				WorkflowTaskTimeout:      &taskTimeout,
+				RetryPolicy: &commonpb.RetryPolicy{
+					InitialInterval:        &initialInterval,
+					BackoffCoefficient:     2,
+					MaximumInterval:        &maximumInterval,
+					MaximumAttempts:        3,
+					NonRetryableErrorTypes: []string{"InvalidOrder"},
+				},
+				Memo:             &commonpb.Memo{Fields: map[string]*commonpb.Payload{"Customer": customer}},
+				SearchAttributes: &commonpb.SearchAttributes{IndexedFields: map[string]*commonpb.Payload{"CustomIntField": count}},
+			},
+		},
+	}
+
+	params, err := extractRestartParams("order-1", event)
+	require.NoError(t, err)
+	require.Equal(t, "OrderWorkflow", params.WorkflowType)
+	require.Equal(t, input, params.Input)
+	require.Equal(t, "order-1", params.Options.ID)
+	require.Equal(t, "orders", params.Options.TaskQueue)
+	require.Equal(t, executionTimeout, params.Options.WorkflowExecutionTimeout)
+	require.Equal(t, runTimeout, params.Options.WorkflowRunTimeout)
+	require.Equal(t, taskTimeout, params.Options.WorkflowTaskTimeout)
+	require.Equal(t, &temporal.RetryPolicy{
+		InitialInterval:        initialInterval,
+		BackoffCoefficient:     2,
+		MaximumInterval:        maximumInterval,
+		MaximumAttempts:        3,
+		NonRetryableErrorTypes: []string{"InvalidOrder"},
+	}, params.Options.RetryPolicy)
+
+	// The client encodes the memo and the search attributes back to the same payloads
+	memo, err := dc.ToPayload(params.Options.Memo["Customer"])
+	require.NoError(t, err)
+	require.Equal(t, customer, memo)
+	searchAttribute, err := dc.ToPayload(params.Options.SearchAttributes["CustomIntField"])
+	require.NoError(t, err)
+	require.Equal(t, count, searchAttribute)
+}
+
+func Test_ExtractRestartParamsUnsupportedEncoding(t *testing.T) {
+	event := &historypb.HistoryEvent{
+		EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED,
+		Attributes: &historypb.HistoryEvent_WorkflowExecutionStartedEventAttributes{
+			WorkflowExecutionStartedEventAttributes: &historypb.WorkflowExecutionStartedEventAttributes{
+				WorkflowType: &commonpb.WorkflowType{Name: "OrderWorkflow"},
+				Memo: &commonpb.Memo{Fields: map[string]*commonpb.Payload{"Customer": {
+					Metadata: map[string][]byte{converter.MetadataEncoding: []byte(converter.MetadataEncodingProto)},
+				}}},
+			},
+		},
+	}
+
+	_, err := extractRestartParams("order-1", event)
+	require.ErrorIs(t, err, ErrUnsupportedEncoding)
+}
+
+func Test_ExtractSignals(t *testing.T) {
+	dc := converter.GetDefaultDataConverter()
+	trip, err := dc.ToPayloads(TripEvent{ID: "Trip1", Total: 10})
+	require.NoError(t, err)
+	cancel, err := dc.ToPayloads("requested by user")
+	require.NoError(t, err)
+
+	signaled := func(name string, input *commonpb.Payloads) *historypb.HistoryEvent {
+		return &historypb.HistoryEvent{
+			EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_SIGNALED,
+			Attributes: &historypb.HistoryEvent_WorkflowExecutionSignaledEventAttributes{
+				WorkflowExecutionSignaledEventAttributes: &historypb.WorkflowExecutionSignaledEventAttributes{
+					SignalName: name,
+					Input:      input,
+				},
+			},
+		}
+	}
+	events := []*historypb.HistoryEvent{
+		{EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED},
+		signaled(TripSignalName, trip),
+		{EventType: enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED},
+		signaled("cancel", cancel),
+		signaled("wake-up", nil),
+	}
+
+	require.Equal(t, []*SignalParams{
+		{Name: TripSignalName, Input: trip},
+		{Name: "cancel", Input: cancel},
+		{Name: "wake-up"},
+	}, extractSignals(events))
+}
+
+func Test_RawDataConverter(t *testing.T) {
+	dc := NewRawDataConverter(converter.GetDefaultDataConverter())
+	raw := &commonpb.Payloads{Payloads: []*commonpb.Payload{
+		{Metadata: map[string][]byte{converter.MetadataEncoding: []byte("binary/encrypted")}, Data: []byte{1, 2, 3}},
+		{Metadata: map[string][]byte{converter.MetadataEncoding: []byte(converter.MetadataEncodingJSON)}, Data: []byte("2")},
+	}}
+
+	payloads, err := dc.ToPayloads(raw)
+	require.NoError(t, err)
+	require.Equal(t, raw, payloads)
+
+	payload, err := dc.ToPayload(raw.Payloads[0])
+	require.NoError(t, err)
+	require.Equal(t, raw.Payloads[0], payload)
+
+	// The other values are converted by the wrapped DataConverter
+	payloads, err = dc.ToPayloads(UserState{TripCounter: 3}, json.RawMessage(`{"ID":"Trip1"}`))
+	require.NoError(t, err)
+	var state UserState
+	var trip TripEvent
+	require.NoError(t, dc.FromPayloads(payloads, &state, &trip))
+	require.Equal(t, UserState{TripCounter: 3}, state)
+	require.Equal(t, TripEvent{ID: "Trip1"}, trip)
+}
@@ -0,0 +1,154 @@
+package recovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/pborman/uuid"
+	commonpb "go.temporal.io/api/common/v1"
+	enumspb "go.temporal.io/api/enums/v1"
+	historypb "go.temporal.io/api/history/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/client"
+)
+
+// Policies for the signals received after the reset point of an execution
+const (
+	// ReapplySignals reapplies the signals to the new run, which is done by the server
+	ReapplySignals = "signal"
+	// ReapplyNone does not reapply the signals. The server of this API version always reapplies them, so the
+	// executions which received signals after their reset point are not reset.
+	ReapplyNone = "none"
+)
+
+// ResetParams selects the reset point of the executions recovered by a reset. The reset point is the last completed
+// workflow task before the selected event, all the events from the reset point are dropped and the workflow tasks
+// from it run again, with the new code. The new run keeps the history before the reset point: its timers, the results
+// of its activities and its lineage.
+type ResetParams struct {
+	// EventID selects the event by ID
+	EventID int64
+	// EventType selects the last event of this type when EventID is not set, e.g. "WorkflowTaskFailed". The last
+	// event of the history is selected when neither are set, so the reset point is the last completed workflow task.
+	EventType string
+	// Reapply is the policy for the signals received after the reset point, ReapplySignals if not set
+	Reapply string
+}
+
+var (
+	// ErrUnknownEventType when ResetParams.EventType is not the name of an event type
+	ErrUnknownEventType = errors.New("unknown event type")
+	// ErrUnknownReapplyType when ResetParams.Reapply is not one of the reapply policies
+	ErrUnknownReapplyType = errors.New("unknown reapply type")
+	// ErrResetPointNotFound when the history has no completed workflow task before the selected event
+	ErrResetPointNotFound = errors.New("reset point not found")
+	// ErrSignalsAfterResetPoint when the signals received after the reset point would be reapplied despite ReapplyNone
+	ErrSignalsAfterResetPoint = errors.New("signals received after the reset point would be reapplied")
+)
+
+// validate checks the parameters before any execution is listed, so invalid ones fail the recovery early
+func (r *ResetParams) validate() error {
+	if r.EventType != "" {
+		if _, err := eventType(r.EventType); err != nil {
+			return err
+		}
+	}
+	switch r.Reapply {
+	case "", ReapplySignals, ReapplyNone:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownReapplyType, r.Reapply)
+	}
+}
+
+// eventType parses the name of an event type, as shown by the tools, e.g. "WorkflowTaskFailed"
+func eventType(name string) (enumspb.EventType, error) {
+	if value, ok := enumspb.EventType_value[name]; ok && value != 0 {
+		return enumspb.EventType(value), nil
+	}
+	return enumspb.EVENT_TYPE_UNSPECIFIED, fmt.Errorf("%w: %s", ErrUnknownEventType, name)
+}
+
+// findResetPoint returns the ID of the last workflow task completed event before the event selected by reset, and
+// the number of signals received after it
+func findResetPoint(history []*historypb.HistoryEvent, reset *ResetParams) (resetEventID int64, signals int, err error) {
+	selectedEventID := history[len(history)-1].GetEventId()
+	switch {
+	case reset.EventID > 0:
+		selectedEventID = reset.EventID
+	case reset.EventType != "":
+		selectedType, err := eventType(reset.EventType)
+		if err != nil {
+			return 0, 0, err
+		}
+		selectedEventID = 0
+		for _, event := range history {
+			if event.GetEventType() == selectedType {
+				selectedEventID = event.GetEventId()
+			}
+		}
+		if selectedEventID == 0 {
+			return 0, 0, fmt.Errorf("%w: no %s event", ErrResetPointNotFound, reset.EventType)
+		}
+	}
+
+	for _, event := range history {
+		if event.GetEventId() > selectedEventID {
+			break
+		}
+		if event.GetEventType() == enumspb.EVENT_TYPE_WORKFLOW_TASK_COMPLETED {
+			resetEventID = event.GetEventId()
+		}
+	}
+	if resetEventID == 0 {
+		return 0, 0, fmt.Errorf("%w: no workflow task completed before event %d", ErrResetPointNotFound, selectedEventID)
+	}
+
+	for _, event := range history {
+		if event.GetEventId() > resetEventID && event.GetEventType() == enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_SIGNALED {
+			signals++
+		}
+	}
+	return resetEventID, signals, nil
+}
+
+// resetExecution resets the run of the workflow to the reset point selected by reset, filling the report
+func resetExecution(ctx context.Context, c client.Client, execution *commonpb.WorkflowExecution,
+	history []*historypb.HistoryEvent, dryRun bool, reset *ResetParams, report *ExecutionReport) error {
+	resetEventID, signals, err := findResetPoint(history, reset)
+	if err != nil {
+		return err
+	}
+	report.ResetEventID = resetEventID
+	if signals > 0 && reset.Reapply == ReapplyNone {
+		return fmt.Errorf("%w: %d signals", ErrSignalsAfterResetPoint, signals)
+	}
+	report.Signals = signals
+
+	if dryRun {
+		report.Outcome = ExecutionWouldRecover
+		return nil
+	}
+
+	resp, err := c.ResetWorkflowExecution(ctx, &workflowservice.ResetWorkflowExecutionRequest{
+		Namespace:                 client.DefaultNamespace,
+		WorkflowExecution:         execution,
+		Reason:                    "Recover",
+		WorkflowTaskFinishEventId: resetEventID,
+		RequestId:                 uuid.New(),
+	})
+	if err != nil {
+		return err
+	}
+	report.NewRunID = resp.GetRunId()
+
+	activity.GetLogger(ctx).Info("Successfully reset workflow.",
+		"WorkflowID", execution.GetWorkflowId(),
+		"ResetEventID", resetEventID,
+		"NewRunID", resp.GetRunId())
+
+	report.Outcome = ExecutionRecovered
+	return nil
+}
@@ -0,0 +1,129 @@
+package recovery
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	commonpb "go.temporal.io/api/common/v1"
+	enumspb "go.temporal.io/api/enums/v1"
+	historypb "go.temporal.io/api/history/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/mocks"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+)
+
+// resetHistory is the history of a workflow which completed a workflow task, received a signal, then failed the next
+// workflow tasks
+func resetHistory() []*historypb.HistoryEvent {
+	eventTypes := []enumspb.EventType{
+		enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_STARTED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_COMPLETED,
+		enumspb.EVENT_TYPE_TIMER_STARTED,
+		enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_SIGNALED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_STARTED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_COMPLETED,
+		enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_SIGNALED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_STARTED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_FAILED,
+	}
+	history := make([]*historypb.HistoryEvent, len(eventTypes))
+	for i, eventType := range eventTypes {
+		history[i] = &historypb.HistoryEvent{EventId: int64(i + 1), EventType: eventType}
+	}
+	history[0].Attributes = &historypb.HistoryEvent_WorkflowExecutionStartedEventAttributes{
+		WorkflowExecutionStartedEventAttributes: &historypb.WorkflowExecutionStartedEventAttributes{
+			WorkflowType: &commonpb.WorkflowType{Name: "TripWorkflow"},
+		},
+	}
+	return history
+}
+
+func Test_FindResetPoint(t *testing.T) {
+	history := resetHistory()
+
+	resetEventID, signals, err := findResetPoint(history, &ResetParams{})
+	require.NoError(t, err)
+	require.Equal(t, int64(9), resetEventID)
+	require.Equal(t, 1, signals)
+
+	resetEventID, signals, err = findResetPoint(history, &ResetParams{EventType: "TimerStarted"})
+	require.NoError(t, err)
+	require.Equal(t, int64(4), resetEventID)
+	require.Equal(t, 2, signals)
+
+	resetEventID, signals, err = findResetPoint(history, &ResetParams{EventID: 9, EventType: "TimerStarted"})
+	require.NoError(t, err)
+	require.Equal(t, int64(9), resetEventID)
+	require.Equal(t, 1, signals)
+
+	_, _, err = findResetPoint(history, &ResetParams{EventID: 3})
+	require.ErrorIs(t, err, ErrResetPointNotFound)
+	_, _, err = findResetPoint(history, &ResetParams{EventType: "ActivityTaskScheduled"})
+	require.ErrorIs(t, err, ErrResetPointNotFound)
+}
+
+func Test_ResetParamsValidate(t *testing.T) {
+	require.NoError(t, (&ResetParams{}).validate())
+	require.NoError(t, (&ResetParams{EventType: "WorkflowTaskFailed", Reapply: ReapplyNone}).validate())
+	require.NoError(t, (&ResetParams{EventID: 9, Reapply: ReapplySignals}).validate())
+	require.ErrorIs(t, (&ResetParams{EventType: "WorkflowTaskBroken"}).validate(), ErrUnknownEventType)
+	require.ErrorIs(t, (&ResetParams{EventType: "Unspecified"}).validate(), ErrUnknownEventType)
+	require.ErrorIs(t, (&ResetParams{Reapply: "all"}).validate(), ErrUnknownReapplyType)
+}
+
+func Test_RecoverExecutionsReset(t *testing.T) {
+	history := resetHistory()
+	c := &mocks.Client{}
+	for _, workflowID := range []string{"trip1", "trip2"} {
+		c.On("DescribeWorkflowExecution", mock.Anything, workflowID, "").Return(describeResponse(workflowID, "run1"), nil).Once()
+		c.On("GetWorkflowHistory", mock.Anything, workflowID, "run1", false, enumspb.HISTORY_EVENT_FILTER_TYPE_ALL_EVENT).
+			Return(historyIterator(history)).Once()
+	}
+	// the listed run is reset
+	c.On("ResetWorkflowExecution", mock.Anything, mock.MatchedBy(func(request *workflowservice.ResetWorkflowExecutionRequest) bool {
+		return request.GetWorkflowExecution().GetWorkflowId() == "trip1" && request.GetWorkflowExecution().GetRunId() == "run1" &&
+			request.GetWorkflowTaskFinishEventId() == 9
+	})).Return(&workflowservice.ResetWorkflowExecutionResponse{RunId: "run2"}, nil).Once()
+	ctx := context.WithValue(context.Background(), TemporalClientKey, c)
+
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestActivityEnvironment()
+	env.SetWorkerOptions(worker.Options{BackgroundActivityContext: ctx})
+	env.RegisterActivity(RecoverExecutions)
+
+	// trip1 is reset, trip2 is not as its signal would be reapplied
+	value, err := env.ExecuteActivity(RecoverExecutions, []Execution{{WorkflowID: "trip1", RunID: "run1"}}, false, 0.0, &ResetParams{})
+	require.NoError(t, err)
+	var reports []ExecutionReport
+	require.NoError(t, value.Get(&reports))
+	require.Equal(t, []ExecutionReport{{
+		WorkflowID:   "trip1",
+		RunID:        "run1",
+		WorkflowType: "TripWorkflow",
+		ResetEventID: 9,
+		Signals:      1,
+		NewRunID:     "run2",
+		Outcome:      ExecutionRecovered,
+	}}, reports)
+
+	value, err = env.ExecuteActivity(RecoverExecutions, []Execution{{WorkflowID: "trip2", RunID: "run1"}}, false, 0.0,
+		&ResetParams{Reapply: ReapplyNone})
+	require.NoError(t, err)
+	require.NoError(t, value.Get(&reports))
+	require.Equal(t, []ExecutionReport{{
+		WorkflowID:   "trip2",
+		RunID:        "run1",
+		WorkflowType: "TripWorkflow",
+		ResetEventID: 9,
+		Outcome:      ExecutionFailed,
+		Error:        "signals received after the reset point would be reapplied: 1 signals",
+	}}, reports)
+	c.AssertExpectations(t)
+}
@@ -1,15 +1,21 @@
 package recovery
 
 import (
-	commonpb "go.temporal.io/api/common/v1"
-	"go.temporal.io/sdk/converter"
 	"go.temporal.io/sdk/workflow"
 )
 
 type (
-	// UserState kept within workflow and passed from one run to another on ContinueAsNew
+	// UserState kept within workflow and passed from one run to another on ContinueAsNew, returned by the QueryName
+	// query
 	UserState struct {
+		// TripCounter is the number of trips of the user
 		TripCounter int
+		// Total is the sum of the totals of the trips of the user
+		Total int
+		// ProcessedTrips are the IDs of the last MaxProcessedTrips trips, oldest first. A trip event with one of these
+		// IDs is a duplicate, e.g. a signal sent again by the recovery, and is ignored. The trip events without ID
+		// are always counted and not recorded.
+		ProcessedTrips []string
 	}
 
 	// TripEvent passed in as signal to TripWorkflow
@@ -25,21 +31,53 @@ const (
 
 	// QueryName is the query type name
 	QueryName = "counter"
+
+	// MaxProcessedTrips is the number of trip IDs kept to detect the duplicate trip events, which bounds the size
+	// of the state passed to the new runs
+	MaxProcessedTrips = 100
 )
 
+// processed returns whether the trip was already counted, never for a trip without ID
+func (s *UserState) processed(tripID string) bool {
+	if tripID == "" {
+		return false
+	}
+	for _, id := range s.ProcessedTrips {
+		if id == tripID {
+			return true
+		}
+	}
+	return false
+}
+
+// add counts the trip and records its ID, forgetting the oldest ID beyond MaxProcessedTrips
+func (s *UserState) add(trip TripEvent) {
+	s.TripCounter++
+	s.Total += trip.Total
+	if trip.ID == "" {
+		return
+	}
+	s.ProcessedTrips = append(s.ProcessedTrips, trip.ID)
+	if len(s.ProcessedTrips) > MaxProcessedTrips {
+		s.ProcessedTrips = append([]string(nil), s.ProcessedTrips[len(s.ProcessedTrips)-MaxProcessedTrips:]...)
+	}
+}
+
 // TripWorkflow to keep track of total trip count for a user
-// It waits on a TripEvent signal and increments a counter on each signal received by this workflow
-// Trip count is managed as workflow state and passed to new run after 10 signals received by each execution
+// It waits on a TripEvent signal and counts each trip received by this workflow once, so the signals sent again by the
+// recovery are not counted twice.
+// The state is passed to new run after 10 signals received by each execution
 func TripWorkflow(ctx workflow.Context, state UserState) error {
 	logger := workflow.GetLogger(ctx)
 	workflowID := workflow.GetInfo(ctx).WorkflowExecution.ID
 	logger.Info("Trip Workflow Started for User.",
 		"User", workflowID,
-		"TripCounter", state.TripCounter)
+		"TripCounter", state.TripCounter,
+		"Total", state.Total)
 
-	// Register query handler to return trip count
-	err := workflow.SetQueryHandler(ctx, QueryName, func(input []byte) (int, error) {
-		return state.TripCounter, nil
+	// Register query handler to return the state of the user
+	err := workflow.SetQueryHandler(ctx, QueryName, func() (UserState, error) {
+		return state, nil
 	})
 
 	if err != nil {
@@ -52,28 +90,14 @@ func TripWorkflow(ctx workflow.Context, state UserState) error {
 	for i := 0; i < 10; i++ {
 		var trip TripEvent
 		tripCh.Receive(ctx, &trip)
+		if state.processed(trip.ID) {
+			logger.Info("Duplicate trip complete event ignored.", "ID", trip.ID, "Total", trip.Total)
+			continue
+		}
 		logger.Info("Trip complete event received.", "ID", trip.ID, "Total", trip.Total)
-		state.TripCounter++
+		state.add(trip)
 	}
 
-	logger.Info("Starting a new run.", "TripCounter", state.TripCounter)
+	logger.Info("Starting a new run.", "TripCounter", state.TripCounter, "Total", state.Total)
 	return workflow.NewContinueAsNewError(ctx, "TripWorkflow", state)
 }
-
-func deserializeUserState(data *commonpb.Payloads) (UserState, error) {
-	var state UserState
-	if err := converter.GetDefaultDataConverter().FromPayloads(data, &state); err != nil {
-		return UserState{}, err
-	}
-
-	return state, nil
-}
-
-func deserializeTripEvent(data *commonpb.Payloads) (TripEvent, error) {
-	var trip TripEvent
-	if err := converter.GetDefaultDataConverter().FromPayloads(data, &trip); err != nil {
-		return TripEvent{}, err
-	}
-
-	return trip, nil
-}
@@ -0,0 +1,99 @@
+package recovery
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+func Test_TripWorkflowIgnoresDuplicateTrips(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	trips := []TripEvent{
+		{ID: "Trip1", Total: 10},
+		{ID: "Trip2", Total: 20},
+		// sent again by the recovery
+		{ID: "Trip1", Total: 10},
+		{ID: "Trip2", Total: 20},
+	}
+	for i, trip := range trips {
+		trip := trip
+		env.RegisterDelayedCallback(func() {
+			env.SignalWorkflow(TripSignalName, trip)
+		}, time.Duration(i+1)*time.Minute)
+	}
+	env.RegisterDelayedCallback(func() {
+		value, err := env.QueryWorkflow(QueryName)
+		require.NoError(t, err)
+		var state UserState
+		require.NoError(t, value.Get(&state))
+		require.Equal(t, UserState{TripCounter: 3, Total: 35, ProcessedTrips: []string{"Trip0", "Trip1", "Trip2"}}, state)
+		env.CancelWorkflow()
+	}, time.Hour)
+
+	env.ExecuteWorkflow(TripWorkflow, UserState{TripCounter: 1, Total: 5, ProcessedTrips: []string{"Trip0"}})
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.Error(t, env.GetWorkflowError())
+}
+
+func Test_TripWorkflowCountsTripsWithoutID(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	for i, trip := range []TripEvent{{Total: 10}, {Total: 20}} {
+		trip := trip
+		env.RegisterDelayedCallback(func() {
+			env.SignalWorkflow(TripSignalName, trip)
+		}, time.Duration(i+1)*time.Minute)
+	}
+	env.RegisterDelayedCallback(func() {
+		value, err := env.QueryWorkflow(QueryName)
+		require.NoError(t, err)
+		var state UserState
+		require.NoError(t, value.Get(&state))
+		require.Equal(t, UserState{TripCounter: 2, Total: 30}, state)
+		env.CancelWorkflow()
+	}, time.Hour)
+
+	env.ExecuteWorkflow(TripWorkflow, UserState{})
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.Error(t, env.GetWorkflowError())
+}
+
+func Test_TripWorkflowContinuesAsNewWithProcessedTrips(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	state := UserState{TripCounter: MaxProcessedTrips}
+	for i := 0; i < MaxProcessedTrips; i++ {
+		state.ProcessedTrips = append(state.ProcessedTrips, "Trip"+strconv.Itoa(i))
+	}
+	for i := 0; i < 10; i++ {
+		id := "Trip" + strconv.Itoa(MaxProcessedTrips+i)
+		env.RegisterDelayedCallback(func() {
+			env.SignalWorkflow(TripSignalName, TripEvent{ID: id, Total: 1})
+		}, time.Duration(i+1)*time.Minute)
+	}
+
+	env.ExecuteWorkflow(TripWorkflow, state)
+
+	require.True(t, env.IsWorkflowCompleted())
+	var continueAsNewErr *workflow.ContinueAsNewError
+	require.True(t, errors.As(env.GetWorkflowError(), &continueAsNewErr))
+	var next UserState
+	require.NoError(t, converter.GetDefaultDataConverter().FromPayloads(continueAsNewErr.Input, &next))
+	require.Equal(t, MaxProcessedTrips+10, next.TripCounter)
+	require.Equal(t, 10, next.Total)
+	require.Len(t, next.ProcessedTrips, MaxProcessedTrips)
+	require.Equal(t, "Trip10", next.ProcessedTrips[0])
+	require.Equal(t, "Trip"+strconv.Itoa(MaxProcessedTrips+9), next.ProcessedTrips[MaxProcessedTrips-1])
+}
@@ -5,17 +5,19 @@ import (
 	"log"
 
 	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
 	"go.temporal.io/sdk/worker"
 	"go.temporal.io/sdk/workflow"
 
 	"github.com/temporalio/samples-go/recovery"
-	"github.com/temporalio/samples-go/recovery/cache"
 )
 
 func main() {
 	// The client and worker are heavyweight objects that should be created once per process.
 	c, err := client.NewClient(client.Options{
 		HostPort: client.DefaultHostPort,
+		// Passes the raw payloads of the recovered executions to their new runs
+		DataConverter: recovery.NewRawDataConverter(converter.GetDefaultDataConverter()),
 	})
 	if err != nil {
 		log.Fatalln("Unable to create client", err)
@@ -23,7 +25,6 @@ func main() {
 	defer c.Close()
 
 	ctx := context.WithValue(context.Background(), recovery.TemporalClientKey, c)
-	ctx = context.WithValue(ctx, recovery.WorkflowExecutionCacheKey, cache.NewLRU(10))
 
 	w := worker.New(c, "recovery", worker.Options{
 		BackgroundActivityContext: ctx,
@@ -31,7 +32,7 @@ func main() {
 
 	w.RegisterWorkflowWithOptions(recovery.RecoverWorkflow, workflow.RegisterOptions{Name: "RecoverWorkflow"})
 	w.RegisterWorkflowWithOptions(recovery.TripWorkflow, workflow.RegisterOptions{Name: "TripWorkflow"})
-	w.RegisterActivity(recovery.ListOpenExecutions)
+	w.RegisterActivity(recovery.ListExecutions)
 	w.RegisterActivity(recovery.RecoverExecutions)
 
 	err = w.Run(worker.InterruptCh())